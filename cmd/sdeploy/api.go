@@ -0,0 +1,362 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCancelledByLength bounds the "by" value recorded for a cancellation
+const maxCancelledByLength = 64
+
+// streamKeepalive is the interval of SSE comments keeping idle connections open
+const streamKeepalive = 15 * time.Second
+
+// APIHandler serves the authenticated status, history and control API
+type APIHandler struct {
+	configManager *ConfigManager
+	deployer      *Deployer
+	history       *HistoryStore
+	logger        *Logger
+	mux           *http.ServeMux
+}
+
+// projectStatus is the API view of a configured project
+type projectStatus struct {
+	Name        string   `json:"name"`
+	WebhookPath string   `json:"webhook_path"`
+	GitRepo     string   `json:"git_repo,omitempty"`
+	GitBranch   string   `json:"git_branch"`
+	OnBusy      string   `json:"on_busy"`
+	Deploying   bool     `json:"deploying"`
+	Pending     int      `json:"pending"`
+	CurrentRun  string   `json:"current_run,omitempty"` // ID of the running deployment, for /api/runs/{id}/stream
+	LastRun     *runView `json:"last_run,omitempty"`
+}
+
+// runView is the API view of a deployment run
+type runView struct {
+	DeployResult
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// newRunView wraps a deployment result for API output
+func newRunView(result *DeployResult) *runView {
+	return &runView{
+		DeployResult: *result,
+		Status:       result.Status(),
+		DurationMS:   result.Duration().Milliseconds(),
+	}
+}
+
+// NewAPIHandler creates a new API handler
+func NewAPIHandler(cm *ConfigManager, logger *Logger) *APIHandler {
+	h := &APIHandler{
+		configManager: cm,
+		logger:        logger,
+		mux:           http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("GET /api/projects", h.handleProjects)
+	h.mux.HandleFunc("GET /api/projects/{name}/runs", h.handleProjectRuns)
+	h.mux.HandleFunc("POST /api/projects/{name}/cancel", h.handleCancel)
+	h.mux.HandleFunc("GET /api/runs/{id}", h.handleRun)
+	h.mux.HandleFunc("GET /api/runs/{id}/stream", h.handleRunStream)
+
+	return h
+}
+
+// SetDeployer sets the deployer used to report lock state and cancel runs
+func (h *APIHandler) SetDeployer(deployer *Deployer) {
+	h.deployer = deployer
+}
+
+// SetHistoryStore sets the store used to report past runs
+func (h *APIHandler) SetHistoryStore(store *HistoryStore) {
+	h.history = store
+}
+
+// ServeHTTP implements http.Handler
+func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := h.configManager.GetConfig().APIToken
+
+	// API is disabled unless api_token is configured
+	if token == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.authenticate(r, token) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sdeploy"`)
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// authenticate checks the bearer token using constant-time comparison
+func (h *APIHandler) authenticate(r *http.Request, token string) bool {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || provided == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// handleProjects lists configured projects with their current state
+func (h *APIHandler) handleProjects(w http.ResponseWriter, r *http.Request) {
+	cfg := h.configManager.GetConfig()
+
+	projects := make([]projectStatus, 0, len(cfg.Projects))
+	for i := range cfg.Projects {
+		projects = append(projects, h.projectStatus(&cfg.Projects[i]))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"projects": projects})
+}
+
+// projectStatus builds the status view of a single project
+func (h *APIHandler) projectStatus(project *ProjectConfig) projectStatus {
+	status := projectStatus{
+		Name:        project.Name,
+		WebhookPath: project.WebhookPath,
+		GitRepo:     project.GitRepo,
+		GitBranch:   project.GitBranch,
+		OnBusy:      project.OnBusy,
+	}
+
+	if h.deployer != nil {
+		status.Deploying = h.deployer.IsDeploying(project.WebhookPath)
+		status.Pending = h.deployer.PendingCount(project.WebhookPath)
+		status.CurrentRun = h.deployer.CurrentRun(project.WebhookPath)
+	}
+
+	if h.history != nil {
+		if runs, err := h.history.List(projectKey(project), 1); err == nil && len(runs) > 0 {
+			status.LastRun = newRunView(&runs[0])
+		}
+	}
+
+	return status
+}
+
+// handleProjectRuns lists recent runs of a project, newest first
+func (h *APIHandler) handleProjectRuns(w http.ResponseWriter, r *http.Request) {
+	project := h.configManager.GetProjectByName(r.PathValue("name"))
+	if project == nil {
+		writeJSONError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	if h.history == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "deployment history is disabled")
+		return
+	}
+
+	limit := Defaults.APIRunsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	runs, err := h.history.List(projectKey(project), limit)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Errorf(project.Name, "Failed to list deployment history: %v", err)
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to read deployment history")
+		return
+	}
+
+	views := make([]*runView, 0, len(runs))
+	for i := range runs {
+		views = append(views, newRunView(&runs[i]))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"project": h.projectStatus(project),
+		"runs":    views,
+	})
+}
+
+// handleCancel cancels the running deployment of a project. The optional
+// "by" query parameter names who cancelled it (default "api").
+func (h *APIHandler) handleCancel(w http.ResponseWriter, r *http.Request) {
+	project := h.configManager.GetProjectByName(r.PathValue("name"))
+	if project == nil {
+		writeJSONError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	if h.deployer == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "deployer is not available")
+		return
+	}
+
+	by := strings.TrimSpace(r.URL.Query().Get("by"))
+	if by == "" {
+		by = "api"
+	}
+	by = truncateUTF8(by, maxCancelledByLength)
+
+	runIDs, err := h.deployer.Cancel(project.WebhookPath, by)
+	if err != nil {
+		if errors.Is(err, ErrNotDeploying) {
+			writeJSONError(w, http.StatusConflict, "no deployment is running")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if h.logger != nil {
+		h.logger.Warnf(project.Name, "Cancel requested for run %s by %s", strings.Join(runIDs, ", "), by)
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"project":      project.Name,
+		"run_id":       strings.Join(runIDs, ","),
+		"cancelled_by": by,
+	})
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a UTF-8 character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// handleRun returns a single run by ID
+func (h *APIHandler) handleRun(w http.ResponseWriter, r *http.Request) {
+	if h.history == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "deployment history is disabled")
+		return
+	}
+
+	run, err := h.history.Get(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, ErrRunNotFound) {
+			writeJSONError(w, http.StatusNotFound, "run not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to read deployment history")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newRunView(run))
+}
+
+// handleRunStream streams a run's output as Server-Sent Events. Each output
+// line is a message whose id is its line number; a final "done" event carries
+// the run's result. Finished runs get the "done" event only.
+func (h *APIHandler) handleRunStream(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("id")
+
+	var stream *RunStream
+	if h.deployer != nil {
+		stream = h.deployer.Stream(runID)
+	}
+
+	var finished *DeployResult
+	if stream == nil {
+		if h.history == nil {
+			writeJSONError(w, http.StatusNotFound, "run not found")
+			return
+		}
+		run, err := h.history.Get(runID)
+		if err != nil {
+			if errors.Is(err, ErrRunNotFound) {
+				writeJSONError(w, http.StatusNotFound, "run not found")
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "failed to read deployment history")
+			return
+		}
+		finished = run
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disable response buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if finished != nil {
+		writeDoneEvent(w, finished)
+		flusher.Flush()
+		return
+	}
+
+	// Reconnecting clients resume after the last line they received
+	next := 0
+	if id, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil && id >= 0 {
+		next = id + 1
+	}
+
+	notify, unsubscribe := stream.Subscribe()
+	defer unsubscribe()
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		lines, end, result := stream.Lines(next)
+		for i, line := range lines {
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", end-len(lines)+i, line)
+		}
+		next = end
+		if result != nil {
+			writeDoneEvent(w, result)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-notify:
+		case <-keepalive.C:
+			io.WriteString(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeDoneEvent writes the final SSE event of a run
+func writeDoneEvent(w io.Writer, result *DeployResult) {
+	data, _ := json.Marshal(newRunView(result))
+	fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes a JSON error response
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
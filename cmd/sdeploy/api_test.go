@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+const testAPIConfig = `
+api_token: test-token
+projects:
+  - name: Frontend
+    webhook_path: /hooks/frontend
+    webhook_secret: secret1
+    execute_command: echo frontend
+  - name: Backend
+    webhook_path: /hooks/backend
+    webhook_secret: secret2
+    execute_command: echo backend
+`
+
+// newTestAPIHandler creates an API handler backed by a temporary config and history store
+func newTestAPIHandler(t *testing.T, config string) (*APIHandler, *Deployer, *HistoryStore) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cm, err := NewConfigManager(configPath, nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager failed: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	store, err := NewHistoryStore(tmpDir)
+	if err != nil {
+		t.Fatalf("NewHistoryStore failed: %v", err)
+	}
+
+	deployer := NewDeployer(nil)
+	deployer.SetHistoryStore(store)
+
+	handler := NewAPIHandler(cm, nil)
+	handler.SetDeployer(deployer)
+	handler.SetHistoryStore(store)
+	return handler, deployer, store
+}
+
+// apiRequest performs an authenticated API request
+func apiRequest(handler http.Handler, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestAPIAuthentication tests that the API requires the configured bearer token
+func TestAPIAuthentication(t *testing.T) {
+	handler, _, _ := newTestAPIHandler(t, testAPIConfig)
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"wrong scheme", "Basic test-token", http.StatusUnauthorized},
+		{"valid token", "Bearer test-token", http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/projects", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, rr.Code)
+			}
+		})
+	}
+}
+
+// TestAPIDisabledWithoutToken tests that the API is not served when api_token is empty
+func TestAPIDisabledWithoutToken(t *testing.T) {
+	handler, _, _ := newTestAPIHandler(t, `
+projects:
+  - name: Frontend
+    webhook_path: /hooks/frontend
+    webhook_secret: secret1
+    execute_command: echo frontend
+`)
+
+	rr := apiRequest(handler, "GET", "/api/projects")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 when API is disabled, got %d", rr.Code)
+	}
+}
+
+// TestAPIProjects tests listing projects with lock state and last run
+func TestAPIProjects(t *testing.T) {
+	handler, deployer, _ := newTestAPIHandler(t, testAPIConfig)
+	project := handler.configManager.GetProjectByName("Frontend")
+
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+
+	rr := apiRequest(handler, "GET", "/api/projects")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var body struct {
+		Projects []projectStatus `json:"projects"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Projects) != 2 {
+		t.Fatalf("Expected 2 projects, got %d", len(body.Projects))
+	}
+
+	frontend := body.Projects[0]
+	if frontend.Name != "Frontend" || frontend.Deploying {
+		t.Errorf("Unexpected frontend status: %+v", frontend)
+	}
+	if frontend.LastRun == nil || frontend.LastRun.RunID != result.RunID || frontend.LastRun.Status != "success" {
+		t.Errorf("Expected last run %s with status success, got %+v", result.RunID, frontend.LastRun)
+	}
+	if body.Projects[1].LastRun != nil {
+		t.Errorf("Expected no last run for backend, got %+v", body.Projects[1].LastRun)
+	}
+}
+
+// TestAPIProjectDeploying tests that a running deployment is reported as locked
+func TestAPIProjectDeploying(t *testing.T) {
+	handler, deployer, _ := newTestAPIHandler(t, testAPIConfig)
+	project := *handler.configManager.GetProjectByName("Backend")
+	project.ExecuteCommand = "sleep 0.5"
+
+	go deployer.Deploy(context.Background(), &project, "INTERNAL")
+	time.Sleep(100 * time.Millisecond)
+
+	if !deployer.IsDeploying(project.WebhookPath) {
+		t.Error("Expected IsDeploying to be true during deployment")
+	}
+
+	rr := apiRequest(handler, "GET", "/api/projects")
+	var body struct {
+		Projects []projectStatus `json:"projects"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !body.Projects[1].Deploying {
+		t.Error("Expected backend to be reported as deploying")
+	}
+	if body.Projects[1].CurrentRun == "" || deployer.Stream(body.Projects[1].CurrentRun) == nil {
+		t.Errorf("Expected backend to report its streamable current run, got %q", body.Projects[1].CurrentRun)
+	}
+
+	waitForIdle(t, deployer)
+	if deployer.IsDeploying(project.WebhookPath) {
+		t.Error("Expected IsDeploying to be false after deployment")
+	}
+}
+
+// TestAPIProjectRuns tests listing recent runs for a project
+func TestAPIProjectRuns(t *testing.T) {
+	handler, deployer, _ := newTestAPIHandler(t, testAPIConfig)
+	project := handler.configManager.GetProjectByName("Frontend")
+
+	for i := 0; i < 3; i++ {
+		deployer.Deploy(context.Background(), project, "INTERNAL")
+	}
+
+	rr := apiRequest(handler, "GET", "/api/projects/Frontend/runs?limit=2")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var body struct {
+		Runs []runView `json:"runs"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Runs) != 2 {
+		t.Errorf("Expected 2 runs with limit=2, got %d", len(body.Runs))
+	}
+
+	if rr := apiRequest(handler, "GET", "/api/projects/Unknown/runs"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown project, got %d", rr.Code)
+	}
+	if rr := apiRequest(handler, "GET", "/api/projects/Frontend/runs?limit=abc"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid limit, got %d", rr.Code)
+	}
+}
+
+// TestAPIRun tests fetching a single run by ID
+func TestAPIRun(t *testing.T) {
+	handler, deployer, _ := newTestAPIHandler(t, testAPIConfig)
+	project := handler.configManager.GetProjectByName("Backend")
+
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+
+	rr := apiRequest(handler, "GET", "/api/runs/"+result.RunID)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var run runView
+	if err := json.Unmarshal(rr.Body.Bytes(), &run); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if run.RunID != result.RunID || run.Project != "Backend" || run.Output == "" {
+		t.Errorf("Unexpected run: %+v", run)
+	}
+
+	if rr := apiRequest(handler, "GET", "/api/runs/20240115-100000-00000000"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown run, got %d", rr.Code)
+	}
+}
+
+// TestAPIReadOnly tests that mutating methods are rejected
+func TestAPIReadOnly(t *testing.T) {
+	handler, _, _ := newTestAPIHandler(t, testAPIConfig)
+
+	rr := apiRequest(handler, "POST", "/api/projects")
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for POST, got %d", rr.Code)
+	}
+}
+
+// TestAPICancel tests cancelling a running deployment through the API
+func TestAPICancel(t *testing.T) {
+	handler, deployer, _ := newTestAPIHandler(t, testAPIConfig)
+	project := *handler.configManager.GetProjectByName("Backend")
+	project.ExecuteCommand = "sleep 30"
+
+	if rr := apiRequest(handler, "POST", "/api/projects/Backend/cancel"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 without a running deployment, got %d", rr.Code)
+	}
+	if rr := apiRequest(handler, "POST", "/api/projects/Missing/cancel"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown project, got %d", rr.Code)
+	}
+
+	done := make(chan DeployResult, 1)
+	go func() { done <- deployer.Deploy(context.Background(), &project, "INTERNAL") }()
+	for i := 0; i < 100 && !deployer.IsDeploying(project.WebhookPath); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	// The run registers its cancel handle just after taking the project lock
+	time.Sleep(100 * time.Millisecond)
+
+	rr := apiRequest(handler, "POST", "/api/projects/Backend/cancel?by=bob")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	select {
+	case result := <-done:
+		if result.RunID != body["run_id"] || !result.Cancelled || result.CancelledBy != "bob" {
+			t.Errorf("Expected run %s cancelled by bob, got %+v", body["run_id"], result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected deployment to stop after cancel")
+	}
+}
+
+// TestTruncateUTF8 tests cutting strings without splitting multi-byte characters
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"bob", 64, "bob"},
+		{"abcdef", 3, "abc"},
+		{"aé", 2, "a"}, // é is two bytes
+		{"日本", 5, "日"}, // each is three bytes
+		{"日本", 6, "日本"},
+	}
+	for _, tc := range tests {
+		got := truncateUTF8(tc.in, tc.n)
+		if got != tc.want || !utf8.ValidString(got) {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tc.in, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import "strings"
+
+// matchBranch returns the first entry of the project's branches list matching
+// the branch, or nil. Only plain git ref names match.
+func (p *ProjectConfig) matchBranch(branch string) *BranchConfig {
+	if !isSafeRefName(branch) {
+		return nil
+	}
+	for i := range p.Branches {
+		if matchRefPattern(p.Branches[i].Pattern, branch) {
+			return &p.Branches[i]
+		}
+	}
+	return nil
+}
+
+// acceptsBranch reports whether a webhook for the branch deploys the project:
+// the branch matches an entry of branches, or equals git_branch without a branches list
+func (p *ProjectConfig) acceptsBranch(branch string) bool {
+	if len(p.Branches) == 0 {
+		return p.GitBranch == "" || branch == p.GitBranch
+	}
+	return p.matchBranch(branch) != nil
+}
+
+// branchDescription names the branches a project deploys for log messages
+func (p *ProjectConfig) branchDescription() string {
+	if len(p.Branches) == 0 {
+		return p.GitBranch
+	}
+	patterns := make([]string, len(p.Branches))
+	for i, entry := range p.Branches {
+		patterns[i] = entry.Pattern
+	}
+	return strings.Join(patterns, ", ")
+}
+
+// forBranch returns the project as deployed for the given branch: a copy with
+// git_branch set to the branch and the overrides of the matching branches entry.
+// Branches the project does not accept deploy git_branch; projects without a
+// branches list are returned unchanged.
+func (p *ProjectConfig) forBranch(branch string) *ProjectConfig {
+	if len(p.Branches) == 0 {
+		return p
+	}
+	if branch == "" || !p.acceptsBranch(branch) {
+		branch = p.GitBranch
+	}
+
+	resolved := *p
+	resolved.GitBranch = branch
+	entry := p.matchBranch(branch)
+	if entry == nil {
+		return &resolved
+	}
+
+	expand := strings.NewReplacer("{branch}", branch, "{branch_slug}", slugify(branch)).Replace
+	if entry.LocalPath != "" {
+		resolved.LocalPath = expand(entry.LocalPath)
+	}
+	if entry.ExecuteCommand != "" {
+		resolved.ExecuteCommand = expand(entry.ExecuteCommand)
+		resolved.Steps = nil
+	}
+	if len(entry.Env) > 0 {
+		resolved.branchEnv = make(map[string]string, len(entry.Env))
+		for key, value := range entry.Env {
+			resolved.branchEnv[key] = expand(value)
+		}
+	}
+	return &resolved
+}
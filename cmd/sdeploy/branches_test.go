@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProjectForBranch tests branch matching and the templated per-branch overrides
+func TestProjectForBranch(t *testing.T) {
+	project := &ProjectConfig{
+		Name:           "App",
+		GitBranch:      "main",
+		LocalPath:      "/srv/app",
+		ExecuteCommand: "make deploy",
+		Branches: []BranchConfig{
+			{Pattern: "main"},
+			{
+				Pattern:        "feature/*",
+				LocalPath:      "/srv/previews/{branch_slug}",
+				ExecuteCommand: "make preview BRANCH={branch}",
+				Env:            map[string]string{"PREVIEW_HOST": "{branch_slug}.preview.example.com"},
+			},
+			{Pattern: `^release-\d+$`, LocalPath: "/srv/releases/{branch}"},
+		},
+	}
+
+	tests := []struct {
+		branch   string
+		accepted bool
+		resolved string
+		path     string
+		command  string
+		env      string
+	}{
+		{"main", true, "main", "/srv/app", "make deploy", ""},
+		{"feature/login", true, "feature/login", "/srv/previews/feature-login", "make preview BRANCH=feature/login", "feature-login.preview.example.com"},
+		{"feature/Sign_Up", true, "feature/Sign_Up", "/srv/previews/feature-sign_up", "make preview BRANCH=feature/Sign_Up", "feature-sign_up.preview.example.com"},
+		{"release-42", true, "release-42", "/srv/releases/release-42", "make deploy", ""},
+		{"feature/a/b", false, "main", "/srv/app", "make deploy", ""},
+		{"feature/$(id)", false, "main", "/srv/app", "make deploy", ""},
+		{"", false, "main", "/srv/app", "make deploy", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.branch, func(t *testing.T) {
+			if got := project.acceptsBranch(tc.branch); got != tc.accepted {
+				t.Errorf("acceptsBranch(%q) = %t, expected %t", tc.branch, got, tc.accepted)
+			}
+			resolved := project.forBranch(tc.branch)
+			if resolved.GitBranch != tc.resolved || resolved.LocalPath != tc.path || resolved.ExecuteCommand != tc.command || resolved.branchEnv["PREVIEW_HOST"] != tc.env {
+				t.Errorf("Expected branch=%q path=%q command=%q env=%q, got branch=%q path=%q command=%q env=%q",
+					tc.resolved, tc.path, tc.command, tc.env, resolved.GitBranch, resolved.LocalPath, resolved.ExecuteCommand, resolved.branchEnv["PREVIEW_HOST"])
+			}
+		})
+	}
+
+	// The configured project is never modified
+	if project.GitBranch != "main" || project.LocalPath != "/srv/app" || project.branchEnv != nil {
+		t.Errorf("Expected project to be unchanged, got %+v", project)
+	}
+
+	// Projects without a branches list accept git_branch only
+	single := &ProjectConfig{GitBranch: "main"}
+	if !single.acceptsBranch("main") || single.acceptsBranch("dev") || single.forBranch("dev") != single {
+		t.Error("Expected a project without branches to deploy git_branch only, unchanged")
+	}
+}
+
+// TestDeployBranchOverrides tests that a branch deployment builds in the
+// templated local_path with the branch env
+func TestDeployBranchOverrides(t *testing.T) {
+	previews := t.TempDir()
+	project := &ProjectConfig{
+		Name:           "App",
+		WebhookPath:    "/hooks/app",
+		GitBranch:      "main",
+		ExecuteCommand: "echo main",
+		Branches: []BranchConfig{
+			{
+				Pattern:        "feature/*",
+				LocalPath:      filepath.Join(previews, "{branch_slug}"),
+				ExecuteCommand: "pwd && echo \"$SDEPLOY_GIT_BRANCH $PREVIEW_HOST\"",
+				Env:            map[string]string{"PREVIEW_HOST": "{branch_slug}.preview.example.com"},
+			},
+		},
+	}
+
+	deployer := NewDeployer(nil)
+	result := deployer.Deploy(context.Background(), project.forBranch("feature/login"), "WEBHOOK")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+	}
+	if result.Branch != "feature/login" {
+		t.Errorf("Expected recorded branch feature/login, got %q", result.Branch)
+	}
+	expected := filepath.Join(previews, "feature-login") + "\nfeature/login feature-login.preview.example.com"
+	if !strings.Contains(result.Output, expected) {
+		t.Errorf("Expected output %q, got: %s", expected, result.Output)
+	}
+}
+
+// TestWebhookBranches tests that webhooks deploy branches matching the branches list
+func TestWebhookBranches(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "App",
+				WebhookPath:    "/hooks/app",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+				Branches:       []BranchConfig{{Pattern: "main"}, {Pattern: "feature/*"}},
+			},
+		},
+	}
+	handler := NewWebhookHandler(cfg, nil)
+
+	tests := []struct {
+		ref  string
+		body string
+	}{
+		{"refs/heads/main", "Accepted"},
+		{"refs/heads/feature/login", "Accepted"},
+		{"refs/heads/dev", "Accepted (branch mismatch, skipped)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.ref, func(t *testing.T) {
+			payload := `{"ref":"` + tc.ref + `"}`
+			req := httptest.NewRequest("POST", "/hooks/app", strings.NewReader(payload))
+			req.Header.Set("X-Hub-Signature-256", "sha256="+hexHMAC(payload, "mysecret"))
+			req.Header.Set("X-GitHub-Event", "push")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusAccepted || rr.Body.String() != tc.body {
+				t.Errorf("Expected 202 %q, got %d %q", tc.body, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestDeployBranchesLockPerDirectory tests that branches deploying into their
+// own local_path run concurrently, while runs of the same branch directory
+// still follow on_busy
+func TestDeployBranchesLockPerDirectory(t *testing.T) {
+	previews := t.TempDir()
+	project := &ProjectConfig{
+		Name:           "App",
+		WebhookPath:    "/hooks/app",
+		GitBranch:      "main",
+		ExecuteCommand: "sleep 0.5",
+		Branches:       []BranchConfig{{Pattern: "feature/*", LocalPath: filepath.Join(previews, "{branch_slug}")}},
+	}
+	deployer := NewDeployer(nil)
+
+	done := make(chan DeployResult, 1)
+	go func() { done <- deployer.Deploy(context.Background(), project.forBranch("feature/a"), "WEBHOOK") }()
+	for i := 0; i < 100 && !deployer.IsDeploying(project.WebhookPath); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if result := deployer.Deploy(context.Background(), project.forBranch("feature/a"), "WEBHOOK"); !result.Skipped {
+		t.Errorf("Expected a second feature/a run to be skipped, got %+v", result)
+	}
+	if result := deployer.Deploy(context.Background(), project.forBranch("feature/b"), "WEBHOOK"); !result.Success {
+		t.Errorf("Expected feature/b to deploy while feature/a runs, got %+v", result)
+	}
+	if result := <-done; !result.Success {
+		t.Errorf("Expected feature/a to succeed, got %+v", result)
+	}
+
+	// Finished branches leave no lock behind
+	waitForIdle(t, deployer)
+	deployer.locksMu.Lock()
+	defer deployer.locksMu.Unlock()
+	if len(deployer.locks) != 0 || len(deployer.pending) != 0 {
+		t.Errorf("Expected no locks or pending entries once idle, got %d locks and %d pending", len(deployer.locks), len(deployer.pending))
+	}
+}
+
+// TestDeployBranchesSharedLocalPath tests that branches sharing a local_path
+// check out the pushed branch before pulling, including branches created after the clone
+func TestDeployBranchesSharedLocalPath(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	pushTestCommit(t, work, "main")
+	runGit(t, work, "checkout", "-b", "feature/a")
+	pushTestCommit(t, work, "a1")
+	runGit(t, work, "push", "origin", "feature/a")
+
+	project := &ProjectConfig{
+		Name:           "App",
+		WebhookPath:    "/hooks/app",
+		GitRepo:        origin,
+		GitBranch:      "main",
+		GitUpdate:      true,
+		GitStrategy:    GitStrategyPull,
+		LocalPath:      filepath.Join(t.TempDir(), "app"),
+		ExecuteCommand: "cat VERSION",
+		Branches:       []BranchConfig{{Pattern: "feature/*"}},
+	}
+	deployer := NewDeployer(nil)
+
+	deploy := func(branch, expected string) {
+		t.Helper()
+		result := deployer.Deploy(context.Background(), project.forBranch(branch), "WEBHOOK")
+		if !result.Success {
+			t.Fatalf("Expected %s to deploy, got error: %s (output: %s)", branch, result.Error, result.Output)
+		}
+		if !strings.Contains(result.Output, expected) {
+			t.Errorf("Expected %s to deploy %q, got output: %s", branch, expected, result.Output)
+		}
+	}
+
+	deploy("feature/a", "a1")
+
+	runGit(t, work, "checkout", "-b", "feature/b", "main")
+	pushTestCommit(t, work, "b1")
+	runGit(t, work, "push", "origin", "feature/b")
+	deploy("feature/b", "b1")
+
+	runGit(t, work, "checkout", "feature/a")
+	pushTestCommit(t, work, "a2")
+	runGit(t, work, "push", "origin", "feature/a")
+	deploy("feature/a", "a2")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/user"
+	"time"
+)
+
+// cliAPITimeout bounds CLI requests to the running daemon
+const cliAPITimeout = 10 * time.Second
+
+// runSubcommand runs a CLI command (e.g., rollback) against the loaded config
+// and returns the process exit code
+func runSubcommand(cfg *Config, args []string, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "rollback":
+		return runRollback(cfg, args[1:], stdout, stderr)
+	case "cancel":
+		return runCancel(cfg, args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "Error: unknown command %q (run sdeploy -h for usage)\n", args[0])
+		return 2
+	}
+}
+
+// runRollback repoints a project's "current" release to the previous release
+func runRollback(cfg *Config, args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "Usage: sdeploy [-c <path>] rollback <project>")
+		return 2
+	}
+
+	project := findProject(cfg, args[0])
+	if project == nil {
+		fmt.Fprintf(stderr, "Error: project %q not found in config\n", args[0])
+		return 1
+	}
+
+	from, to, err := rollbackRelease(cfg.StateDir, project)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: rollback failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "Rolled back %s: %s -> %s\n", project.Name, from, to)
+	return 0
+}
+
+// runCancel asks the running daemon, through its API on listen_port, to
+// cancel a project's running deployment
+func runCancel(cfg *Config, args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "Usage: sdeploy [-c <path>] cancel <project>")
+		return 2
+	}
+
+	project := findProject(cfg, args[0])
+	if project == nil {
+		fmt.Fprintf(stderr, "Error: project %q not found in config\n", args[0])
+		return 1
+	}
+	if cfg.APIToken == "" {
+		fmt.Fprintln(stderr, "Error: cancel requires api_token to be set in the config")
+		return 1
+	}
+
+	by := "cli"
+	if u, err := user.Current(); err == nil {
+		by = "cli:" + u.Username
+	}
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d%sprojects/%s/cancel?by=%s",
+		cfg.ListenPort, APIPathPrefix, url.PathEscape(project.Name), url.QueryEscape(by))
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.APIToken)
+
+	client := &http.Client{Timeout: cliAPITimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: failed to reach sdeploy on port %d: %v\n", cfg.ListenPort, err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		RunID string `json:"run_id"`
+		Error string `json:"error"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+
+	if resp.StatusCode != http.StatusAccepted {
+		if body.Error == "" {
+			body.Error = resp.Status
+		}
+		fmt.Fprintf(stderr, "Error: cancel failed: %s\n", body.Error)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "Cancelled %s: run %s\n", project.Name, body.RunID)
+	return 0
+}
+
+// findProject returns the project with the given name, or nil if none matches
+func findProject(cfg *Config, name string) *ProjectConfig {
+	for i := range cfg.Projects {
+		if cfg.Projects[i].Name == name {
+			return &cfg.Projects[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRunSubcommandRollback tests the rollback CLI command
+func TestRunSubcommandRollback(t *testing.T) {
+	cfg := &Config{
+		StateDir: t.TempDir(),
+		Projects: []ProjectConfig{
+			{Name: "Frontend", ReleaseMode: true, LocalPath: t.TempDir()},
+		},
+	}
+	project := &cfg.Projects[0]
+	for _, name := range []string{"20240115-100000-aaaaaaa", "20240115-110000-bbbbbbb"} {
+		if err := os.MkdirAll(filepath.Join(releasesPath(project), name), 0755); err != nil {
+			t.Fatalf("Failed to create release: %v", err)
+		}
+	}
+	if err := activateRelease(project, filepath.Join(releasesPath(project), "20240115-110000-bbbbbbb")); err != nil {
+		t.Fatalf("activateRelease failed: %v", err)
+	}
+
+	// Refused while the daemon deploys the project
+	unlock, err := lockReleases(cfg.StateDir, project, true)
+	if err != nil {
+		t.Fatalf("lockReleases failed: %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := runSubcommand(cfg, []string{"rollback", "Frontend"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "in progress") {
+		t.Errorf("Expected rollback to be refused during a deployment, got %d (stderr: %s)", code, stderr.String())
+	}
+	unlock()
+	if currentRelease(project) != "20240115-110000-bbbbbbb" {
+		t.Errorf("Expected current release to be unchanged, got %s", currentRelease(project))
+	}
+
+	stderr.Reset()
+	if code := runSubcommand(cfg, []string{"rollback", "Frontend"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "20240115-110000-bbbbbbb -> 20240115-100000-aaaaaaa") {
+		t.Errorf("Expected rollback summary, got: %s", stdout.String())
+	}
+	if currentRelease(project) != "20240115-100000-aaaaaaa" {
+		t.Errorf("Expected current release to be rolled back, got %s", currentRelease(project))
+	}
+
+	// Nothing older left
+	stderr.Reset()
+	if code := runSubcommand(cfg, []string{"rollback", "Frontend"}, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1, got %d", code)
+	}
+}
+
+// TestRunSubcommandErrors tests CLI usage errors
+func TestRunSubcommandErrors(t *testing.T) {
+	cfg := &Config{Projects: []ProjectConfig{{Name: "Frontend"}}}
+
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		contains string
+	}{
+		{"unknown command", []string{"deploy"}, 2, "unknown command"},
+		{"missing project", []string{"rollback"}, 2, "Usage"},
+		{"unknown project", []string{"rollback", "Backend"}, 1, "not found"},
+		{"release_mode disabled", []string{"rollback", "Frontend"}, 1, "release_mode"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runSubcommand(cfg, tc.args, &stdout, &stderr); code != tc.code {
+				t.Errorf("Expected exit code %d, got %d", tc.code, code)
+			}
+			if !strings.Contains(stderr.String(), tc.contains) {
+				t.Errorf("Expected stderr to contain %q, got: %s", tc.contains, stderr.String())
+			}
+		})
+	}
+}
+
+// TestRunSubcommandCancel tests that the cancel CLI command calls the daemon's API
+func TestRunSubcommandCancel(t *testing.T) {
+	handler, deployer, _ := newTestAPIHandler(t, testAPIConfig)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	port, _ := strconv.Atoi(server.URL[strings.LastIndex(server.URL, ":")+1:])
+
+	cfg := handler.configManager.GetConfig()
+	cliCfg := *cfg
+	cliCfg.ListenPort = port
+
+	var stdout, stderr bytes.Buffer
+	if code := runSubcommand(&cliCfg, []string{"cancel", "Backend"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "no deployment is running") {
+		t.Errorf("Expected failure without a running deployment, got %d: %s", code, stderr.String())
+	}
+
+	project := *handler.configManager.GetProjectByName("Backend")
+	project.ExecuteCommand = "sleep 30"
+	done := make(chan DeployResult, 1)
+	go func() { done <- deployer.Deploy(context.Background(), &project, "INTERNAL") }()
+	for i := 0; i < 100 && !deployer.IsDeploying(project.WebhookPath); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := runSubcommand(&cliCfg, []string{"cancel", "Backend"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	result := <-done
+	if !strings.Contains(stdout.String(), "Cancelled Backend: run "+result.RunID) {
+		t.Errorf("Expected cancel summary, got: %s", stdout.String())
+	}
+	if !result.Cancelled || !strings.HasPrefix(result.CancelledBy, "cli") {
+		t.Errorf("Expected run cancelled by the CLI, got %+v", result)
+	}
+
+	// Without api_token the daemon cannot be reached
+	cliCfg.APIToken = ""
+	stderr.Reset()
+	if code := runSubcommand(&cliCfg, []string{"cancel", "Backend"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "api_token") {
+		t.Errorf("Expected api_token error, got %d: %s", code, stderr.String())
+	}
+}
@@ -3,6 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,15 +15,75 @@ import (
 // Defaults holds all default configuration values in a single struct
 // Access via: Defaults.Port, Defaults.LogPath, etc.
 var Defaults = struct {
-	Port      int
-	LogPath   string
-	GitBranch string
+	Port               int
+	LogPath            string
+	LogFormat          string
+	LogMaxBackups      int
+	GitBranch          string
+	OnBusy             string
+	QueueSize          int
+	GitStrategy        string
+	KeepReleases       int
+	HealthStatus       int
+	HealthRetries      int
+	HealthInterval     int
+	HealthTimeout      int
+	StateDir           string
+	HistoryLimit       int
+	HistoryOutputLimit int
+	RunLogKeep         int
+	APIRunsLimit       int
+	StreamBacklog      int
+	KillGraceSeconds   int
+	ShutdownTimeout    int
+	DeliveryIDKeep     int
+	TriggerMaxSkew     int
+	Events             []string
+	MetricsPath        string
 }{
-	Port:      8080,
-	LogPath:   "/var/log/sdeploy.log",
-	GitBranch: "main",
+	Port:               8080,
+	LogPath:            "/var/log/sdeploy.log",
+	LogFormat:          LogFormatText,
+	LogMaxBackups:      5,
+	GitBranch:          "main",
+	OnBusy:             OnBusySkip,
+	QueueSize:          5,
+	GitStrategy:        GitStrategyPull,
+	KeepReleases:       5,
+	HealthStatus:       200,
+	HealthRetries:      3,
+	HealthInterval:     5,
+	HealthTimeout:      10,
+	StateDir:           "/var/lib/sdeploy",
+	HistoryLimit:       50,
+	HistoryOutputLimit: 64 * 1024,
+	RunLogKeep:         20,
+	APIRunsLimit:       20,
+	StreamBacklog:      1000,
+	KillGraceSeconds:   10,
+	ShutdownTimeout:    60,
+	DeliveryIDKeep:     1000,
+	TriggerMaxSkew:     300,
+	Events:             []string{EventPush},
+	MetricsPath:        "/metrics",
 }
 
+// Git update strategies used when git_update is enabled
+const (
+	GitStrategyPull       = "pull"        // git pull on the checked-out branch
+	GitStrategyFetchReset = "fetch_reset" // git fetch + git reset --hard to the webhook commit
+)
+
+// APIPathPrefix is the URL prefix reserved for the status and history API
+const APIPathPrefix = "/api/"
+
+// On-busy policies applied when a webhook arrives while a deployment is running
+const (
+	OnBusySkip     = "skip"
+	OnBusyQueue    = "queue"
+	OnBusyCoalesce = "coalesce"
+)
+
 // ConfigSearchPaths defines the search order for config files
 var ConfigSearchPaths = []string{
 	"/etc/sdeploy.conf",
@@ -34,28 +99,140 @@ type EmailConfig struct {
 	EmailSender string `yaml:"email_sender"`
 }
 
+// DeployStep is a single command of a multi-step deployment pipeline
+type DeployStep struct {
+	Name            string            `yaml:"name"`
+	Command         string            `yaml:"command"`
+	ExecutePath     string            `yaml:"execute_path"`      // Relative paths resolve against the project's execute_path
+	TimeoutSeconds  int               `yaml:"timeout_seconds"`   // Defaults to the project's timeout_seconds
+	ContinueOnError bool              `yaml:"continue_on_error"` // A failure is reported but does not stop the pipeline
+	Env             map[string]string `yaml:"env"`
+}
+
+// BranchConfig is an entry of a project's branches list. Pushes to branches
+// matching Pattern deploy, with the optional overrides below. Overrides may
+// use the {branch} and {branch_slug} placeholders (e.g., feature/login and
+// feature-login).
+type BranchConfig struct {
+	Pattern        string            `yaml:"pattern"` // Branch name, glob, or regular expression when it starts with ^
+	LocalPath      string            `yaml:"local_path"`
+	ExecuteCommand string            `yaml:"execute_command"` // Replaces the project's execute_command or steps
+	Env            map[string]string `yaml:"env"`             // Extra environment variables for commands and hooks
+}
+
+// DeployHooks holds shell commands run around the deployment command
+type DeployHooks struct {
+	PreDeploy         string `yaml:"pre_deploy"`          // Before the build; a failure fails the deployment
+	PostDeploySuccess string `yaml:"post_deploy_success"` // After a successful deployment
+	PostDeployFailure string `yaml:"post_deploy_failure"` // After a failed deployment
+	Always            string `yaml:"always"`              // After every deployment, last
+}
+
+// HealthCheck configures the HTTP check polled after a successful deployment
+type HealthCheck struct {
+	URL             string `yaml:"url"`
+	ExpectedStatus  int    `yaml:"expected_status"`
+	BodyContains    string `yaml:"body_contains"`
+	Retries         int    `yaml:"retries"`          // Attempts after the first failure
+	IntervalSeconds int    `yaml:"interval_seconds"` // Wait between attempts
+	TimeoutSeconds  int    `yaml:"timeout_seconds"`  // Per-request timeout
+}
+
+// UnmarshalYAML defaults retries before decoding, so only an absent key gets
+// Defaults.HealthRetries and retries: 0 checks once
+func (hc *HealthCheck) UnmarshalYAML(value *yaml.Node) error {
+	type plain HealthCheck
+	decoded := plain{Retries: Defaults.HealthRetries}
+	if err := value.Decode(&decoded); err != nil {
+		return err
+	}
+	*hc = HealthCheck(decoded)
+	return nil
+}
+
 // ProjectConfig holds configuration for a single project
 type ProjectConfig struct {
-	Name            string   `yaml:"name"`
-	WebhookPath     string   `yaml:"webhook_path"`
-	WebhookSecret   string   `yaml:"webhook_secret"`
-	GitRepo         string   `yaml:"git_repo"`
-	LocalPath       string   `yaml:"local_path"`
-	ExecutePath     string   `yaml:"execute_path"`
-	GitBranch       string   `yaml:"git_branch"`
-	ExecuteCommand  string   `yaml:"execute_command"`
-	GitUpdate       bool     `yaml:"git_update"`
-	GitSSHKeyPath   string   `yaml:"git_ssh_key_path"`
-	TimeoutSeconds  int      `yaml:"timeout_seconds"`
-	EmailRecipients []string `yaml:"email_recipients"`
+	Name                 string         `yaml:"name"`
+	WebhookPath          string         `yaml:"webhook_path"`
+	WebhookSecret        string         `yaml:"webhook_secret"`
+	GitRepo              string         `yaml:"git_repo"`
+	LocalPath            string         `yaml:"local_path"`
+	ExecutePath          string         `yaml:"execute_path"`
+	GitBranch            string         `yaml:"git_branch"`
+	Branches             []BranchConfig `yaml:"branches"`
+	ExecuteCommand       string         `yaml:"execute_command"`
+	Steps                []DeployStep   `yaml:"steps"`
+	Hooks                DeployHooks    `yaml:"hooks"`
+	HealthCheck          *HealthCheck   `yaml:"health_check"`
+	RollbackCommand      string         `yaml:"rollback_command"`
+	GitUpdate            bool           `yaml:"git_update"`
+	GitStrategy          string         `yaml:"git_strategy"`
+	ReleaseMode          bool           `yaml:"release_mode"`
+	KeepReleases         int            `yaml:"keep_releases"`
+	GitSSHKeyPath        string         `yaml:"git_ssh_key_path"`
+	TimeoutSeconds       int            `yaml:"timeout_seconds"`
+	KillGraceSeconds     *int           `yaml:"kill_grace_seconds"` // nil inherits the global setting; 0 kills at once
+	OnBusy               string         `yaml:"on_busy"`
+	QueueSize            int            `yaml:"queue_size"`
+	HistoryLimit         int            `yaml:"history_limit"`
+	RunLogKeep           int            `yaml:"run_log_keep"`
+	RunLogMaxAge         int            `yaml:"run_log_max_age_days"`
+	RequireSignedTrigger bool           `yaml:"require_signed_trigger"`
+	Events               []string       `yaml:"events"`
+	GitTagPattern        string         `yaml:"git_tag_pattern"`
+	IncludePaths         []string       `yaml:"include_paths"`
+	ExcludePaths         []string       `yaml:"exclude_paths"`
+	EmailRecipients      []string       `yaml:"email_recipients"`
+
+	branchEnv map[string]string // Env of the matching branches entry, set by forBranch
+}
+
+// killGrace returns the time between SIGTERM and SIGKILL when stopping a
+// command; 0 sends SIGKILL at once. Unset means Defaults.KillGraceSeconds.
+func (p *ProjectConfig) killGrace() time.Duration {
+	grace := Defaults.KillGraceSeconds
+	if p.KillGraceSeconds != nil {
+		grace = *p.KillGraceSeconds
+	}
+	return time.Duration(grace) * time.Second
 }
 
 // Config holds the complete SDeploy configuration
 type Config struct {
-	ListenPort  int             `yaml:"listen_port"`
-	LogFilepath string          `yaml:"log_filepath"`
-	EmailConfig *EmailConfig    `yaml:"email_config"`
-	Projects    []ProjectConfig `yaml:"projects"`
+	ListenPort       int             `yaml:"listen_port"`
+	LogFilepath      string          `yaml:"log_filepath"`
+	LogFormat        string          `yaml:"log_format"`
+	LogMaxSizeMB     int             `yaml:"log_max_size_mb"`
+	LogMaxBackups    int             `yaml:"log_max_backups"`
+	LogMaxAgeDays    int             `yaml:"log_max_age_days"`
+	LogCompress      bool            `yaml:"log_compress"`
+	LogPayloads      bool            `yaml:"log_payloads"`
+	RedactEnv        []string        `yaml:"redact_env"`
+	RedactPatterns   []string        `yaml:"redact_patterns"`
+	StateDir         string          `yaml:"state_dir"`
+	HistoryLimit     int             `yaml:"history_limit"`
+	RunLogs          bool            `yaml:"run_logs"`
+	RunLogKeep       int             `yaml:"run_log_keep"`
+	RunLogMaxAge     int             `yaml:"run_log_max_age_days"`
+	KillGraceSeconds *int            `yaml:"kill_grace_seconds"` // nil means Defaults.KillGraceSeconds; 0 kills at once
+	ShutdownTimeout  int             `yaml:"shutdown_timeout_seconds"`
+	DeliveryIDKeep   int             `yaml:"delivery_id_keep"`
+	TriggerMaxSkew   int             `yaml:"trigger_max_skew_seconds"`
+	APIToken         string          `yaml:"api_token"`
+	MetricsPath      string          `yaml:"metrics_path"`
+	MetricsPort      int             `yaml:"metrics_port"`
+	EmailConfig      *EmailConfig    `yaml:"email_config"`
+	Projects         []ProjectConfig `yaml:"projects"`
+}
+
+// LogRotation returns the log rotation policy configured by the log_* settings
+func (cfg *Config) LogRotation() LogRotation {
+	return LogRotation{
+		MaxSizeMB:  cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
+		MaxAgeDays: cfg.LogMaxAgeDays,
+		Compress:   cfg.LogCompress,
+	}
 }
 
 // LoadConfig loads and validates a configuration from the specified file path
@@ -75,6 +252,21 @@ func LoadConfig(path string) (*Config, error) {
 		cfg.ListenPort = Defaults.Port
 	}
 
+	// Set default log file path if not specified in config
+	if cfg.LogFilepath == "" {
+		cfg.LogFilepath = Defaults.LogPath
+	}
+
+	// Set default log format if not specified in config
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = Defaults.LogFormat
+	}
+
+	// Set default state directory if not specified in config
+	if cfg.StateDir == "" {
+		cfg.StateDir = Defaults.StateDir
+	}
+
 	// Validate the configuration
 	if err := validateConfig(&cfg); err != nil {
 		return nil, err
@@ -87,6 +279,100 @@ func LoadConfig(path string) (*Config, error) {
 func validateConfig(cfg *Config) error {
 	// Check for at least one project (optional, but need to validate projects if present)
 	webhookPaths := make(map[string]bool)
+	projectKeys := make(map[string]string)
+
+	// Default global history_limit to Defaults.HistoryLimit if not set
+	if cfg.HistoryLimit < 0 {
+		return fmt.Errorf("history_limit must not be negative")
+	}
+	if cfg.HistoryLimit == 0 {
+		cfg.HistoryLimit = Defaults.HistoryLimit
+	}
+
+	// Default global run_log_keep to Defaults.RunLogKeep if not set
+	if cfg.RunLogKeep < 0 || cfg.RunLogMaxAge < 0 {
+		return fmt.Errorf("run_log_keep and run_log_max_age_days must not be negative")
+	}
+	if cfg.RunLogKeep == 0 {
+		cfg.RunLogKeep = Defaults.RunLogKeep
+	}
+
+	// Default global kill_grace_seconds to Defaults.KillGraceSeconds if not set.
+	// An explicit 0 sends SIGKILL without a grace period.
+	if cfg.KillGraceSeconds != nil && *cfg.KillGraceSeconds < 0 {
+		return fmt.Errorf("kill_grace_seconds must not be negative")
+	}
+	if cfg.KillGraceSeconds == nil {
+		grace := Defaults.KillGraceSeconds
+		cfg.KillGraceSeconds = &grace
+	}
+
+	// Default shutdown_timeout_seconds to Defaults.ShutdownTimeout if not set
+	if cfg.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown_timeout_seconds must not be negative")
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = Defaults.ShutdownTimeout
+	}
+
+	// Default replay protection settings from Defaults if not set
+	if cfg.DeliveryIDKeep < 0 {
+		return fmt.Errorf("delivery_id_keep must not be negative")
+	}
+	if cfg.DeliveryIDKeep == 0 {
+		cfg.DeliveryIDKeep = Defaults.DeliveryIDKeep
+	}
+	if cfg.TriggerMaxSkew < 0 {
+		return fmt.Errorf("trigger_max_skew_seconds must not be negative")
+	}
+	if cfg.TriggerMaxSkew == 0 {
+		cfg.TriggerMaxSkew = Defaults.TriggerMaxSkew
+	}
+
+	if cfg.LogFormat != LogFormatText && cfg.LogFormat != LogFormatJSON {
+		return fmt.Errorf("invalid log_format %q (must be %s or %s)", cfg.LogFormat, LogFormatText, LogFormatJSON)
+	}
+
+	// Log rotation is disabled unless log_max_size_mb is set
+	if cfg.LogMaxSizeMB < 0 || cfg.LogMaxBackups < 0 || cfg.LogMaxAgeDays < 0 {
+		return fmt.Errorf("log_max_size_mb, log_max_backups and log_max_age_days must not be negative")
+	}
+	if cfg.LogMaxBackups == 0 {
+		cfg.LogMaxBackups = Defaults.LogMaxBackups
+	}
+
+	// Metrics are enabled by metrics_path, metrics_port, or both
+	if cfg.MetricsPort < 0 {
+		return fmt.Errorf("metrics_port must not be negative")
+	}
+	if cfg.MetricsPort != 0 && cfg.MetricsPort == cfg.ListenPort {
+		return fmt.Errorf("metrics_port must differ from listen_port")
+	}
+	if cfg.MetricsPort != 0 && cfg.MetricsPath == "" {
+		cfg.MetricsPath = Defaults.MetricsPath
+	}
+	if cfg.MetricsPath != "" {
+		if !strings.HasPrefix(cfg.MetricsPath, "/") {
+			return fmt.Errorf("metrics_path must start with /")
+		}
+		if strings.HasPrefix(cfg.MetricsPath, APIPathPrefix) {
+			return fmt.Errorf("metrics_path must not start with %s", APIPathPrefix)
+		}
+		if cfg.MetricsPath == HealthzPath || cfg.MetricsPath == ReadyzPath {
+			return fmt.Errorf("metrics_path must not be %s (reserved)", cfg.MetricsPath)
+		}
+	}
+
+	// Patterns are compiled again by the redactor; reject invalid ones here
+	for _, expr := range cfg.RedactPatterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid redact_patterns entry %q: %v", expr, err)
+		}
+		if re.MatchString("") {
+			return fmt.Errorf("invalid redact_patterns entry %q: must not match empty text", expr)
+		}
+	}
 
 	// Note: Using pointer to project (not range value) to allow modification of slice elements
 	for i := range cfg.Projects {
@@ -101,9 +387,38 @@ func validateConfig(cfg *Config) error {
 			return fmt.Errorf("project %d (%s): webhook_secret is required", i+1, project.Name)
 		}
 
-		if project.ExecuteCommand == "" {
+		if project.ExecuteCommand == "" && len(project.Steps) == 0 {
 			return fmt.Errorf("project %d (%s): execute_command is required", i+1, project.Name)
 		}
+		if project.ExecuteCommand != "" && len(project.Steps) > 0 {
+			return fmt.Errorf("project %d (%s): execute_command and steps are mutually exclusive", i+1, project.Name)
+		}
+		for j := range project.Steps {
+			step := &project.Steps[j]
+			if step.Command == "" {
+				return fmt.Errorf("project %d (%s): step %d: command is required", i+1, project.Name, j+1)
+			}
+			if step.TimeoutSeconds < 0 {
+				return fmt.Errorf("project %d (%s): step %d: timeout_seconds must not be negative", i+1, project.Name, j+1)
+			}
+			// Default step name to its position
+			if step.Name == "" {
+				step.Name = fmt.Sprintf("step %d", j+1)
+			}
+		}
+
+		// Webhook paths must not shadow the API or the probe endpoints
+		if strings.HasPrefix(project.WebhookPath, APIPathPrefix) {
+			return fmt.Errorf("project %d (%s): webhook_path must not start with %s", i+1, project.Name, APIPathPrefix)
+		}
+		if project.WebhookPath == HealthzPath || project.WebhookPath == ReadyzPath {
+			return fmt.Errorf("project %d (%s): webhook_path must not be %s (reserved)", i+1, project.Name, project.WebhookPath)
+		}
+
+		// Webhook paths must not shadow metrics served on the listen port
+		if cfg.MetricsPath != "" && cfg.MetricsPort == 0 && project.WebhookPath == cfg.MetricsPath {
+			return fmt.Errorf("project %d (%s): webhook_path must not equal metrics_path", i+1, project.Name)
+		}
 
 		// Check for duplicate webhook paths
 		if webhookPaths[project.WebhookPath] {
@@ -111,11 +426,149 @@ func validateConfig(cfg *Config) error {
 		}
 		webhookPaths[project.WebhookPath] = true
 
+		// History, run logs and delivery IDs are stored under the slugified name,
+		// so names must stay distinct once slugified (e.g., "Web App" and "web-app")
+		key := projectKey(project)
+		if other, ok := projectKeys[key]; ok {
+			return fmt.Errorf("project %d (%s): name collides with project %q (both are stored as %q)", i+1, project.Name, other, key)
+		}
+		projectKeys[key] = project.Name
+
 		// Default git_branch to Defaults.GitBranch if not set
 		if project.GitBranch == "" {
 			project.GitBranch = Defaults.GitBranch
 		}
 
+		// Validate branches patterns (regex when they start with ^, glob otherwise)
+		for j, entry := range project.Branches {
+			if entry.Pattern == "" {
+				return fmt.Errorf("project %d (%s): branches entry %d: pattern is required", i+1, project.Name, j+1)
+			}
+			if err := validateRefPattern(entry.Pattern); err != nil {
+				return fmt.Errorf("project %d (%s): branches entry %d: %v", i+1, project.Name, j+1, err)
+			}
+		}
+
+		// Default git_strategy to Defaults.GitStrategy if not set
+		switch project.GitStrategy {
+		case "":
+			project.GitStrategy = Defaults.GitStrategy
+		case GitStrategyPull, GitStrategyFetchReset:
+		default:
+			return fmt.Errorf("project %d (%s): git_strategy must be one of %s, %s", i+1, project.Name, GitStrategyPull, GitStrategyFetchReset)
+		}
+
+		// release_mode builds each deployment in its own directory under local_path
+		if project.ReleaseMode {
+			if project.GitRepo == "" || project.LocalPath == "" {
+				return fmt.Errorf("project %d (%s): release_mode requires git_repo and local_path", i+1, project.Name)
+			}
+			if filepath.IsAbs(project.ExecutePath) {
+				return fmt.Errorf("project %d (%s): execute_path must be relative to the release directory when release_mode is enabled", i+1, project.Name)
+			}
+		}
+
+		// Default keep_releases to Defaults.KeepReleases if not set
+		if project.KeepReleases < 0 {
+			return fmt.Errorf("project %d (%s): keep_releases must not be negative", i+1, project.Name)
+		}
+		if project.KeepReleases == 0 {
+			project.KeepReleases = Defaults.KeepReleases
+		}
+
+		// Default on_busy to Defaults.OnBusy if not set
+		switch project.OnBusy {
+		case "":
+			project.OnBusy = Defaults.OnBusy
+		case OnBusySkip, OnBusyQueue, OnBusyCoalesce:
+		default:
+			return fmt.Errorf("project %d (%s): on_busy must be one of %s, %s, %s", i+1, project.Name, OnBusySkip, OnBusyQueue, OnBusyCoalesce)
+		}
+
+		// Validate git_tag_pattern (regex when it starts with ^, glob otherwise)
+		if project.GitTagPattern != "" {
+			if err := validateRefPattern(project.GitTagPattern); err != nil {
+				return fmt.Errorf("project %d (%s): git_tag_pattern: %v", i+1, project.Name, err)
+			}
+		}
+
+		// Validate include_paths and exclude_paths globs
+		for _, pattern := range project.IncludePaths {
+			if err := validatePathGlob(pattern); err != nil {
+				return fmt.Errorf("project %d (%s): include_paths: %v", i+1, project.Name, err)
+			}
+		}
+		for _, pattern := range project.ExcludePaths {
+			if err := validatePathGlob(pattern); err != nil {
+				return fmt.Errorf("project %d (%s): exclude_paths: %v", i+1, project.Name, err)
+			}
+		}
+
+		// Default events to Defaults.Events, or to tag events with git_tag_pattern
+		if len(project.Events) == 0 {
+			project.Events = append([]string(nil), defaultEvents(project)...)
+		}
+		for _, event := range project.Events {
+			if !slices.Contains(validEvents, event) {
+				return fmt.Errorf("project %d (%s): invalid event %q (must be one of %s)", i+1, project.Name, event, strings.Join(validEvents, ", "))
+			}
+		}
+
+		// Default queue_size to Defaults.QueueSize if not set
+		if project.QueueSize < 0 {
+			return fmt.Errorf("project %d (%s): queue_size must not be negative", i+1, project.Name)
+		}
+		if project.QueueSize == 0 {
+			project.QueueSize = Defaults.QueueSize
+		}
+
+		// Per-project history_limit falls back to the global history_limit
+		if project.HistoryLimit < 0 {
+			return fmt.Errorf("project %d (%s): history_limit must not be negative", i+1, project.Name)
+		}
+		if project.HistoryLimit == 0 {
+			project.HistoryLimit = cfg.HistoryLimit
+		}
+
+		// Per-project run log retention falls back to the global settings
+		if project.RunLogKeep < 0 || project.RunLogMaxAge < 0 {
+			return fmt.Errorf("project %d (%s): run_log_keep and run_log_max_age_days must not be negative", i+1, project.Name)
+		}
+		if project.RunLogKeep == 0 {
+			project.RunLogKeep = cfg.RunLogKeep
+		}
+		if project.RunLogMaxAge == 0 {
+			project.RunLogMaxAge = cfg.RunLogMaxAge
+		}
+
+		// Per-project kill_grace_seconds falls back to the global setting
+		if project.KillGraceSeconds != nil && *project.KillGraceSeconds < 0 {
+			return fmt.Errorf("project %d (%s): kill_grace_seconds must not be negative", i+1, project.Name)
+		}
+		if project.KillGraceSeconds == nil {
+			grace := *cfg.KillGraceSeconds
+			project.KillGraceSeconds = &grace
+		}
+
+		// Default health_check settings from Defaults (retries when decoded)
+		if hc := project.HealthCheck; hc != nil {
+			if !strings.HasPrefix(hc.URL, "http://") && !strings.HasPrefix(hc.URL, "https://") {
+				return fmt.Errorf("project %d (%s): health_check.url must be an http:// or https:// URL", i+1, project.Name)
+			}
+			if hc.Retries < 0 || hc.IntervalSeconds < 0 || hc.TimeoutSeconds < 0 {
+				return fmt.Errorf("project %d (%s): health_check retries, interval_seconds and timeout_seconds must not be negative", i+1, project.Name)
+			}
+			if hc.ExpectedStatus == 0 {
+				hc.ExpectedStatus = Defaults.HealthStatus
+			}
+			if hc.IntervalSeconds == 0 {
+				hc.IntervalSeconds = Defaults.HealthInterval
+			}
+			if hc.TimeoutSeconds == 0 {
+				hc.TimeoutSeconds = Defaults.HealthTimeout
+			}
+		}
+
 		// Validate git_ssh_key_path if provided
 		if project.GitSSHKeyPath != "" {
 			if err := validateSSHKeyPath(project.GitSSHKeyPath); err != nil {
@@ -153,6 +153,32 @@ projects:
 	}
 }
 
+// TestLoadConfigProjectKeyCollision tests that names sharing a storage key are rejected
+func TestLoadConfigProjectKeyCollision(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Web App
+    webhook_path: /hooks/web
+    webhook_secret: secret1
+    execute_command: make
+  - name: web-app
+    webhook_path: /hooks/web-app
+    webhook_secret: secret2
+    execute_command: make
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	_, err := LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), `"web-app"`) {
+		t.Errorf("Expected error for names stored as web-app, got %v", err)
+	}
+}
+
 // TestLoadConfigDefaultPort tests default listen port
 func TestLoadConfigDefaultPort(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -536,3 +562,965 @@ projects:
 		t.Errorf("Expected error message to mention git_ssh_key_path, got: %v", err)
 	}
 }
+
+// TestLoadConfigOnBusy tests on_busy defaults and validation
+func TestLoadConfigOnBusy(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Default
+    webhook_path: /hooks/default
+    webhook_secret: secret1
+    execute_command: echo default
+  - name: Queued
+    webhook_path: /hooks/queued
+    webhook_secret: secret2
+    execute_command: echo queued
+    on_busy: queue
+    queue_size: 3
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if cfg.Projects[0].OnBusy != Defaults.OnBusy {
+		t.Errorf("Expected default OnBusy '%s', got '%s'", Defaults.OnBusy, cfg.Projects[0].OnBusy)
+	}
+	if cfg.Projects[0].QueueSize != Defaults.QueueSize {
+		t.Errorf("Expected default QueueSize %d, got %d", Defaults.QueueSize, cfg.Projects[0].QueueSize)
+	}
+	if cfg.Projects[1].OnBusy != OnBusyQueue {
+		t.Errorf("Expected OnBusy '%s', got '%s'", OnBusyQueue, cfg.Projects[1].OnBusy)
+	}
+	if cfg.Projects[1].QueueSize != 3 {
+		t.Errorf("Expected QueueSize 3, got %d", cfg.Projects[1].QueueSize)
+	}
+
+	// Invalid on_busy value
+	invalidConfig := `
+projects:
+  - name: Invalid
+    webhook_path: /hooks/invalid
+    webhook_secret: secret1
+    execute_command: echo invalid
+    on_busy: wait
+`
+	if err := os.WriteFile(configPath, []byte(invalidConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	_, err = LoadConfig(configPath)
+	if err == nil {
+		t.Fatal("Expected error for invalid on_busy, got nil")
+	}
+	if !strings.Contains(err.Error(), "on_busy") {
+		t.Errorf("Expected error to mention on_busy, got: %v", err)
+	}
+}
+
+// TestLoadConfigGitStrategy tests git_strategy defaults and validation
+func TestLoadConfigGitStrategy(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Default
+    webhook_path: /hooks/default
+    webhook_secret: secret1
+    execute_command: echo default
+  - name: Reset
+    webhook_path: /hooks/reset
+    webhook_secret: secret2
+    execute_command: echo reset
+    git_strategy: fetch_reset
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Projects[0].GitStrategy != Defaults.GitStrategy {
+		t.Errorf("Expected default GitStrategy '%s', got '%s'", Defaults.GitStrategy, cfg.Projects[0].GitStrategy)
+	}
+	if cfg.Projects[1].GitStrategy != GitStrategyFetchReset {
+		t.Errorf("Expected GitStrategy '%s', got '%s'", GitStrategyFetchReset, cfg.Projects[1].GitStrategy)
+	}
+
+	// Invalid git_strategy value
+	invalidConfig := `
+projects:
+  - name: Invalid
+    webhook_path: /hooks/invalid
+    webhook_secret: secret1
+    execute_command: echo invalid
+    git_strategy: rebase
+`
+	if err := os.WriteFile(configPath, []byte(invalidConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	_, err = LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "git_strategy") {
+		t.Errorf("Expected error to mention git_strategy, got: %v", err)
+	}
+}
+
+// TestLoadConfigSteps tests steps parsing and validation
+func TestLoadConfigSteps(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Pipeline
+    webhook_path: /hooks/pipeline
+    webhook_secret: secret1
+    steps:
+      - name: install
+        command: npm ci
+        timeout_seconds: 300
+      - command: npm run build
+        execute_path: web
+        continue_on_error: true
+        env:
+          NODE_ENV: production
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	steps := cfg.Projects[0].Steps
+	if len(steps) != 2 {
+		t.Fatalf("Expected 2 steps, got %d", len(steps))
+	}
+	if steps[0].Name != "install" || steps[0].TimeoutSeconds != 300 {
+		t.Errorf("Unexpected first step: %+v", steps[0])
+	}
+	if steps[1].Name != "step 2" || steps[1].ExecutePath != "web" || !steps[1].ContinueOnError || steps[1].Env["NODE_ENV"] != "production" {
+		t.Errorf("Unexpected second step: %+v", steps[1])
+	}
+
+	invalidConfigs := map[string]string{
+		"steps and execute_command": `
+projects:
+  - name: Pipeline
+    webhook_path: /hooks/pipeline
+    webhook_secret: secret1
+    execute_command: make
+    steps:
+      - command: make test
+`,
+		"step without command": `
+projects:
+  - name: Pipeline
+    webhook_path: /hooks/pipeline
+    webhook_secret: secret1
+    steps:
+      - name: empty
+`,
+	}
+
+	for name, invalidConfig := range invalidConfigs {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(invalidConfig), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			if _, err := LoadConfig(configPath); err == nil {
+				t.Error("Expected validation error, got nil")
+			}
+		})
+	}
+}
+
+// TestLoadConfigHooks tests parsing of deploy hooks
+func TestLoadConfigHooks(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Hooks
+    webhook_path: /hooks/hooks
+    webhook_secret: secret1
+    execute_command: make
+    hooks:
+      pre_deploy: touch maintenance.flag
+      post_deploy_success: curl -s https://example.com/ok
+      post_deploy_failure: ./cleanup.sh
+      always: rm -f maintenance.flag
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	hooks := cfg.Projects[0].Hooks
+	if hooks.PreDeploy != "touch maintenance.flag" || hooks.PostDeploySuccess == "" || hooks.PostDeployFailure != "./cleanup.sh" || hooks.Always != "rm -f maintenance.flag" {
+		t.Errorf("Unexpected hooks: %+v", hooks)
+	}
+	if got := strings.Join(configuredHooks(hooks), ","); got != "pre_deploy,post_deploy_success,post_deploy_failure,always" {
+		t.Errorf("Unexpected configured hooks: %s", got)
+	}
+}
+
+// TestLoadConfigHealthCheck tests health_check defaults and validation
+func TestLoadConfigHealthCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Health
+    webhook_path: /hooks/health
+    webhook_secret: secret1
+    execute_command: make
+    rollback_command: make rollback
+    health_check:
+      url: http://127.0.0.1:3000/healthz
+      body_contains: ok
+  - name: HealthOnce
+    webhook_path: /hooks/health-once
+    webhook_secret: secret2
+    execute_command: make
+    health_check:
+      url: http://127.0.0.1:3001/healthz
+      retries: 0
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	hc := cfg.Projects[0].HealthCheck
+	if hc == nil {
+		t.Fatal("Expected health_check to be parsed")
+	}
+	if hc.ExpectedStatus != Defaults.HealthStatus || hc.Retries != Defaults.HealthRetries ||
+		hc.IntervalSeconds != Defaults.HealthInterval || hc.TimeoutSeconds != Defaults.HealthTimeout {
+		t.Errorf("Expected health_check defaults, got %+v", hc)
+	}
+	if hc.BodyContains != "ok" || cfg.Projects[0].RollbackCommand != "make rollback" {
+		t.Errorf("Unexpected health_check config: %+v", hc)
+	}
+	// An explicit retries: 0 checks once instead of falling back to the default
+	if retries := cfg.Projects[1].HealthCheck.Retries; retries != 0 {
+		t.Errorf("Expected explicit retries 0 to be kept, got %d", retries)
+	}
+
+	invalidConfig := `
+projects:
+  - name: Health
+    webhook_path: /hooks/health
+    webhook_secret: secret1
+    execute_command: make
+    health_check:
+      url: localhost:3000
+`
+	if err := os.WriteFile(configPath, []byte(invalidConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "health_check.url") {
+		t.Errorf("Expected health_check.url error, got: %v", err)
+	}
+}
+
+// TestLoadConfigReleaseMode tests release_mode defaults and validation
+func TestLoadConfigReleaseMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Release
+    webhook_path: /hooks/release
+    webhook_secret: secret1
+    git_repo: https://github.com/example/app.git
+    local_path: /var/www/app
+    execute_command: make build
+    release_mode: true
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.Projects[0].ReleaseMode {
+		t.Error("Expected ReleaseMode to be true")
+	}
+	if cfg.Projects[0].KeepReleases != Defaults.KeepReleases {
+		t.Errorf("Expected default KeepReleases %d, got %d", Defaults.KeepReleases, cfg.Projects[0].KeepReleases)
+	}
+
+	invalidConfigs := map[string]string{
+		"missing git_repo": `
+projects:
+  - name: Release
+    webhook_path: /hooks/release
+    webhook_secret: secret1
+    local_path: /var/www/app
+    execute_command: make build
+    release_mode: true
+`,
+		"absolute execute_path": `
+projects:
+  - name: Release
+    webhook_path: /hooks/release
+    webhook_secret: secret1
+    git_repo: https://github.com/example/app.git
+    local_path: /var/www/app
+    execute_path: /var/www/app/web
+    execute_command: make build
+    release_mode: true
+`,
+		"negative keep_releases": `
+projects:
+  - name: Release
+    webhook_path: /hooks/release
+    webhook_secret: secret1
+    execute_command: make build
+    keep_releases: -1
+`,
+	}
+
+	for name, invalidConfig := range invalidConfigs {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(invalidConfig), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			if _, err := LoadConfig(configPath); err == nil {
+				t.Error("Expected validation error, got nil")
+			}
+		})
+	}
+}
+
+// TestLoadConfigHistoryDefaults tests state_dir and history_limit defaults
+func TestLoadConfigHistoryDefaults(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+history_limit: 20
+projects:
+  - name: Inherited
+    webhook_path: /hooks/inherited
+    webhook_secret: secret1
+    execute_command: echo inherited
+  - name: Override
+    webhook_path: /hooks/override
+    webhook_secret: secret2
+    execute_command: echo override
+    history_limit: 5
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if cfg.StateDir != Defaults.StateDir {
+		t.Errorf("Expected default StateDir '%s', got '%s'", Defaults.StateDir, cfg.StateDir)
+	}
+	if cfg.Projects[0].HistoryLimit != 20 {
+		t.Errorf("Expected inherited HistoryLimit 20, got %d", cfg.Projects[0].HistoryLimit)
+	}
+	if cfg.Projects[1].HistoryLimit != 5 {
+		t.Errorf("Expected HistoryLimit 5, got %d", cfg.Projects[1].HistoryLimit)
+	}
+}
+
+// TestLoadConfigWebhookPathReservedForAPI tests that webhook paths cannot shadow the API
+func TestLoadConfigWebhookPathReservedForAPI(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Shadow
+    webhook_path: /api/projects
+    webhook_secret: secret1
+    execute_command: echo shadow
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	_, err := LoadConfig(configPath)
+	if err == nil {
+		t.Fatal("Expected error for webhook_path under /api/, got nil")
+	}
+	if !strings.Contains(err.Error(), APIPathPrefix) {
+		t.Errorf("Expected error to mention %s, got: %v", APIPathPrefix, err)
+	}
+}
+
+// TestLoadConfigMetrics tests metrics_path/metrics_port defaults and validation
+func TestLoadConfigMetrics(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	project := `
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret1
+    execute_command: make
+`
+	tests := []struct {
+		name     string
+		global   string
+		wantPath string
+		wantErr  string
+	}{
+		{"disabled by default", "", "", ""},
+		{"path on listen port", "metrics_path: /metrics\n", "/metrics", ""},
+		{"port defaults path", "metrics_port: 9100\n", Defaults.MetricsPath, ""},
+		{"relative path", "metrics_path: metrics\n", "", "metrics_path must start with /"},
+		{"path under api", "metrics_path: /api/metrics\n", "", "metrics_path must not start with"},
+		{"port equals listen port", "listen_port: 9100\nmetrics_port: 9100\n", "", "metrics_port must differ"},
+		{"path shadows webhook", "metrics_path: /hooks/app\n", "", "webhook_path must not equal metrics_path"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(tc.global+project), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			cfg, err := LoadConfig(configPath)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if cfg.MetricsPath != tc.wantPath {
+				t.Errorf("Expected metrics_path %q, got %q", tc.wantPath, cfg.MetricsPath)
+			}
+		})
+	}
+}
+
+// TestLoadConfigWebhookPathReservedForProbes tests that webhook paths cannot shadow /healthz and /readyz
+func TestLoadConfigWebhookPathReservedForProbes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	for _, path := range []string{HealthzPath, ReadyzPath} {
+		config := `
+projects:
+  - name: Shadow
+    webhook_path: ` + path + `
+    webhook_secret: secret1
+    execute_command: echo shadow
+`
+		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+
+		_, err := LoadConfig(configPath)
+		if err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Errorf("Expected reserved path error for %s, got: %v", path, err)
+		}
+	}
+}
+
+// TestLoadConfigLogFormat tests the log_format default and validation
+func TestLoadConfigLogFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	if err := os.WriteFile(configPath, []byte("projects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.LogFormat != Defaults.LogFormat {
+		t.Errorf("Expected default log_format %q, got %q", Defaults.LogFormat, cfg.LogFormat)
+	}
+
+	if err := os.WriteFile(configPath, []byte("log_format: json\nprojects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if cfg, err = LoadConfig(configPath); err != nil || cfg.LogFormat != LogFormatJSON {
+		t.Errorf("Expected log_format json, got %v (err: %v)", cfg, err)
+	}
+
+	if err := os.WriteFile(configPath, []byte("log_format: logfmt\nprojects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "log_format") {
+		t.Errorf("Expected log_format error, got: %v", err)
+	}
+}
+
+// TestLoadConfigLogRotation tests log_filepath and rotation defaults and validation
+func TestLoadConfigLogRotation(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	if err := os.WriteFile(configPath, []byte("projects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.LogFilepath != Defaults.LogPath {
+		t.Errorf("Expected default log_filepath %s, got %s", Defaults.LogPath, cfg.LogFilepath)
+	}
+	if rotation := cfg.LogRotation(); rotation.MaxSizeMB != 0 || rotation.MaxBackups != Defaults.LogMaxBackups {
+		t.Errorf("Expected rotation disabled with default backups, got %+v", rotation)
+	}
+
+	config := `
+log_filepath: /tmp/custom/sdeploy.log
+log_max_size_mb: 50
+log_max_backups: 3
+log_max_age_days: 14
+log_compress: true
+projects: []
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err = LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	expected := LogRotation{MaxSizeMB: 50, MaxBackups: 3, MaxAgeDays: 14, Compress: true}
+	if cfg.LogFilepath != "/tmp/custom/sdeploy.log" || cfg.LogRotation() != expected {
+		t.Errorf("Unexpected log settings: %s %+v", cfg.LogFilepath, cfg.LogRotation())
+	}
+
+	if err := os.WriteFile(configPath, []byte("log_max_size_mb: -1\nprojects: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("Expected error for negative log_max_size_mb")
+	}
+}
+
+// TestLoadConfigRunLogs tests run log retention defaults and per-project overrides
+func TestLoadConfigRunLogs(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+run_logs: true
+run_log_max_age_days: 30
+projects:
+  - name: Default
+    webhook_path: /hooks/default
+    webhook_secret: secret1
+    execute_command: make
+  - name: Custom
+    webhook_path: /hooks/custom
+    webhook_secret: secret2
+    execute_command: make
+    run_log_keep: 100
+    run_log_max_age_days: 7
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !cfg.RunLogs || cfg.RunLogKeep != Defaults.RunLogKeep {
+		t.Errorf("Expected run_logs enabled with default keep, got %t/%d", cfg.RunLogs, cfg.RunLogKeep)
+	}
+	if p := cfg.Projects[0]; p.RunLogKeep != Defaults.RunLogKeep || p.RunLogMaxAge != 30 {
+		t.Errorf("Expected inherited run log retention, got %d/%d", p.RunLogKeep, p.RunLogMaxAge)
+	}
+	if p := cfg.Projects[1]; p.RunLogKeep != 100 || p.RunLogMaxAge != 7 {
+		t.Errorf("Expected per-project run log retention, got %d/%d", p.RunLogKeep, p.RunLogMaxAge)
+	}
+}
+
+// TestLoadConfigRedaction tests redact_env, redact_patterns and log_payloads parsing and validation
+func TestLoadConfigRedaction(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	project := `
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret1
+    execute_command: make
+`
+	tests := []struct {
+		name    string
+		global  string
+		wantErr string
+	}{
+		{"defaults", "", ""},
+		{"valid", "log_payloads: true\nredact_env: [DB_PASSWORD]\nredact_patterns: ['token=(\\S+)']\n", ""},
+		{"invalid regex", "redact_patterns: ['([a-z']\n", "invalid redact_patterns entry"},
+		{"matches empty text", "redact_patterns: ['a*']\n", "must not match empty text"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.WriteFile(configPath, []byte(tc.global+project), 0644); err != nil {
+				t.Fatalf("Failed to create test config file: %v", err)
+			}
+			cfg, err := LoadConfig(configPath)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if tc.name == "defaults" && (cfg.LogPayloads || len(cfg.RedactEnv) > 0 || len(cfg.RedactPatterns) > 0) {
+				t.Errorf("Expected payload logging and extra redaction off by default, got %+v", cfg)
+			}
+			if tc.name == "valid" && (!cfg.LogPayloads || cfg.RedactEnv[0] != "DB_PASSWORD" || cfg.RedactPatterns[0] != `token=(\S+)`) {
+				t.Errorf("Unexpected redaction config: %t %v %v", cfg.LogPayloads, cfg.RedactEnv, cfg.RedactPatterns)
+			}
+		})
+	}
+}
+
+// TestLoadConfigKillGrace tests kill_grace_seconds defaults and per-project overrides
+func TestLoadConfigKillGrace(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Default
+    webhook_path: /hooks/default
+    webhook_secret: secret1
+    execute_command: make
+  - name: Custom
+    webhook_path: /hooks/custom
+    webhook_secret: secret2
+    execute_command: make
+    kill_grace_seconds: 30
+  - name: Immediate
+    webhook_path: /hooks/immediate
+    webhook_secret: secret3
+    execute_command: make
+    kill_grace_seconds: 0
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if *cfg.KillGraceSeconds != Defaults.KillGraceSeconds || *cfg.Projects[0].KillGraceSeconds != Defaults.KillGraceSeconds {
+		t.Errorf("Expected default kill grace %d, got %d/%d", Defaults.KillGraceSeconds, *cfg.KillGraceSeconds, *cfg.Projects[0].KillGraceSeconds)
+	}
+	if *cfg.Projects[1].KillGraceSeconds != 30 {
+		t.Errorf("Expected per-project kill grace 30, got %d", *cfg.Projects[1].KillGraceSeconds)
+	}
+	// An explicit 0 is kept and sends SIGKILL at once
+	if grace := cfg.Projects[2].killGrace(); grace != 0 {
+		t.Errorf("Expected explicit kill grace 0 to be kept, got %v", grace)
+	}
+
+	// A global 0 is inherited by projects without their own setting
+	if err := os.WriteFile(configPath, []byte("kill_grace_seconds: 0\n"+config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err = LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if grace := cfg.Projects[0].killGrace(); grace != 0 {
+		t.Errorf("Expected global kill grace 0 to be inherited, got %v", grace)
+	}
+
+	if err := os.WriteFile(configPath, []byte("kill_grace_seconds: -1\n"+config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "kill_grace_seconds") {
+		t.Errorf("Expected error for negative kill_grace_seconds, got %v", err)
+	}
+}
+
+// TestLoadConfigShutdownTimeout tests the shutdown_timeout_seconds default and validation
+func TestLoadConfigShutdownTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Test
+    webhook_path: /hooks/test
+    webhook_secret: secret
+    execute_command: make
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ShutdownTimeout != Defaults.ShutdownTimeout {
+		t.Errorf("Expected default shutdown timeout %d, got %d", Defaults.ShutdownTimeout, cfg.ShutdownTimeout)
+	}
+
+	if err := os.WriteFile(configPath, []byte("shutdown_timeout_seconds: 120\n"+config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if cfg, err = LoadConfig(configPath); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.ShutdownTimeout != 120 {
+		t.Errorf("Expected shutdown timeout 120, got %d", cfg.ShutdownTimeout)
+	}
+
+	if err := os.WriteFile(configPath, []byte("shutdown_timeout_seconds: -1\n"+config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "shutdown_timeout_seconds") {
+		t.Errorf("Expected error for negative shutdown_timeout_seconds, got %v", err)
+	}
+}
+
+// TestLoadConfigReplayProtection tests replay protection defaults, validation and require_signed_trigger
+func TestLoadConfigReplayProtection(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Test
+    webhook_path: /hooks/test
+    webhook_secret: secret
+    execute_command: make
+    require_signed_trigger: true
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.DeliveryIDKeep != Defaults.DeliveryIDKeep || cfg.TriggerMaxSkew != Defaults.TriggerMaxSkew {
+		t.Errorf("Expected defaults %d/%d, got %d/%d", Defaults.DeliveryIDKeep, Defaults.TriggerMaxSkew, cfg.DeliveryIDKeep, cfg.TriggerMaxSkew)
+	}
+	if !cfg.Projects[0].RequireSignedTrigger {
+		t.Error("Expected require_signed_trigger to be parsed")
+	}
+
+	for _, key := range []string{"delivery_id_keep", "trigger_max_skew_seconds"} {
+		if err := os.WriteFile(configPath, []byte(key+": -1\n"+config), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected error for negative %s, got %v", key, err)
+		}
+	}
+}
+
+// TestLoadConfigEvents tests the events default and validation
+func TestLoadConfigEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Default
+    webhook_path: /hooks/default
+    webhook_secret: secret1
+    execute_command: make
+  - name: Releases
+    webhook_path: /hooks/releases
+    webhook_secret: secret2
+    execute_command: make
+    events: [tag, release]
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if strings.Join(cfg.Projects[0].Events, ",") != EventPush {
+		t.Errorf("Expected default events [push], got %v", cfg.Projects[0].Events)
+	}
+	if strings.Join(cfg.Projects[1].Events, ",") != "tag,release" {
+		t.Errorf("Expected events [tag release], got %v", cfg.Projects[1].Events)
+	}
+
+	invalid := strings.Replace(config, "events: [tag, release]", "events: [tag, issues]", 1)
+	if err := os.WriteFile(configPath, []byte(invalid), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), `invalid event "issues"`) {
+		t.Errorf("Expected error for unknown event, got %v", err)
+	}
+}
+
+// TestLoadConfigGitTagPattern tests git_tag_pattern validation and its default events
+func TestLoadConfigGitTagPattern(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: Releases
+    webhook_path: /hooks/releases
+    webhook_secret: secret1
+    execute_command: make
+    git_tag_pattern: "^v[0-9]+\\.[0-9]+\\.[0-9]+$"
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if strings.Join(cfg.Projects[0].Events, ",") != EventTag {
+		t.Errorf("Expected default events [tag] with git_tag_pattern, got %v", cfg.Projects[0].Events)
+	}
+	if !matchRefPattern(cfg.Projects[0].GitTagPattern, "v1.2.3") {
+		t.Errorf("Expected pattern %q to match v1.2.3", cfg.Projects[0].GitTagPattern)
+	}
+
+	for _, pattern := range []string{`"^v[0-9"`, `"v[1-"`} {
+		invalid := strings.Replace(config, `"^v[0-9]+\\.[0-9]+\\.[0-9]+$"`, pattern, 1)
+		if err := os.WriteFile(configPath, []byte(invalid), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "git_tag_pattern") {
+			t.Errorf("Expected git_tag_pattern error for %s, got %v", pattern, err)
+		}
+	}
+}
+
+// TestLoadConfigBranches tests parsing and validating the branches list
+func TestLoadConfigBranches(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret1
+    execute_command: make
+    branches:
+      - pattern: main
+      - pattern: "feature/*"
+        local_path: /srv/previews/{branch_slug}
+        execute_command: make preview
+        env:
+          PREVIEW_HOST: "{branch_slug}.preview.example.com"
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	branches := cfg.Projects[0].Branches
+	if len(branches) != 2 || branches[1].Pattern != "feature/*" || branches[1].LocalPath != "/srv/previews/{branch_slug}" ||
+		branches[1].ExecuteCommand != "make preview" || branches[1].Env["PREVIEW_HOST"] != "{branch_slug}.preview.example.com" {
+		t.Errorf("Unexpected branches: %+v", branches)
+	}
+
+	for _, tc := range []struct {
+		old, new, expected string
+	}{
+		{"- pattern: main", "- local_path: /srv/app", "branches entry 1: pattern is required"},
+		{`"feature/*"`, `"^feature/(.*"`, "branches entry 2: invalid regular expression"},
+	} {
+		invalid := strings.Replace(config, tc.old, tc.new, 1)
+		if err := os.WriteFile(configPath, []byte(invalid), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+		}
+	}
+}
+
+// TestLoadConfigPathFilters tests parsing and validating include_paths and exclude_paths
+func TestLoadConfigPathFilters(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "sdeploy.conf")
+
+	config := `
+projects:
+  - name: API
+    webhook_path: /hooks/api
+    webhook_secret: secret1
+    execute_command: make
+    include_paths: ["services/api/**", "go.mod"]
+    exclude_paths: ["**/*.md"]
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if strings.Join(cfg.Projects[0].IncludePaths, ",") != "services/api/**,go.mod" || strings.Join(cfg.Projects[0].ExcludePaths, ",") != "**/*.md" {
+		t.Errorf("Unexpected path filters: include %v, exclude %v", cfg.Projects[0].IncludePaths, cfg.Projects[0].ExcludePaths)
+	}
+
+	for _, tc := range []struct {
+		old, new, expected string
+	}{
+		{`"go.mod"`, `"services/[api"`, "include_paths: invalid glob"},
+		{`["**/*.md"]`, `[""]`, "exclude_paths: empty pattern"},
+	} {
+		invalid := strings.Replace(config, tc.old, tc.new, 1)
+		if err := os.WriteFile(configPath, []byte(invalid), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+		if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+		}
+	}
+}
@@ -3,9 +3,15 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -13,13 +19,34 @@ import (
 )
 
 // DeployResult represents the result of a deployment
+// It is persisted as JSON by the HistoryStore
 type DeployResult struct {
-	Success   bool
-	Skipped   bool
-	Output    string
-	Error     string
-	StartTime time.Time
-	EndTime   time.Time
+	RunID         string             `json:"run_id"`
+	Project       string             `json:"project"`
+	TriggerSource string             `json:"trigger_source"`
+	Branch        string             `json:"branch"`
+	Commit        string             `json:"commit,omitempty"`
+	Tag           string             `json:"tag,omitempty"`          // Tag deployed by a tag push or release event
+	ReleaseDir    string             `json:"release_dir,omitempty"`  // Release directory built by this run (release_mode)
+	Steps         []StepResult       `json:"steps,omitempty"`        // Per-step results when steps are configured
+	Hooks         []StepResult       `json:"hooks,omitempty"`        // Results of the hooks that ran
+	HealthCheck   *HealthCheckResult `json:"health_check,omitempty"` // Post-deploy health check outcome
+	RolledBack    bool               `json:"rolled_back,omitempty"`  // Rolled back after a failed health check
+	LogFile       string             `json:"log_file,omitempty"`     // Full output of the run (run_logs)
+	TimedOut      bool               `json:"timed_out,omitempty"`    // A command exceeded its timeout
+	KillSignal    string             `json:"kill_signal,omitempty"`  // Signal that ended an interrupted command (SIGTERM or SIGKILL)
+	Cancelled     bool               `json:"cancelled,omitempty"`    // Cancelled through the API or CLI
+	CancelledBy   string             `json:"cancelled_by,omitempty"` // Who requested the cancellation
+	Interrupted   bool               `json:"interrupted,omitempty"`  // Stopped because sdeploy shut down before it finished
+	Success       bool               `json:"success"`
+	Skipped       bool               `json:"skipped"`
+	Queued        bool               `json:"queued,omitempty"`       // Request is waiting for the running deployment (on_busy: queue/coalesce)
+	QueueLength   int                `json:"queue_length,omitempty"` // Number of pending runs after this request was queued
+	ExitCode      int                `json:"exit_code"`
+	Output        string             `json:"output"`
+	Error         string             `json:"error,omitempty"`
+	StartTime     time.Time          `json:"start_time"`
+	EndTime       time.Time          `json:"end_time"`
 }
 
 // Duration returns the deployment duration
@@ -27,21 +54,187 @@ func (r *DeployResult) Duration() time.Duration {
 	return r.EndTime.Sub(r.StartTime)
 }
 
+// Status returns a short status label: success, failed, skipped, queued, cancelled or interrupted
+func (r *DeployResult) Status() string {
+	switch {
+	case r.Queued:
+		return "queued"
+	case r.Skipped:
+		return "skipped"
+	case r.Cancelled:
+		return "cancelled"
+	case r.Interrupted:
+		return "interrupted"
+	case r.Success:
+		return "success"
+	default:
+		return "failed"
+	}
+}
+
+// deployRequest holds a single deployment trigger, either running or pending
+type deployRequest struct {
+	ctx           context.Context
+	runID         string
+	project       *ProjectConfig
+	triggerSource string
+	event         *WebhookEvent // Webhook payload details (nil if not triggered by a webhook)
+	deployAll     bool          // Deploy regardless of path filters (replaced a pending run that did)
+}
+
+// targetCommit returns the commit announced by a WEBHOOK trigger, or "" to deploy the branch tip
+func (req *deployRequest) targetCommit() string {
+	if req.event == nil || req.triggerSource != string(TriggerWebhook) {
+		return ""
+	}
+	if !isCommitSHA(req.event.Commit) || strings.Trim(req.event.Commit, "0") == "" {
+		return ""
+	}
+	return req.event.Commit
+}
+
+// targetTag returns the tag announced by a tag push or release event, or "" to deploy the branch
+func (req *deployRequest) targetTag() string {
+	if req.event == nil {
+		return ""
+	}
+	return req.event.Tag
+}
+
+// filtersChangedPaths reports whether the run must check the pushed changes
+// against include_paths/exclude_paths with git diff, because the webhook's
+// file lists were missing or truncated
+func (req *deployRequest) filtersChangedPaths() bool {
+	return req.isWebhookPush() && !req.deployAll && !req.event.FilesComplete && req.project.hasPathFilters()
+}
+
+// isWebhookPush reports whether the request was triggered by a branch push webhook
+func (req *deployRequest) isWebhookPush() bool {
+	return req.triggerSource == string(TriggerWebhook) && req.event != nil && req.event.Kind == EventPush
+}
+
+// logAttrs returns the log attributes identifying the request's run
+func (req *deployRequest) logAttrs() []slog.Attr {
+	return []slog.Attr{
+		slog.String("run_id", req.runID),
+		slog.String("trigger", req.triggerSource),
+	}
+}
+
+// newResult creates a DeployResult pre-filled with the request details
+func (req *deployRequest) newResult() DeployResult {
+	return DeployResult{
+		RunID:         req.runID,
+		Project:       req.project.Name,
+		TriggerSource: req.triggerSource,
+		Branch:        req.project.GitBranch,
+		Tag:           req.targetTag(),
+		StartTime:     time.Now(),
+	}
+}
+
 // Deployer handles deployment execution with locking
 type Deployer struct {
 	logger        *Logger
-	locks         map[string]*sync.Mutex
+	locks         map[deployKey]*sync.Mutex
+	pending       map[deployKey][]*deployRequest // pending runs per lock, guarded by locksMu
 	locksMu       sync.Mutex
 	notifier      *EmailNotifier
+	history       *HistoryStore
+	runLogs       *RunLogStore
+	streams       *StreamHub
+	running       map[deployKey]*runningDeploy // running run per lock, guarded by locksMu
+	redactor      *Redactor
 	configManager *ConfigManager
-	activeBuilds  int32 // atomic counter for active builds
+	metrics       *Metrics
+	stateDir      string // holds the release lock files shared with sdeploy rollback
+	activeBuilds  int32  // atomic counter for active builds
+	accepted      int32  // atomic counter for accepted deployments not yet returned, see Accept
+}
+
+// errCommandTimeout is returned (wrapped) when a command exceeds its timeout
+var errCommandTimeout = errors.New("command timed out")
+
+// errDeployCancelled matches the cancellation cause of a run cancelled through the API or CLI
+var errDeployCancelled = errors.New("deployment cancelled")
+
+// ErrShutdown is the cancellation cause of runs stopped because sdeploy is shutting down
+var ErrShutdown = errors.New("sdeploy is shutting down")
+
+// ErrNotDeploying is returned by Cancel when no deployment of the project is running
+var ErrNotDeploying = errors.New("no deployment is running")
+
+// killedError is returned when an interrupted command was stopped by a signal
+type killedError struct {
+	err    error
+	signal string
+}
+
+// Error implements error
+func (e *killedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the reason the command was interrupted
+func (e *killedError) Unwrap() error {
+	return e.err
+}
+
+// killSignal returns the signal that ended an interrupted command in err's chain, or ""
+func killSignal(err error) string {
+	var killed *killedError
+	if errors.As(err, &killed) {
+		return killed.signal
+	}
+	return ""
+}
+
+// cancelCause is the context cause of a cancelled run, recording who cancelled it
+type cancelCause struct {
+	by string
+}
+
+// Error implements error
+func (c *cancelCause) Error() string {
+	return "deployment cancelled by " + c.by
+}
+
+// Is makes cancelCause match errDeployCancelled
+func (c *cancelCause) Is(target error) bool {
+	return target == errDeployCancelled
+}
+
+// deployKey identifies what a deployment lock guards: a project and, for
+// projects with a branches list, the resolved local_path of the branch. Preview
+// branches in their own directories deploy concurrently, while branches sharing
+// a directory take turns.
+type deployKey struct {
+	webhookPath string
+	localPath   string
+}
+
+// lockKey returns the key of the lock a project deployment holds
+func lockKey(project *ProjectConfig) deployKey {
+	if len(project.Branches) == 0 {
+		return deployKey{webhookPath: project.WebhookPath}
+	}
+	return deployKey{webhookPath: project.WebhookPath, localPath: project.LocalPath}
+}
+
+// runningDeploy is the cancel handle of a running deployment
+type runningDeploy struct {
+	runID  string
+	cancel context.CancelCauseFunc
 }
 
 // NewDeployer creates a new deployer instance
 func NewDeployer(logger *Logger) *Deployer {
 	return &Deployer{
-		logger: logger,
-		locks:  make(map[string]*sync.Mutex),
+		logger:  logger,
+		locks:   make(map[deployKey]*sync.Mutex),
+		pending: make(map[deployKey][]*deployRequest),
+		running: make(map[deployKey]*runningDeploy),
+		streams: NewStreamHub(),
 	}
 }
 
@@ -50,132 +243,671 @@ func (d *Deployer) SetNotifier(notifier *EmailNotifier) {
 	d.notifier = notifier
 }
 
+// SetHistoryStore sets the store used to persist deployment results
+func (d *Deployer) SetHistoryStore(store *HistoryStore) {
+	d.history = store
+}
+
+// SetRedactor sets the redactor applied to run output before it is logged,
+// recorded or emailed
+func (d *Deployer) SetRedactor(redactor *Redactor) {
+	d.redactor = redactor
+}
+
+// SetRunLogStore sets the store receiving each run's full output
+func (d *Deployer) SetRunLogStore(store *RunLogStore) {
+	d.runLogs = store
+}
+
+// SetMetrics sets the metrics registry used to count deployments
+func (d *Deployer) SetMetrics(metrics *Metrics) {
+	d.metrics = metrics
+}
+
+// SetStateDir sets the state directory holding the release locks that keep
+// sdeploy rollback from switching releases during a release_mode deployment
+func (d *Deployer) SetStateDir(dir string) {
+	d.stateDir = dir
+}
+
 // SetConfigManager sets the config manager for deferred reload support
 func (d *Deployer) SetConfigManager(cm *ConfigManager) {
 	d.configManager = cm
 }
 
-// getProjectLock gets or creates a lock for a project
-func (d *Deployer) getProjectLock(projectPath string) *sync.Mutex {
-	d.locksMu.Lock()
-	defer d.locksMu.Unlock()
-
-	if lock, exists := d.locks[projectPath]; exists {
+// getProjectLock gets or creates a lock for a project (caller must hold locksMu)
+func (d *Deployer) getProjectLock(key deployKey) *sync.Mutex {
+	if lock, exists := d.locks[key]; exists {
 		return lock
 	}
 
 	lock := &sync.Mutex{}
-	d.locks[projectPath] = lock
+	d.locks[key] = lock
 	return lock
 }
 
+// ActiveBuilds returns the number of deployments currently running
+func (d *Deployer) ActiveBuilds() int {
+	return int(atomic.LoadInt32(&d.activeBuilds))
+}
+
 // HasActiveBuilds returns true if there are any active builds in progress
 func (d *Deployer) HasActiveBuilds() bool {
 	return atomic.LoadInt32(&d.activeBuilds) > 0
 }
 
-// Deploy executes a deployment for the given project
+// idlePollInterval is how often WaitIdle checks for active builds
+const idlePollInterval = 100 * time.Millisecond
+
+// Accept registers a deployment accepted for asynchronous execution before it
+// starts, so WaitIdle waits for it too. Call the returned func once DeployEvent returns.
+func (d *Deployer) Accept() func() {
+	atomic.AddInt32(&d.accepted, 1)
+	return func() { atomic.AddInt32(&d.accepted, -1) }
+}
+
+// idle reports whether no builds are active and no accepted deployments are outstanding
+func (d *Deployer) idle() bool {
+	return !d.HasActiveBuilds() && atomic.LoadInt32(&d.accepted) == 0
+}
+
+// WaitIdle waits until no builds are active, including accepted deployments
+// and pending runs started meanwhile. Returns false if ctx ends first.
+func (d *Deployer) WaitIdle(ctx context.Context) bool {
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+	for !d.idle() {
+		select {
+		case <-ctx.Done():
+			return d.idle()
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// Deploy executes a deployment for the given project.
+// If a deployment is already running, the project's on_busy policy decides
+// whether the request is skipped or kept as a pending run.
 func (d *Deployer) Deploy(ctx context.Context, project *ProjectConfig, triggerSource string) DeployResult {
-	result := DeployResult{
-		StartTime: time.Now(),
+	return d.DeployEvent(ctx, project, triggerSource, nil)
+}
+
+// DeployEvent executes a deployment for the given project using the webhook
+// event details (e.g., the commit to deploy). event may be nil.
+func (d *Deployer) DeployEvent(ctx context.Context, project *ProjectConfig, triggerSource string, event *WebhookEvent) DeployResult {
+	req := &deployRequest{
+		ctx:           ctx,
+		runID:         newRunID(),
+		project:       project,
+		triggerSource: triggerSource,
+		event:         event,
 	}
 
-	// Get project lock
-	lock := d.getProjectLock(project.WebhookPath)
+	result, acquired := d.acquireOrQueue(req)
+	if !acquired {
+		// Skipped requests are final; queued requests are recorded when they run
+		if result.Skipped {
+			d.recordHistory(project, &result)
+			d.metrics.ObserveDeploy(project.Name, &result)
+		}
+		return result
+	}
+	return d.run(req)
+}
+
+// acquireOrQueue acquires the project lock for req, or applies the on_busy
+// policy when a deployment is already in progress. Returns true if the lock was acquired.
+func (d *Deployer) acquireOrQueue(req *deployRequest) (DeployResult, bool) {
+	project := req.project
+
+	d.locksMu.Lock()
+	defer d.locksMu.Unlock()
+
+	key := lockKey(project)
+	lock := d.getProjectLock(key)
+	if lock.TryLock() {
+		// Increment active builds counter
+		atomic.AddInt32(&d.activeBuilds, 1)
+		return DeployResult{}, true
+	}
+
+	result := req.newResult()
+	result.EndTime = result.StartTime
+	queue := d.pending[key]
 
-	// Try to acquire lock (non-blocking)
-	if !lock.TryLock() {
+	switch project.OnBusy {
+	case OnBusyCoalesce:
+		// Keep only the newest request as the pending run of its branch
+		kept := make([]*deployRequest, 0, len(queue)+1)
+		for _, pending := range queue {
+			if pending.project.GitBranch != project.GitBranch {
+				kept = append(kept, pending)
+			} else {
+				req.mergeReplaced(pending)
+			}
+		}
+		replaced := len(kept) < len(queue)
+		d.pending[key] = append(kept, req)
+		result.Queued = true
+		result.QueueLength = len(kept) + 1
+		if d.logger != nil {
+			if replaced {
+				d.logger.LogAttrs(slog.LevelInfo, project.Name, fmt.Sprintf("Coalesced - deployment already in progress, replaced pending run (trigger: %s)", req.triggerSource), runAttrs(&result)...)
+			} else {
+				d.logger.LogAttrs(slog.LevelInfo, project.Name, fmt.Sprintf("Coalesced - deployment already in progress, run pending (trigger: %s)", req.triggerSource), runAttrs(&result)...)
+			}
+		}
+	case OnBusyQueue:
+		queueSize := project.QueueSize
+		if queueSize <= 0 {
+			queueSize = Defaults.QueueSize
+		}
+		if len(queue) >= queueSize {
+			result.Skipped = true
+			result.QueueLength = len(queue)
+			if d.logger != nil {
+				d.logger.LogAttrs(slog.LevelWarn, project.Name, fmt.Sprintf("Skipped - deployment queue full (%d pending)", len(queue)), runAttrs(&result)...)
+			}
+			break
+		}
+		d.pending[key] = append(queue, req)
+		result.Queued = true
+		result.QueueLength = len(queue) + 1
+		if d.logger != nil {
+			d.logger.LogAttrs(slog.LevelInfo, project.Name, fmt.Sprintf("Queued - deployment already in progress (position %d of %d, trigger: %s)", result.QueueLength, queueSize, req.triggerSource),
+				append(runAttrs(&result), slog.Int("queue_position", result.QueueLength))...)
+		}
+	default:
 		result.Skipped = true
-		result.EndTime = time.Now()
 		if d.logger != nil {
-			d.logger.Warnf(project.Name, "Skipped - deployment already in progress")
+			d.logger.LogAttrs(slog.LevelWarn, project.Name, "Skipped - deployment already in progress", runAttrs(&result)...)
 		}
-		return result
 	}
-	defer func() {
+
+	return result, false
+}
+
+// release hands the project lock to the next pending run, or unlocks and
+// removes it if none are waiting
+func (d *Deployer) release(key deployKey) {
+	d.dropInterrupted(key)
+
+	d.locksMu.Lock()
+	lock := d.getProjectLock(key)
+	queue := d.pending[key]
+	if len(queue) > 0 {
+		next := queue[0]
+		if len(queue) == 1 {
+			delete(d.pending, key)
+		} else {
+			d.pending[key] = queue[1:]
+		}
+		d.locksMu.Unlock()
+
+		if d.logger != nil {
+			d.logger.LogAttrs(slog.LevelInfo, next.project.Name, fmt.Sprintf("Starting pending deployment (%d more pending)", len(queue)-1), next.logAttrs()...)
+		}
+		// Lock ownership and the active build slot pass to the pending run
+		go d.run(next)
+		return
+	}
+	lock.Unlock()
+	// Nothing is running or pending for key any more: drop its entries, so
+	// locks of per-branch local_paths do not pile up
+	delete(d.locks, key)
+	delete(d.pending, key)
+	d.locksMu.Unlock()
+
+	// Track active builds and process pending reload when all builds complete
+	if atomic.AddInt32(&d.activeBuilds, -1) == 0 && d.configManager != nil {
+		d.configManager.ProcessPendingReload()
+	}
+}
+
+// dropInterrupted removes the pending runs of key ended by shutdown and records
+// them as interrupted without starting them. The caller still holds the lock
+// and its active build slot, so shutdown waits until they are recorded.
+func (d *Deployer) dropInterrupted(key deployKey) {
+	var dropped []*deployRequest
+	d.locksMu.Lock()
+	d.pending[key] = slices.DeleteFunc(d.pending[key], func(req *deployRequest) bool {
+		if errors.Is(context.Cause(req.ctx), ErrShutdown) {
+			dropped = append(dropped, req)
+			return true
+		}
+		return false
+	})
+	if len(d.pending[key]) == 0 {
+		delete(d.pending, key)
+	}
+	d.locksMu.Unlock()
+
+	for _, req := range dropped {
+		result := req.newResult()
+		result.Interrupted = true
+		result.Error = fmt.Sprintf("deployment interrupted: %v", ErrShutdown)
+		result.EndTime = result.StartTime
+		if d.logger != nil {
+			d.logger.LogAttrs(slog.LevelWarn, req.project.Name, "Pending deployment interrupted by shutdown", runAttrs(&result)...)
+		}
+		d.recordHistory(req.project, &result)
+		d.metrics.ObserveDeploy(req.project.Name, &result)
+	}
+}
+
+// Cancel cancels the running deployments of a project (one per branch
+// directory) on behalf of by, killing their commands. Pending runs are not
+// affected. Returns the cancelled runs' IDs.
+func (d *Deployer) Cancel(projectPath, by string) ([]string, error) {
+	d.locksMu.Lock()
+	var runs []*runningDeploy
+	for key, run := range d.running {
+		if key.webhookPath == projectPath {
+			runs = append(runs, run)
+		}
+	}
+	d.locksMu.Unlock()
+
+	if len(runs) == 0 {
+		return nil, ErrNotDeploying
+	}
+	runIDs := make([]string, len(runs))
+	for i, run := range runs {
+		run.cancel(&cancelCause{by: by})
+		runIDs[i] = run.runID
+	}
+	sort.Strings(runIDs)
+	return runIDs, nil
+}
+
+// Stream returns the live output stream of a running deployment, or nil if the run is not running
+func (d *Deployer) Stream(runID string) *RunStream {
+	return d.streams.Get(runID)
+}
+
+// CurrentRun returns the ID of the run currently executing for a project, or ""
+func (d *Deployer) CurrentRun(projectPath string) string {
+	return d.streams.Current(projectPath)
+}
+
+// IsDeploying returns true if a deployment currently holds a lock of the project
+func (d *Deployer) IsDeploying(projectPath string) bool {
+	d.locksMu.Lock()
+	defer d.locksMu.Unlock()
+
+	for key, lock := range d.locks {
+		if key.webhookPath != projectPath {
+			continue
+		}
+		// Safe to probe: locks are only acquired and released while holding locksMu
+		if !lock.TryLock() {
+			return true
+		}
 		lock.Unlock()
-		// Track active builds and process pending reload when all builds complete
-		if atomic.AddInt32(&d.activeBuilds, -1) == 0 && d.configManager != nil {
-			d.configManager.ProcessPendingReload()
+	}
+	return false
+}
+
+// PendingCount returns the number of pending runs for a project
+func (d *Deployer) PendingCount(projectPath string) int {
+	d.locksMu.Lock()
+	defer d.locksMu.Unlock()
+
+	count := 0
+	for key, queue := range d.pending {
+		if key.webhookPath == projectPath {
+			count += len(queue)
 		}
+	}
+	return count
+}
+
+// run executes a deployment while holding the project lock, then records
+// and reports the result
+func (d *Deployer) run(req *deployRequest) DeployResult {
+	key := lockKey(req.project)
+	defer d.release(key)
+
+	// Make the run cancellable through Cancel until it finishes
+	ctx, cancel := context.WithCancelCause(req.ctx)
+	defer cancel(nil)
+	req.ctx = ctx
+	d.locksMu.Lock()
+	d.running[key] = &runningDeploy{runID: req.runID, cancel: cancel}
+	d.locksMu.Unlock()
+	defer func() {
+		d.locksMu.Lock()
+		delete(d.running, key)
+		d.locksMu.Unlock()
 	}()
 
-	// Increment active builds counter
-	atomic.AddInt32(&d.activeBuilds, 1)
+	sink := d.openRunOutput(req)
+	result := d.execute(req)
+	d.redactor.redactResult(&result)
+	d.closeRunOutput(req.project, sink, &result)
+	d.recordHistory(req.project, &result)
+	// Unregister the stream only now, so GET /api/runs/{id}/stream finds the
+	// run either live or in history
+	d.streams.close(result.RunID, req.project.WebhookPath, &result)
+	d.metrics.ObserveDeploy(req.project.Name, &result)
+	// Runs skipped for lack of relevant changes send no email
+	if !result.Skipped {
+		d.sendNotification(req.project, &result, req.triggerSource)
+	}
+	return result
+}
+
+// execute performs preflight checks, git operations and the deployment command,
+// then runs the post-deploy hooks for the outcome
+func (d *Deployer) execute(req *deployRequest) (result DeployResult) {
+	ctx, project, triggerSource := req.ctx, req.project, req.triggerSource
+	result = req.newResult()
 
 	if d.logger != nil {
-		d.logger.Infof(project.Name, "Starting deployment (trigger: %s)", triggerSource)
+		d.logger.LogAttrs(slog.LevelInfo, project.Name, fmt.Sprintf("Starting deployment (trigger: %s, run: %s)", triggerSource, req.runID),
+			append(runAttrs(&result), slog.String("branch", result.Branch))...)
+	}
+
+	// Post-deploy hooks run in the build directory once it is known
+	hookDir := getEffectiveExecutePath(project.LocalPath, project.ExecutePath)
+	if project.ReleaseMode {
+		hookDir = project.LocalPath
+	}
+	defer func() {
+		d.markStopped(ctx, project, &result)
+		d.runPostDeployHooks(ctx, project, &result, hookDir)
+	}()
+
+	// Keep sdeploy rollback from switching releases until the run is done
+	if project.ReleaseMode {
+		defer d.lockReleases(ctx, project)()
 	}
 
 	// Log build config
-	d.logBuildConfig(project)
+	d.logBuildConfig(ctx, project)
 
 	// Run preflight checks (directory existence, ownership, permissions)
 	if err := runPreflightChecks(ctx, project, d.logger); err != nil {
 		result.Error = err.Error()
+		result.ExitCode = -1
 		result.EndTime = time.Now()
 		if d.logger != nil {
-			d.logger.Errorf(project.Name, "Preflight checks failed: %v", err)
+			d.logger.ErrorfContext(ctx, project.Name, "Preflight checks failed: %v", err)
 		}
-		d.sendNotification(project, &result, triggerSource)
 		return result
 	}
 
-	// Git operations (if git_repo is configured)
+	// Git operations (if git_repo is configured).
+	// In release_mode, git works on a dedicated repo directory under local_path.
+	// A tag deployment checks out the tag rather than the announced commit
+	targetCommit := req.targetCommit()
+	if result.Tag != "" {
+		targetCommit = ""
+	}
+	gitProject := project
+	if project.ReleaseMode {
+		repoProject := *project
+		repoProject.LocalPath = releaseRepoPath(project)
+		gitProject = &repoProject
+	}
 	if project.GitRepo != "" {
-		if err := d.handleGitOperations(ctx, project); err != nil {
+		if err := d.handleGitOperations(ctx, gitProject, targetCommit, result.Tag); err != nil {
 			result.Error = err.Error()
+			result.ExitCode = -1
+			result.EndTime = time.Now()
+			return result
+		}
+		result.Commit = gitHeadCommit(ctx, gitProject.LocalPath)
+		if targetCommit != "" && result.Commit != "" && result.Commit != targetCommit && d.logger != nil {
+			d.logger.WarnfContext(ctx, project.Name, "Deploying commit %s, webhook announced %s (git_strategy: %s)", result.Commit, targetCommit, project.GitStrategy)
+		}
+		if req.filtersChangedPaths() && !d.hasRelevantChanges(ctx, project, gitProject.LocalPath, req.event.Before) {
+			result.Skipped = true
 			result.EndTime = time.Now()
-			d.sendNotification(project, &result, triggerSource)
 			return result
 		}
 	} else {
 		if d.logger != nil {
-			d.logger.Infof(project.Name, "No git_repo configured, treating local_path as local directory")
+			d.logger.InfofContext(ctx, project.Name, "No git_repo configured, treating local_path as local directory")
+		}
+		result.Commit = targetCommit
+	}
+
+	// Get effective execute_path (defaults to local_path if not set)
+	executePath := getEffectiveExecutePath(project.LocalPath, project.ExecutePath)
+
+	// Export the commit into a fresh release directory and build there
+	if project.ReleaseMode {
+		releaseDir, err := createRelease(ctx, project, result.Commit)
+		if err != nil {
+			result.Error = err.Error()
+			result.ExitCode = -1
+			result.EndTime = time.Now()
+			if d.logger != nil {
+				d.logger.ErrorfContext(ctx, project.Name, "Failed to create release: %v", err)
+			}
+			return result
+		}
+		result.ReleaseDir = releaseDir
+		executePath = filepath.Join(releaseDir, project.ExecutePath)
+		if d.logger != nil {
+			d.logger.InfofContext(ctx, project.Name, "Created release %s", releaseDir)
 		}
 	}
 
-	// Execute deployment command
-	output, err := d.executeCommand(ctx, project, triggerSource)
+	hookDir = executePath
+	env := deployEnv(project, &result)
+
+	// Execute pre_deploy hook, then the deployment command or the steps pipeline
+	var output string
+	err := d.runHook(ctx, project, &result, HookPreDeploy, project.Hooks.PreDeploy, executePath, env)
+	if err != nil {
+		err = fmt.Errorf("%s hook failed: %w", HookPreDeploy, err)
+	} else if len(project.Steps) > 0 {
+		result.Steps, output, err = d.executeSteps(ctx, project, executePath, env)
+	} else {
+		output, err = d.executeCommand(ctx, project, executePath, env)
+	}
 	result.Output = output
+
+	// Switch the live release only after a successful build
+	previousRelease := ""
+	if project.ReleaseMode {
+		if err == nil {
+			previousRelease = currentRelease(project)
+			err = d.finishRelease(ctx, project, result.ReleaseDir)
+		} else {
+			d.discardRelease(ctx, project, result.ReleaseDir)
+		}
+	}
+
+	// Verify the deployed service responds, rolling back if it never does
+	if err == nil && project.HealthCheck != nil {
+		if err = d.runHealthCheck(ctx, project, &result); err != nil {
+			d.rollback(ctx, project, &result, previousRelease, executePath, env)
+		}
+	}
+
+	// Prune old releases once the new one is live; a failed release directory
+	// has been removed, so post-deploy hooks run in local_path instead
+	if project.ReleaseMode {
+		if err == nil {
+			d.pruneReleases(ctx, project)
+		} else {
+			hookDir = project.LocalPath
+		}
+	}
+
+	result.ExitCode = exitCodeFromError(err)
+	result.TimedOut = errors.Is(err, errCommandTimeout)
+	result.KillSignal = killSignal(err)
 	result.EndTime = time.Now()
 
 	if err != nil {
 		result.Success = false
 		result.Error = err.Error()
 		if d.logger != nil {
-			d.logger.Errorf(project.Name, "Deployment failed: %v", err)
-			d.logCommandOutput(project.Name, output, true)
+			d.logger.LogAttrs(slog.LevelError, project.Name, fmt.Sprintf("Deployment failed: %v", err),
+				append(runAttrs(&result), outcomeAttrs(&result)...)...)
 		}
 	} else {
 		result.Success = true
 		if d.logger != nil {
-			// Log command output BEFORE "Deployment completed" message
-			d.logCommandOutput(project.Name, output, false)
-			d.logger.Infof(project.Name, "Deployment completed in %v", result.Duration())
+			d.logger.LogAttrs(slog.LevelInfo, project.Name, fmt.Sprintf("Deployment completed in %v", result.Duration()),
+				append(runAttrs(&result), outcomeAttrs(&result)...)...)
 		}
 	}
 
-	d.sendNotification(project, &result, triggerSource)
 	return result
 }
 
-// logCommandOutput logs the command output if it's not empty
-func (d *Deployer) logCommandOutput(projectName, output string, isError bool) {
-	if d.logger == nil {
+// markStopped records in result that the run was cancelled or interrupted by
+// shutdown, unless it had already succeeded when the stop arrived
+func (d *Deployer) markStopped(ctx context.Context, project *ProjectConfig, result *DeployResult) {
+	if result.Success {
 		return
 	}
-	if trimmedOutput := strings.TrimSpace(output); trimmedOutput != "" {
-		if isError {
-			d.logger.Errorf(projectName, "Command output: %s", trimmedOutput)
-		} else {
-			d.logger.Infof(projectName, "Command output: %s", trimmedOutput)
+
+	var message string
+	var cancelled *cancelCause
+	switch cause := context.Cause(ctx); {
+	case errors.As(cause, &cancelled):
+		result.Cancelled = true
+		result.CancelledBy = cancelled.by
+		result.Error = cancelled.Error()
+		message = fmt.Sprintf("Deployment cancelled by %s", cancelled.by)
+	case errors.Is(cause, ErrShutdown):
+		result.Interrupted = true
+		result.Error = fmt.Sprintf("deployment interrupted: %v", cause)
+		message = "Deployment interrupted by shutdown"
+	default:
+		return
+	}
+
+	result.TimedOut = false
+	if result.EndTime.IsZero() {
+		result.EndTime = time.Now()
+	}
+	if d.logger != nil {
+		d.logger.LogAttrs(slog.LevelWarn, project.Name, message, runAttrs(result)...)
+	}
+}
+
+// openRunLog creates the run's log file and writes its header.
+// Returns nil if run logs are disabled or the file cannot be created.
+func (d *Deployer) openRunLog(req *deployRequest) *os.File {
+	if d.runLogs == nil {
+		return nil
+	}
+	file, err := d.runLogs.Create(projectKey(req.project), req.runID)
+	if err != nil {
+		if d.logger != nil {
+			d.logger.WarnfContext(req.ctx, req.project.Name, "Run log disabled for this run: %v", err)
 		}
+		return nil
+	}
+	fmt.Fprintf(file, "# Run %s of %s (trigger: %s, branch: %s) started %s\n",
+		req.runID, req.project.Name, req.triggerSource, req.project.GitBranch, time.Now().Format(time.RFC3339))
+	return file
+}
+
+// closeRunLog writes the run's outcome, closes its log file and prunes old run logs
+func (d *Deployer) closeRunLog(project *ProjectConfig, file *os.File, result *DeployResult) {
+	result.LogFile = file.Name()
+	fmt.Fprintf(file, "# Run %s finished %s: %s in %v (exit code %d)\n",
+		result.RunID, result.EndTime.Format(time.RFC3339), result.Status(), result.Duration(), result.ExitCode)
+	if result.Error != "" {
+		fmt.Fprintf(file, "# Error: %s\n", result.Error)
+	}
+	file.Close()
+
+	if err := d.runLogs.Prune(projectKey(project), project.RunLogKeep, project.RunLogMaxAge, time.Now()); err != nil {
+		if d.logger != nil {
+			d.logger.LogAttrs(slog.LevelWarn, project.Name, fmt.Sprintf("Failed to prune run logs: %v", err), runAttrs(result)...)
+		}
+	}
+}
+
+// recordHistory persists the result to the history store if one is configured
+func (d *Deployer) recordHistory(project *ProjectConfig, result *DeployResult) {
+	if d.history == nil {
+		return
+	}
+	keep := project.HistoryLimit
+	if keep <= 0 {
+		keep = Defaults.HistoryLimit
+	}
+	if err := d.history.Record(projectKey(project), result, keep); err != nil {
+		if d.logger != nil {
+			d.logger.LogAttrs(slog.LevelError, project.Name, fmt.Sprintf("Failed to record deployment history: %v", err), runAttrs(result)...)
+		}
+	}
+}
+
+// exitCodeFromError returns the process exit code for err (0 for nil, -1 if unknown)
+func exitCodeFromError(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// runAttrs returns the structured log attributes identifying a deployment run
+func runAttrs(result *DeployResult) []slog.Attr {
+	return []slog.Attr{
+		slog.String("run_id", result.RunID),
+		slog.String("trigger", result.TriggerSource),
+	}
+}
+
+// outcomeAttrs returns the structured log attributes describing a finished deployment
+func outcomeAttrs(result *DeployResult) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Int64("duration_ms", result.Duration().Milliseconds()),
+		slog.Int("exit_code", result.ExitCode),
+	}
+	if result.Commit != "" {
+		attrs = append(attrs, slog.String("commit", result.Commit))
+	}
+	if result.ReleaseDir != "" {
+		attrs = append(attrs, slog.String("release_dir", result.ReleaseDir))
+	}
+	if result.Error != "" {
+		attrs = append(attrs, slog.String("error", result.Error))
+	}
+	return attrs
+}
+
+// logOutputLine logs one line of command output as it is produced, stderr
+// lines at ERROR. In JSON format the line is an "output" attribute alongside
+// the run attributes and stream.
+func (d *Deployer) logOutputLine(ctx context.Context, projectName, stream, line string) {
+	if d.logger == nil {
+		return
 	}
+	line = strings.TrimRight(displayLine(line), " \t")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	level := slog.LevelInfo
+	if stream == "stderr" {
+		level = slog.LevelError
+	}
+	if d.logger.IsJSON() {
+		attrs := append(runContextAttrs(ctx), slog.String("stream", stream), slog.String("output", line))
+		d.logger.LogAttrs(level, projectName, "Command output", attrs...)
+		return
+	}
+	d.logger.LogAttrs(level, projectName, "Command output: "+line)
 }
 
 // logBuildConfig logs the project configuration at the start of a build
-func (d *Deployer) logBuildConfig(project *ProjectConfig) {
+func (d *Deployer) logBuildConfig(ctx context.Context, project *ProjectConfig) {
 	if d.logger == nil {
 		return
 	}
@@ -184,64 +916,99 @@ func (d *Deployer) logBuildConfig(project *ProjectConfig) {
 	if project.GitSSHKeyPath != "" {
 		sshKeyStatus = "configured"
 	}
-	d.logger.Infof(project.Name, "Build config: name=%s, local_path=%s, git_repo=%s, git_branch=%s, git_update=%t, git_ssh_key=%s, execute_path=%s, execute_command=%s",
+	d.logger.InfofContext(ctx, project.Name, "Build config: name=%s, local_path=%s, git_repo=%s, git_branch=%s, git_update=%t, git_strategy=%s, git_ssh_key=%s, execute_path=%s, execute_command=%s",
 		project.Name,
 		project.LocalPath,
 		project.GitRepo,
 		project.GitBranch,
 		project.GitUpdate,
+		project.GitStrategy,
 		sshKeyStatus,
 		project.ExecutePath,
 		project.ExecuteCommand,
 	)
 }
 
-// handleGitOperations handles git clone/pull based on configuration
-func (d *Deployer) handleGitOperations(ctx context.Context, project *ProjectConfig) error {
+// handleGitOperations handles git clone/pull based on configuration.
+// With git_strategy fetch_reset, the working tree is reset to targetCommit
+// (or the fetched branch tip when targetCommit is empty).
+func (d *Deployer) handleGitOperations(ctx context.Context, project *ProjectConfig, targetCommit, tag string) error {
 	// Validate SSH key if configured
 	if project.GitSSHKeyPath != "" {
 		if err := validateSSHKeyPath(project.GitSSHKeyPath); err != nil {
 			if d.logger != nil {
-				d.logger.Errorf(project.Name, "SSH key validation failed: %v", err)
+				d.logger.ErrorfContext(ctx, project.Name, "SSH key validation failed: %v", err)
 			}
 			return fmt.Errorf("SSH key validation failed: %v", err)
 		}
 		if d.logger != nil {
-			d.logger.Infof(project.Name, "Using SSH key for git operations")
+			d.logger.InfofContext(ctx, project.Name, "Using SSH key for git operations")
 		}
 	}
 
+	if tag != "" && !isSafeRefName(tag) {
+		return fmt.Errorf("invalid tag name %q", tag)
+	}
+
 	// Check if local_path exists and is a git repo
 	if !isGitRepo(project.LocalPath) {
 		// Need to clone
 		if err := d.gitClone(ctx, project); err != nil {
 			if d.logger != nil {
-				d.logger.Errorf(project.Name, "Git clone failed: %v", err)
+				d.logger.ErrorfContext(ctx, project.Name, "Git clone failed: %v", err)
 			}
 			return fmt.Errorf("git clone failed: %v", err)
 		}
 		if d.logger != nil {
-			d.logger.Infof(project.Name, "Cloned repository to %s", project.LocalPath)
+			d.logger.InfofContext(ctx, project.Name, "Cloned repository to %s", project.LocalPath)
 		}
-	} else {
+		// Pin the fresh clone to the announced commit
+		if project.GitStrategy == GitStrategyFetchReset && targetCommit != "" {
+			if err := d.runGitCommand(ctx, project, fmt.Sprintf("git reset --hard %s", targetCommit)); err != nil {
+				if d.logger != nil {
+					d.logger.ErrorfContext(ctx, project.Name, "Git reset failed: %v", err)
+				}
+				return fmt.Errorf("git reset failed: %v", err)
+			}
+		}
+	} else if tag == "" {
 		if d.logger != nil {
-			d.logger.Infof(project.Name, "Repository already cloned at %s", project.LocalPath)
+			d.logger.InfofContext(ctx, project.Name, "Repository already cloned at %s", project.LocalPath)
 		}
 		// Check if we should do git pull
-		if project.GitUpdate {
+		if project.GitUpdate && project.GitStrategy == GitStrategyFetchReset {
+			if err := d.gitFetchReset(ctx, project, targetCommit); err != nil {
+				if d.logger != nil {
+					d.logger.ErrorfContext(ctx, project.Name, "Git fetch/reset failed: %v", err)
+				}
+				return fmt.Errorf("git fetch/reset failed: %v", err)
+			}
+		} else if project.GitUpdate {
 			if err := d.gitPull(ctx, project); err != nil {
 				if d.logger != nil {
-					d.logger.Errorf(project.Name, "Git pull failed: %v", err)
+					d.logger.ErrorfContext(ctx, project.Name, "Git pull failed: %v", err)
 				}
 				return fmt.Errorf("git pull failed: %v", err)
 			}
 			if d.logger != nil {
-				d.logger.Infof(project.Name, "Executed git pull")
+				d.logger.InfofContext(ctx, project.Name, "Executed git pull")
 			}
 		} else {
 			if d.logger != nil {
-				d.logger.Infof(project.Name, "git_update is false, skipping git pull")
+				d.logger.InfofContext(ctx, project.Name, "git_update is false, skipping git pull")
+			}
+		}
+	} else if d.logger != nil {
+		d.logger.InfofContext(ctx, project.Name, "Repository already cloned at %s", project.LocalPath)
+	}
+
+	// Tag deployments fetch and check out the tag, whatever git_update says
+	if tag != "" {
+		if err := d.gitCheckoutTag(ctx, project, tag); err != nil {
+			if d.logger != nil {
+				d.logger.ErrorfContext(ctx, project.Name, "Git checkout of tag %s failed: %v", tag, err)
 			}
+			return fmt.Errorf("git checkout of tag %s failed: %v", tag, err)
 		}
 	}
 	return nil
@@ -260,6 +1027,41 @@ func isGitRepo(path string) bool {
 	return info.IsDir()
 }
 
+// hasRelevantChanges reports whether the files changed since a commit include
+// any matching the project's path filters. When the changed files cannot be
+// listed (e.g., a new branch or a force push), the project is deployed.
+func (d *Deployer) hasRelevantChanges(ctx context.Context, project *ProjectConfig, repoPath, since string) bool {
+	files, err := gitChangedFiles(ctx, repoPath, since)
+	if err != nil {
+		if d.logger != nil {
+			d.logger.WarnfContext(ctx, project.Name, "Cannot list changed files for path filters, deploying: %v", err)
+		}
+		return true
+	}
+	if len(project.relevantFiles(files)) > 0 {
+		return true
+	}
+	if d.logger != nil {
+		d.logger.InfofContext(ctx, project.Name, "No relevant changes: none of %d files changed since %s match %s. Skipping.", len(files), since, project.pathFilterDescription())
+	}
+	return false
+}
+
+// gitHeadCommit returns the commit checked out at path, or "" if it cannot be resolved
+func gitHeadCommit(ctx context.Context, path string) string {
+	if !isGitRepo(path) {
+		return ""
+	}
+	cmd := buildCommand(ctx, "git rev-parse HEAD")
+	setProcessGroup(cmd)
+	cmd.Dir = path
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
 // buildGitSSHCommand creates the SSH command string for git operations
 func buildGitSSHCommand(sshKeyPath string) string {
 	return fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=accept-new -o IdentitiesOnly=yes", sshKeyPath)
@@ -275,7 +1077,7 @@ func (d *Deployer) gitClone(ctx context.Context, project *ProjectConfig) error {
 
 	gitCmd := fmt.Sprintf("git clone --branch %s %s %s", project.GitBranch, project.GitRepo, project.LocalPath)
 	if d.logger != nil {
-		d.logger.Infof(project.Name, "Running: %s", gitCmd)
+		d.logger.InfofContext(ctx, project.Name, "Running: %s", gitCmd)
 	}
 
 	// Build the command
@@ -290,9 +1092,10 @@ func (d *Deployer) gitClone(ctx context.Context, project *ProjectConfig) error {
 	}
 
 	output, err := cmd.CombinedOutput()
+	writeRunOutput(ctx, gitCmd, output)
 
 	if d.logger != nil && len(output) > 0 {
-		d.logger.Infof(project.Name, "Output: %s", strings.TrimSpace(string(output)))
+		d.logger.InfofContext(ctx, project.Name, "Output: %s", strings.TrimSpace(string(output)))
 	}
 
 	if err != nil {
@@ -302,15 +1105,129 @@ func (d *Deployer) gitClone(ctx context.Context, project *ProjectConfig) error {
 	return nil
 }
 
+// writeRunOutput copies a finished command and its output to the run's output
+func writeRunOutput(ctx context.Context, command string, output []byte) {
+	out := runOutput(ctx)
+	fmt.Fprintf(out, "$ %s\n", command)
+	if len(output) > 0 {
+		out.Write(output)
+		if output[len(output)-1] != '\n' {
+			fmt.Fprintln(out)
+		}
+	}
+}
+
 // gitPull executes git pull in the project's local path
 func (d *Deployer) gitPull(ctx context.Context, project *ProjectConfig) error {
+	if err := d.gitCheckoutBranch(ctx, project); err != nil {
+		return err
+	}
+	return d.runGitCommand(ctx, project, "git pull")
+}
+
+// gitCheckoutBranch checks out git_branch when another branch, or a tag
+// deployment's detached HEAD, is checked out, e.g. when branches share a local_path
+func (d *Deployer) gitCheckoutBranch(ctx context.Context, project *ProjectConfig) error {
+	if gitCurrentBranch(ctx, project.LocalPath) == project.GitBranch {
+		return nil
+	}
+	if !hasLocalBranch(ctx, project.LocalPath, project.GitBranch) {
+		// Branches created after the clone have no remote-tracking ref yet
+		ref := "refs/remotes/origin/" + project.GitBranch
+		if err := d.runGitCommand(ctx, project, fmt.Sprintf("git fetch origin +refs/heads/%s:%s", project.GitBranch, ref)); err != nil {
+			return err
+		}
+		return d.runGitCommand(ctx, project, fmt.Sprintf("git checkout --force -b %s --track origin/%s", project.GitBranch, project.GitBranch))
+	}
+	return d.runGitCommand(ctx, project, fmt.Sprintf("git checkout --force %s", project.GitBranch))
+}
+
+// gitCheckoutTag fetches a tag from origin, replacing a moved tag, and checks
+// it out as a detached HEAD, discarding local changes like git_strategy: fetch_reset
+func (d *Deployer) gitCheckoutTag(ctx context.Context, project *ProjectConfig, tag string) error {
+	ref := "refs/tags/" + tag
+	if err := d.runGitCommand(ctx, project, fmt.Sprintf("git fetch --force origin %s:%s", ref, ref)); err != nil {
+		return err
+	}
+	if err := d.runGitCommand(ctx, project, fmt.Sprintf("git checkout --force --detach %s", ref)); err != nil {
+		return err
+	}
+
 	if d.logger != nil {
-		d.logger.Infof(project.Name, "Running: git pull")
-		d.logger.Infof(project.Name, "Path: %s", project.LocalPath)
+		d.logger.InfofContext(ctx, project.Name, "Checked out tag %s in %s", tag, project.LocalPath)
+	}
+	return nil
+}
+
+// gitCurrentBranch returns the branch checked out in the repository at path,
+// or "" when HEAD is detached
+func gitCurrentBranch(ctx context.Context, path string) string {
+	cmd := buildCommand(ctx, "git symbolic-ref --short -q HEAD")
+	setProcessGroup(cmd)
+	cmd.Dir = path
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// hasLocalBranch reports whether the repository at path has a local branch of the given name
+func hasLocalBranch(ctx context.Context, path, branch string) bool {
+	cmd := buildCommand(ctx, fmt.Sprintf("git rev-parse --verify -q refs/heads/%s", branch))
+	setProcessGroup(cmd)
+	cmd.Dir = path
+	return cmd.Run() == nil
+}
+
+// isSafeRefName checks that a tag or branch name from a webhook payload is a
+// valid git ref name that needs no shell quoting
+func isSafeRefName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "/") ||
+		strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".lock") || strings.Contains(name, "..") {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._/+-", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// gitFetchReset fetches the configured branch and hard-resets the working tree
+// to targetCommit, or to the fetched branch tip when targetCommit is empty
+func (d *Deployer) gitFetchReset(ctx context.Context, project *ProjectConfig, targetCommit string) error {
+	if err := d.gitCheckoutBranch(ctx, project); err != nil {
+		return err
+	}
+	if err := d.runGitCommand(ctx, project, fmt.Sprintf("git fetch origin %s", project.GitBranch)); err != nil {
+		return err
+	}
+
+	target := "FETCH_HEAD"
+	if targetCommit != "" {
+		target = targetCommit
+	}
+	if err := d.runGitCommand(ctx, project, fmt.Sprintf("git reset --hard %s", target)); err != nil {
+		return err
+	}
+
+	if d.logger != nil {
+		d.logger.InfofContext(ctx, project.Name, "Reset %s to %s", project.LocalPath, target)
+	}
+	return nil
+}
+
+// runGitCommand runs a git command in the project's local path
+func (d *Deployer) runGitCommand(ctx context.Context, project *ProjectConfig, gitCmd string) error {
+	if d.logger != nil {
+		d.logger.InfofContext(ctx, project.Name, "Running: %s", gitCmd)
+		d.logger.InfofContext(ctx, project.Name, "Path: %s", project.LocalPath)
 	}
 
 	// Build the command
-	cmd := buildCommand(ctx, "git pull")
+	cmd := buildCommand(ctx, gitCmd)
 
 	// Set process group so we can kill all child processes
 	setProcessGroup(cmd)
@@ -323,9 +1240,10 @@ func (d *Deployer) gitPull(ctx context.Context, project *ProjectConfig) error {
 	}
 
 	output, err := cmd.CombinedOutput()
+	writeRunOutput(ctx, gitCmd, output)
 
 	if d.logger != nil && len(output) > 0 {
-		d.logger.Infof(project.Name, "Output: %s", strings.TrimSpace(string(output)))
+		d.logger.InfofContext(ctx, project.Name, "Output: %s", strings.TrimSpace(string(output)))
 	}
 
 	if err != nil {
@@ -335,49 +1253,110 @@ func (d *Deployer) gitPull(ctx context.Context, project *ProjectConfig) error {
 	return nil
 }
 
-// executeCommand runs the deployment command
-func (d *Deployer) executeCommand(ctx context.Context, project *ProjectConfig, triggerSource string) (string, error) {
+// isCommitSHA checks that s looks like an abbreviated or full git commit SHA
+func isCommitSHA(s string) bool {
+	if len(s) < 7 || len(s) > 64 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// deployEnv returns the SDEPLOY_* environment variables passed to deployment commands
+func deployEnv(project *ProjectConfig, result *DeployResult) []string {
+	env := []string{
+		fmt.Sprintf("SDEPLOY_PROJECT_NAME=%s", project.Name),
+		fmt.Sprintf("SDEPLOY_TRIGGER_SOURCE=%s", result.TriggerSource),
+		fmt.Sprintf("SDEPLOY_GIT_BRANCH=%s", project.GitBranch),
+		fmt.Sprintf("SDEPLOY_GIT_COMMIT=%s", result.Commit),
+		fmt.Sprintf("SDEPLOY_GIT_TAG=%s", result.Tag),
+		fmt.Sprintf("SDEPLOY_RUN_ID=%s", result.RunID),
+	}
+	if result.ReleaseDir != "" {
+		env = append(env, fmt.Sprintf("SDEPLOY_RELEASE_DIR=%s", result.ReleaseDir))
+	}
+	return append(env, envPairs(project.branchEnv)...)
+}
+
+// commandSpec describes a shell command run by the deployer
+type commandSpec struct {
+	command        string
+	dir            string   // Working directory ("" or "." = current directory)
+	timeoutSeconds int      // 0 = no timeout
+	env            []string // Extra environment variables (KEY=value)
+}
+
+// executeCommand runs the deployment command in executePath with the given extra environment
+func (d *Deployer) executeCommand(ctx context.Context, project *ProjectConfig, executePath string, env []string) (string, error) {
+	return d.runCommand(ctx, project, commandSpec{
+		command:        project.ExecuteCommand,
+		dir:            executePath,
+		timeoutSeconds: project.TimeoutSeconds,
+		env:            env,
+	})
+}
+
+// runCommand runs a shell command in its own process group, killing the group
+// on timeout or cancellation, and returns the combined output
+func (d *Deployer) runCommand(ctx context.Context, project *ProjectConfig, spec commandSpec) (string, error) {
 	// Create context with timeout if configured
 	var cancel context.CancelFunc
-	if project.TimeoutSeconds > 0 {
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(project.TimeoutSeconds)*time.Second)
+	if spec.timeoutSeconds > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(spec.timeoutSeconds)*time.Second)
 		defer cancel()
 	}
 
 	// Log the command being executed with path
-	// Get effective execute_path (defaults to local_path if not set)
-	executePath := getEffectiveExecutePath(project.LocalPath, project.ExecutePath)
+	executePath := spec.dir
 	if executePath == "" {
 		executePath = "."
 	}
 	if d.logger != nil {
-		d.logger.Infof(project.Name, "Executing command:")
-		d.logger.Infof(project.Name, "  Path: %s", executePath)
-		d.logger.Infof(project.Name, "  Command: %s", project.ExecuteCommand)
+		if d.logger.IsJSON() {
+			d.logger.LogAttrs(slog.LevelInfo, project.Name, "Executing command", append(runContextAttrs(ctx),
+				slog.String("path", executePath), slog.String("command", spec.command), slog.Int("timeout_seconds", spec.timeoutSeconds))...)
+		} else {
+			d.logger.InfofContext(ctx, project.Name, "Executing command:")
+			d.logger.InfofContext(ctx, project.Name, "  Path: %s", executePath)
+			d.logger.InfofContext(ctx, project.Name, "  Command: %s", spec.command)
+		}
 	}
 
-	// Build the command
-	cmd := buildCommand(ctx, project.ExecuteCommand)
+	// Build the command. Termination on timeout or cancellation is handled
+	// below with a grace period, instead of exec killing the shell at once.
+	cmd := buildCommand(ctx, spec.command)
+	cmd.Cancel = func() error { return nil }
 
 	// Set process group so we can kill all child processes
 	setProcessGroup(cmd)
 
-	// Set working directory to effective execute_path
+	// Set working directory
 	if executePath != "." {
 		cmd.Dir = executePath
 	}
 
 	// Set environment variables
-	cmd.Env = append(os.Environ(),
-		fmt.Sprintf("SDEPLOY_PROJECT_NAME=%s", project.Name),
-		fmt.Sprintf("SDEPLOY_TRIGGER_SOURCE=%s", triggerSource),
-		fmt.Sprintf("SDEPLOY_GIT_BRANCH=%s", project.GitBranch),
-	)
+	cmd.Env = append(os.Environ(), spec.env...)
 
-	// Capture output
+	// Capture output line by line as it is produced, copying each line to the
+	// run's output and the log
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	out := runOutput(ctx)
+	fmt.Fprintf(out, "$ %s (in %s)\n", spec.command, executePath)
+	stdoutLines := newLineWriter(func(line string) {
+		fmt.Fprintln(out, line)
+		d.logOutputLine(ctx, project.Name, "stdout", line)
+	})
+	stderrLines := newLineWriter(func(line string) {
+		fmt.Fprintln(out, line)
+		d.logOutputLine(ctx, project.Name, "stderr", line)
+	})
+	cmd.Stdout = io.MultiWriter(&stdout, stdoutLines)
+	cmd.Stderr = io.MultiWriter(&stderr, stderrLines)
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
@@ -390,21 +1369,114 @@ func (d *Deployer) executeCommand(ctx context.Context, project *ProjectConfig, t
 		done <- cmd.Wait()
 	}()
 
+	var err error
+	interrupted := false
 	select {
 	case <-ctx.Done():
-		// Kill the entire process group
-		killProcessGroup(cmd)
-		<-done // Wait for the process to actually exit
-		return stdout.String() + stderr.String(), fmt.Errorf("command timed out after %d seconds", project.TimeoutSeconds)
-	case err := <-done:
-		output := stdout.String()
-		if stderr.Len() > 0 {
-			if output != "" {
-				output += "\n"
+		// Stop the entire process group: SIGTERM, then SIGKILL after the grace period
+		reason := interruptError(ctx, spec.timeoutSeconds)
+		grace := project.killGrace()
+		if d.logger != nil {
+			if grace > 0 {
+				d.logger.WarnfContext(ctx, project.Name, "Stopping command (%v): sent SIGTERM, SIGKILL after %v", reason, grace)
+			} else {
+				d.logger.WarnfContext(ctx, project.Name, "Stopping command (%v): sending SIGKILL", reason)
 			}
-			output += stderr.String()
 		}
-		return output, err
+		signal := stopProcessGroup(cmd, grace, done)
+		if d.logger != nil {
+			d.logger.LogAttrs(slog.LevelWarn, project.Name, fmt.Sprintf("Command ended by %s", signal),
+				append(runContextAttrs(ctx), slog.String("signal", signal))...)
+		}
+		err = &killedError{err: reason, signal: signal}
+		interrupted = true
+	case err = <-done:
+	}
+
+	// Wait has returned, so no more output is copied; emit unterminated last lines
+	stdoutLines.Flush()
+	stderrLines.Flush()
+
+	if interrupted {
+		return stdout.String() + stderr.String(), err
+	}
+	output := stdout.String()
+	if stderr.Len() > 0 {
+		if output != "" {
+			output += "\n"
+		}
+		output += stderr.String()
+	}
+	return output, err
+}
+
+// runStopped reports whether the run was cancelled through the API or CLI,
+// or interrupted because sdeploy is shutting down
+func runStopped(ctx context.Context) bool {
+	cause := context.Cause(ctx)
+	return errors.Is(cause, errDeployCancelled) || errors.Is(cause, ErrShutdown)
+}
+
+// interruptError returns why a command's context ended: the run was
+// cancelled, sdeploy is shutting down, or the command exceeded its timeout
+func interruptError(ctx context.Context, timeoutSeconds int) error {
+	if runStopped(ctx) {
+		return context.Cause(ctx)
+	}
+	return fmt.Errorf("%w after %d seconds", errCommandTimeout, timeoutSeconds)
+}
+
+// lockReleases takes the release lock of a release_mode project, waiting for
+// a running sdeploy rollback. Returns the function releasing it; without a
+// state directory, or if the lock cannot be taken, the run goes ahead unlocked.
+func (d *Deployer) lockReleases(ctx context.Context, project *ProjectConfig) func() {
+	if d.stateDir == "" {
+		return func() {}
+	}
+	unlock, err := lockReleases(d.stateDir, project, true)
+	if err != nil {
+		if d.logger != nil {
+			d.logger.WarnfContext(ctx, project.Name, "Release lock unavailable, sdeploy rollback is not blocked: %v", err)
+		}
+		return func() {}
+	}
+	return unlock
+}
+
+// finishRelease switches "current" to a successfully built release
+func (d *Deployer) finishRelease(ctx context.Context, project *ProjectConfig, releaseDir string) error {
+	if err := activateRelease(project, releaseDir); err != nil {
+		if d.logger != nil {
+			d.logger.ErrorfContext(ctx, project.Name, "Failed to activate release: %v", err)
+		}
+		d.discardRelease(ctx, project, releaseDir)
+		return err
+	}
+	if d.logger != nil {
+		d.logger.InfofContext(ctx, project.Name, "Activated release %s", filepath.Base(releaseDir))
+	}
+	return nil
+}
+
+// pruneReleases removes releases beyond keep_releases
+func (d *Deployer) pruneReleases(ctx context.Context, project *ProjectConfig) {
+	removed, err := pruneReleases(project, project.KeepReleases)
+	if err != nil && d.logger != nil {
+		d.logger.WarnfContext(ctx, project.Name, "Failed to prune old releases: %v", err)
+	}
+	if len(removed) > 0 && d.logger != nil {
+		d.logger.InfofContext(ctx, project.Name, "Pruned %d old release(s)", len(removed))
+	}
+}
+
+// discardRelease removes a release directory whose build failed
+func (d *Deployer) discardRelease(ctx context.Context, project *ProjectConfig, releaseDir string) {
+	if err := os.RemoveAll(releaseDir); err != nil && d.logger != nil {
+		d.logger.WarnfContext(ctx, project.Name, "Failed to remove release %s: %v", releaseDir, err)
+		return
+	}
+	if d.logger != nil {
+		d.logger.InfofContext(ctx, project.Name, "Removed failed release %s", filepath.Base(releaseDir))
 	}
 }
 
@@ -416,7 +1488,7 @@ func (d *Deployer) sendNotification(project *ProjectConfig, result *DeployResult
 
 	if err := d.notifier.SendNotification(project, result, triggerSource); err != nil {
 		if d.logger != nil {
-			d.logger.Errorf(project.Name, "Failed to send email notification: %v", err)
+			d.logger.LogAttrs(slog.LevelError, project.Name, fmt.Sprintf("Failed to send email notification: %v", err), runAttrs(result)...)
 		}
 	}
 }
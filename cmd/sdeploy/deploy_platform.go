@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"syscall"
+	"time"
 )
 
 // setProcessGroup sets the command to run in its own process group (Unix only)
@@ -18,6 +19,17 @@ func setProcessGroup(cmd *exec.Cmd) {
 	}
 }
 
+// flockFile takes an exclusive advisory lock on file, failing with
+// syscall.EWOULDBLOCK instead of waiting unless wait is set (Unix only).
+// Closing the file releases the lock.
+func flockFile(file *os.File, wait bool) error {
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	return syscall.Flock(int(file.Fd()), how)
+}
+
 // killProcessGroup kills the process group (Unix only)
 func killProcessGroup(cmd *exec.Cmd) {
 	if cmd.Process != nil {
@@ -25,6 +37,28 @@ func killProcessGroup(cmd *exec.Cmd) {
 	}
 }
 
+// stopProcessGroup sends SIGTERM to the process group and escalates to SIGKILL
+// if the process has not exited after grace (immediately if grace is 0).
+// done must receive the result of cmd.Wait. Returns the signal that ended the process.
+func stopProcessGroup(cmd *exec.Cmd, grace time.Duration, done <-chan error) string {
+	if cmd.Process == nil {
+		return ""
+	}
+	if grace > 0 {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-done:
+			return "SIGTERM"
+		case <-timer.C:
+		}
+	}
+	killProcessGroup(cmd)
+	<-done
+	return "SIGKILL"
+}
+
 // getShellPath returns the path to the shell executable (Unix implementation)
 // It first tries to find "sh" in PATH, then falls back to common shell locations
 func getShellPath() string {
@@ -73,7 +107,7 @@ func ensureParentDirExists(ctx context.Context, parentDir string, logger *Logger
 
 	// Log the directory creation
 	if logger != nil {
-		logger.Infof(projectName, "Creating parent directory: %s", parentDir)
+		logger.InfofContext(ctx, projectName, "Creating parent directory: %s", parentDir)
 	}
 
 	// Create the directory with standard permissions
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -79,6 +80,147 @@ func TestDeploySkipOnBusy(t *testing.T) {
 	}
 }
 
+// waitForIdle waits until the deployer has no active builds
+func waitForIdle(t *testing.T, deployer *Deployer) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for deployer.HasActiveBuilds() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for deployments to finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestDeployQueueOnBusy tests that on_busy=queue runs pending deployments in order
+func TestDeployQueueOnBusy(t *testing.T) {
+	tmpDir := t.TempDir()
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	deployer := NewDeployer(logger)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecutePath:    tmpDir,
+		ExecuteCommand: "echo $SDEPLOY_TRIGGER_SOURCE >> runs.txt && sleep 0.3",
+		OnBusy:         OnBusyQueue,
+		QueueSize:      2,
+	}
+
+	go deployer.Deploy(context.Background(), project, "FIRST")
+	time.Sleep(50 * time.Millisecond)
+
+	second := deployer.Deploy(context.Background(), project, "SECOND")
+	third := deployer.Deploy(context.Background(), project, "THIRD")
+	fourth := deployer.Deploy(context.Background(), project, "FOURTH")
+
+	if !second.Queued || second.QueueLength != 1 {
+		t.Errorf("Expected second request queued at position 1, got queued=%t length=%d", second.Queued, second.QueueLength)
+	}
+	if !third.Queued || third.QueueLength != 2 {
+		t.Errorf("Expected third request queued at position 2, got queued=%t length=%d", third.Queued, third.QueueLength)
+	}
+	if !fourth.Skipped {
+		t.Error("Expected fourth request to be skipped when queue is full")
+	}
+	if deployer.PendingCount(project.WebhookPath) != 2 {
+		t.Errorf("Expected 2 pending runs, got %d", deployer.PendingCount(project.WebhookPath))
+	}
+
+	waitForIdle(t, deployer)
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "runs.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read runs file: %v", err)
+	}
+	if got := strings.Fields(string(content)); strings.Join(got, ",") != "FIRST,SECOND,THIRD" {
+		t.Errorf("Expected runs FIRST,SECOND,THIRD, got %v", got)
+	}
+	if !strings.Contains(buf.String(), "Queued") {
+		t.Errorf("Expected queue decision to be logged, got: %s", buf.String())
+	}
+}
+
+// TestDeployCoalesceOnBusy tests that on_busy=coalesce keeps only the newest pending run
+func TestDeployCoalesceOnBusy(t *testing.T) {
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecutePath:    tmpDir,
+		ExecuteCommand: "echo $SDEPLOY_TRIGGER_SOURCE >> runs.txt && sleep 0.3",
+		OnBusy:         OnBusyCoalesce,
+	}
+
+	go deployer.Deploy(context.Background(), project, "FIRST")
+	time.Sleep(50 * time.Millisecond)
+
+	for _, trigger := range []string{"SECOND", "THIRD", "FOURTH"} {
+		result := deployer.Deploy(context.Background(), project, trigger)
+		if !result.Queued || result.QueueLength != 1 {
+			t.Errorf("Expected %s to be coalesced into a single pending run, got queued=%t length=%d", trigger, result.Queued, result.QueueLength)
+		}
+	}
+
+	waitForIdle(t, deployer)
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "runs.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read runs file: %v", err)
+	}
+	if got := strings.Fields(string(content)); strings.Join(got, ",") != "FIRST,FOURTH" {
+		t.Errorf("Expected runs FIRST,FOURTH, got %v", got)
+	}
+}
+
+// TestDeployCoalescePerBranch tests that on_busy: coalesce keeps one pending run per branch
+func TestDeployCoalescePerBranch(t *testing.T) {
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		GitBranch:      "main",
+		ExecutePath:    tmpDir,
+		ExecuteCommand: "echo $SDEPLOY_TRIGGER_SOURCE >> runs.txt && sleep 0.3",
+		OnBusy:         OnBusyCoalesce,
+		Branches:       []BranchConfig{{Pattern: "main"}, {Pattern: "feature/*"}},
+	}
+
+	go deployer.Deploy(context.Background(), project, "FIRST")
+	time.Sleep(50 * time.Millisecond)
+
+	requests := []struct {
+		branch  string
+		trigger string
+		length  int
+	}{
+		{"feature/a", "SECOND", 1},
+		{"feature/b", "THIRD", 2},
+		{"feature/a", "FOURTH", 2},
+	}
+	for _, tc := range requests {
+		result := deployer.Deploy(context.Background(), project.forBranch(tc.branch), tc.trigger)
+		if !result.Queued || result.QueueLength != tc.length {
+			t.Errorf("Expected %s to be pending with %d runs, got queued=%t length=%d", tc.trigger, tc.length, result.Queued, result.QueueLength)
+		}
+	}
+
+	waitForIdle(t, deployer)
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "runs.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read runs file: %v", err)
+	}
+	if got := strings.Fields(string(content)); strings.Join(got, ",") != "FIRST,THIRD,FOURTH" {
+		t.Errorf("Expected runs FIRST,THIRD,FOURTH, got %v", got)
+	}
+}
+
 // TestDeployGitPull tests git pull execution when git_update=true
 func TestDeployGitPull(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -114,6 +256,227 @@ func TestDeployGitPull(t *testing.T) {
 	_ = result
 }
 
+// runGit runs a git command in dir for test setup and returns its trimmed output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=sdeploy", "-c", "user.email=sdeploy@example.com"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// newTestGitOrigin creates a bare origin repository on branch main and a
+// working clone used to push commits to it
+func newTestGitOrigin(t *testing.T) (origin, work string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	tmpDir := t.TempDir()
+	origin = filepath.Join(tmpDir, "origin.git")
+	work = filepath.Join(tmpDir, "work")
+	runGit(t, tmpDir, "init", "--bare", "-b", "main", origin)
+	runGit(t, tmpDir, "clone", origin, work)
+	runGit(t, work, "checkout", "-b", "main")
+	return origin, work
+}
+
+// pushTestCommit commits a file change in work, pushes it to origin and returns the commit SHA
+func pushTestCommit(t *testing.T, work, content string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(work, "VERSION"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	runGit(t, work, "add", "VERSION")
+	runGit(t, work, "commit", "-m", content)
+	runGit(t, work, "push", "origin", "main")
+	return runGit(t, work, "rev-parse", "HEAD")
+}
+
+// TestDeployFetchResetToWebhookCommit tests that fetch_reset deploys the commit announced by the webhook
+func TestDeployFetchResetToWebhookCommit(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	first := pushTestCommit(t, work, "v1")
+
+	localPath := filepath.Join(t.TempDir(), "app")
+	runGit(t, filepath.Dir(localPath), "clone", "-b", "main", origin, localPath)
+
+	second := pushTestCommit(t, work, "v2")
+	third := pushTestCommit(t, work, "v3")
+
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		GitRepo:        origin,
+		GitBranch:      "main",
+		GitUpdate:      true,
+		GitStrategy:    GitStrategyFetchReset,
+		LocalPath:      localPath,
+		ExecuteCommand: "echo \"$SDEPLOY_GIT_COMMIT $(cat VERSION)\"",
+	}
+
+	// The webhook announced the second push; the third already landed on the branch
+	result := deployer.DeployEvent(context.Background(), project, "WEBHOOK", &WebhookEvent{Branch: "main", Commit: second})
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+	}
+	if result.Commit != second {
+		t.Errorf("Expected recorded commit %s, got %s", second, result.Commit)
+	}
+	if !strings.Contains(result.Output, second+" v2") {
+		t.Errorf("Expected command to see SDEPLOY_GIT_COMMIT=%s and v2, got: %s", second, result.Output)
+	}
+
+	// Internal triggers deploy the branch tip
+	result = deployer.Deploy(context.Background(), project, "INTERNAL")
+	if result.Commit != third || !strings.Contains(result.Output, third+" v3") {
+		t.Errorf("Expected internal trigger to deploy branch tip %s, got commit %s (output: %s)", third, result.Commit, result.Output)
+	}
+
+	// Local drift is discarded rather than merged
+	if err := os.WriteFile(filepath.Join(localPath, "VERSION"), []byte("local edit"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	result = deployer.DeployEvent(context.Background(), project, "WEBHOOK", &WebhookEvent{Branch: "main", Commit: first})
+	if result.Commit != first || !strings.Contains(result.Output, "v1") {
+		t.Errorf("Expected reset to %s discarding local changes, got commit %s (output: %s)", first, result.Commit, result.Output)
+	}
+}
+
+// TestDeployPullRecordsCommit tests that the pull strategy records the resolved commit
+func TestDeployPullRecordsCommit(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	pushTestCommit(t, work, "v1")
+
+	localPath := filepath.Join(t.TempDir(), "app")
+	runGit(t, filepath.Dir(localPath), "clone", "-b", "main", origin, localPath)
+	latest := pushTestCommit(t, work, "v2")
+
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		GitRepo:        origin,
+		GitBranch:      "main",
+		GitUpdate:      true,
+		GitStrategy:    GitStrategyPull,
+		LocalPath:      localPath,
+		ExecuteCommand: "echo $SDEPLOY_GIT_COMMIT",
+	}
+
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+	}
+	if result.Commit != latest || !strings.Contains(result.Output, latest) {
+		t.Errorf("Expected commit %s, got %s (output: %s)", latest, result.Commit, result.Output)
+	}
+}
+
+// TestDeployTag tests that a tag event checks out the tag and exports SDEPLOY_GIT_TAG,
+// and that later branch deployments return to the branch
+func TestDeployTag(t *testing.T) {
+	for _, strategy := range []string{GitStrategyPull, GitStrategyFetchReset} {
+		t.Run(strategy, func(t *testing.T) {
+			origin, work := newTestGitOrigin(t)
+			pushTestCommit(t, work, "v1")
+			runGit(t, work, "tag", "v1.0.0")
+			runGit(t, work, "push", "origin", "v1.0.0")
+			latest := pushTestCommit(t, work, "v2")
+
+			deployer := NewDeployer(nil)
+			project := &ProjectConfig{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				GitRepo:        origin,
+				GitBranch:      "main",
+				GitUpdate:      true,
+				GitStrategy:    strategy,
+				LocalPath:      filepath.Join(t.TempDir(), "app"),
+				ExecuteCommand: "echo \"$SDEPLOY_GIT_TAG $(cat VERSION)\"",
+			}
+
+			result := deployer.DeployEvent(context.Background(), project, "WEBHOOK", &WebhookEvent{Kind: EventTag, Tag: "v1.0.0"})
+			if !result.Success {
+				t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+			}
+			if result.Tag != "v1.0.0" || !strings.Contains(result.Output, "v1.0.0 v1") {
+				t.Errorf("Expected tag v1.0.0 with v1 checked out, got tag %q (output: %s)", result.Tag, result.Output)
+			}
+
+			// A branch deployment leaves the detached tag checkout
+			result = deployer.Deploy(context.Background(), project, "INTERNAL")
+			if !result.Success {
+				t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+			}
+			if result.Commit != latest || result.Tag != "" || !strings.Contains(result.Output, " v2") {
+				t.Errorf("Expected branch tip %s, got commit %s tag %q (output: %s)", latest, result.Commit, result.Tag, result.Output)
+			}
+
+			result = deployer.DeployEvent(context.Background(), project, "WEBHOOK", &WebhookEvent{Kind: EventTag, Tag: "v9.9.9"})
+			if result.Success {
+				t.Error("Expected failure for a tag missing from origin")
+			}
+		})
+	}
+}
+
+// TestIsSafeRefName tests rejecting tag names that are not plain git ref names
+func TestIsSafeRefName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"v1.0.0", true},
+		{"release/2024-01+build", true},
+		{"", false},
+		{"-v1", false},
+		{"v1..2", false},
+		{"v1;rm -rf /", false},
+		{"v1$(id)", false},
+		{"v1.lock", false},
+		{"/v1", false},
+	}
+
+	for _, tc := range tests {
+		if got := isSafeRefName(tc.name); got != tc.expected {
+			t.Errorf("isSafeRefName(%q) = %t, expected %t", tc.name, got, tc.expected)
+		}
+	}
+}
+
+// TestDeployRequestTargetCommit tests which payload commits are used as reset targets
+func TestDeployRequestTargetCommit(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name     string
+		trigger  string
+		event    *WebhookEvent
+		expected string
+	}{
+		{"webhook commit", "WEBHOOK", &WebhookEvent{Commit: sha}, sha},
+		{"internal trigger uses branch tip", "INTERNAL", &WebhookEvent{Commit: sha}, ""},
+		{"no event", "WEBHOOK", nil, ""},
+		{"deleted branch", "WEBHOOK", &WebhookEvent{Commit: strings.Repeat("0", 40)}, ""},
+		{"not a sha", "WEBHOOK", &WebhookEvent{Commit: "main; rm -rf /"}, ""},
+		{"too short", "WEBHOOK", &WebhookEvent{Commit: "abc"}, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &deployRequest{triggerSource: tc.trigger, event: tc.event}
+			if got := req.targetCommit(); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
 // TestDeployCommandExecution tests execute_command execution
 func TestDeployCommandExecution(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -164,6 +527,168 @@ func TestDeployTimeout(t *testing.T) {
 	if result.Success {
 		t.Error("Expected deployment to fail due to timeout")
 	}
+	if !result.TimedOut {
+		t.Error("Expected result to be marked as timed out")
+	}
+}
+
+// TestDeployTimeoutGracefulStop tests SIGTERM before SIGKILL so scripts can clean up
+func TestDeployTimeoutGracefulStop(t *testing.T) {
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+	grace := 5
+	project := &ProjectConfig{
+		Name:             "TestProject",
+		WebhookPath:      "/hooks/test",
+		ExecutePath:      tmpDir,
+		ExecuteCommand:   "trap 'echo cleaned > cleanup.txt; exit 1' TERM; sleep 30 & wait",
+		TimeoutSeconds:   1,
+		KillGraceSeconds: &grace,
+	}
+
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if !result.TimedOut || result.KillSignal != "SIGTERM" {
+		t.Errorf("Expected timeout ended by SIGTERM, got timed_out=%t kill_signal=%q", result.TimedOut, result.KillSignal)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "cleanup.txt")); err != nil {
+		t.Errorf("Expected trap cleanup to run: %v", err)
+	}
+
+	// A command ignoring SIGTERM is killed once the grace period ends
+	project.ExecuteCommand = "trap '' TERM; sleep 30 & wait"
+	grace = 1
+	start := time.Now()
+	result = deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected SIGKILL after the grace period, took %v", elapsed)
+	}
+	if !result.TimedOut || result.KillSignal != "SIGKILL" {
+		t.Errorf("Expected timeout ended by SIGKILL, got timed_out=%t kill_signal=%q", result.TimedOut, result.KillSignal)
+	}
+
+	// A grace period of 0 sends SIGKILL without SIGTERM, so the trap never runs
+	os.Remove(filepath.Join(tmpDir, "cleanup.txt"))
+	project.ExecuteCommand = "trap 'echo cleaned > cleanup.txt; exit 1' TERM; sleep 30 & wait"
+	grace = 0
+	result = deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if !result.TimedOut || result.KillSignal != "SIGKILL" {
+		t.Errorf("Expected timeout ended by SIGKILL, got timed_out=%t kill_signal=%q", result.TimedOut, result.KillSignal)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "cleanup.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no SIGTERM with grace 0 (err: %v)", err)
+	}
+}
+
+// TestDeployCancel tests cancelling a running deployment and its process tree
+func TestDeployCancel(t *testing.T) {
+	tmpDir := t.TempDir()
+	metrics := NewMetrics()
+	deployer := NewDeployer(nil)
+	deployer.SetMetrics(metrics)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecutePath:    tmpDir,
+		ExecuteCommand: "sleep 30 & wait",
+		TimeoutSeconds: 60,
+		Hooks:          DeployHooks{PostDeployFailure: "echo $SDEPLOY_DEPLOY_STATUS > status.txt"},
+	}
+
+	if _, err := deployer.Cancel(project.WebhookPath, "alice"); !errors.Is(err, ErrNotDeploying) {
+		t.Errorf("Expected ErrNotDeploying without a running deployment, got %v", err)
+	}
+
+	done := make(chan DeployResult, 1)
+	start := time.Now()
+	go func() { done <- deployer.Deploy(context.Background(), project, "WEBHOOK") }()
+
+	var runIDs []string
+	var err error
+	for i := 0; i < 100; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if runIDs, err = deployer.Cancel(project.WebhookPath, "alice"); err == nil {
+			break
+		}
+	}
+	if err != nil || len(runIDs) != 1 {
+		t.Fatalf("Cancel failed: %v (runs: %v)", err, runIDs)
+	}
+	runID := runIDs[0]
+
+	result := <-done
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected cancellation to stop the command quickly, took %v", elapsed)
+	}
+	if result.RunID != runID || !result.Cancelled || result.CancelledBy != "alice" || result.Success || result.TimedOut {
+		t.Errorf("Expected run %s cancelled by alice, got %+v", runID, result)
+	}
+	if result.Status() != "cancelled" || result.Error != "deployment cancelled by alice" {
+		t.Errorf("Expected cancelled status and error, got %s: %s", result.Status(), result.Error)
+	}
+
+	// Failure hooks still run and see the cancelled status
+	if content, err := os.ReadFile(filepath.Join(tmpDir, "status.txt")); err != nil || strings.TrimSpace(string(content)) != "cancelled" {
+		t.Errorf("Expected post_deploy_failure hook to see cancelled status, got %q (err: %v)", content, err)
+	}
+
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `sdeploy_deploys_total{project="TestProject",result="cancelled"} 1`) {
+		t.Errorf("Expected cancelled deploy metric, got:\n%s", buf.String())
+	}
+
+	email := composeDeploymentEmail(project, &result, "WEBHOOK")
+	if !strings.Contains(email.Subject, "CANCELLED") || !strings.Contains(email.Body, "Cancelled By: alice") {
+		t.Errorf("Expected cancelled email, got %q:\n%s", email.Subject, email.Body)
+	}
+}
+
+// TestDeployInterruptedByShutdown tests that cancelling the root context with
+// ErrShutdown stops the run and records it as interrupted
+func TestDeployInterruptedByShutdown(t *testing.T) {
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecutePath:    tmpDir,
+		ExecuteCommand: "sleep 30 & wait",
+		Hooks:          DeployHooks{PostDeployFailure: "echo $SDEPLOY_DEPLOY_STATUS > status.txt"},
+	}
+
+	rootCtx, interrupt := context.WithCancelCause(context.Background())
+	defer interrupt(nil)
+
+	done := make(chan DeployResult, 1)
+	go func() { done <- deployer.Deploy(rootCtx, project, "WEBHOOK") }()
+	for i := 0; i < 100 && !deployer.IsDeploying(project.WebhookPath); i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// The run does not finish within the wait
+	waitCtx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if deployer.WaitIdle(waitCtx) {
+		t.Fatal("Expected WaitIdle to time out while the deployment runs")
+	}
+
+	interrupt(ErrShutdown)
+	result := <-done
+	if !result.Interrupted || result.Cancelled || result.Success || result.Status() != "interrupted" {
+		t.Errorf("Expected interrupted run, got %+v", result)
+	}
+	if !strings.Contains(result.Error, ErrShutdown.Error()) {
+		t.Errorf("Expected shutdown error, got %q", result.Error)
+	}
+	if result.KillSignal != "SIGTERM" {
+		t.Errorf("Expected command ended by SIGTERM, got %q", result.KillSignal)
+	}
+	if content, err := os.ReadFile(filepath.Join(tmpDir, "status.txt")); err != nil || strings.TrimSpace(string(content)) != "interrupted" {
+		t.Errorf("Expected post_deploy_failure hook to see interrupted status, got %q (err: %v)", content, err)
+	}
+	if !deployer.WaitIdle(context.Background()) || deployer.HasActiveBuilds() {
+		t.Error("Expected no active builds after the interrupted run")
+	}
 }
 
 // TestDeployEnvVars tests environment variable injection
@@ -16,8 +16,10 @@ type Email struct {
 
 // EmailNotifier handles sending email notifications
 type EmailNotifier struct {
-	config *EmailConfig
-	logger *Logger
+	config   *EmailConfig
+	logger   *Logger
+	metrics  *Metrics
+	redactor *Redactor
 }
 
 // NewEmailNotifier creates a new email notifier
@@ -28,6 +30,16 @@ func NewEmailNotifier(config *EmailConfig, logger *Logger) *EmailNotifier {
 	}
 }
 
+// SetMetrics sets the metrics registry used to count send failures
+func (n *EmailNotifier) SetMetrics(metrics *Metrics) {
+	n.metrics = metrics
+}
+
+// SetRedactor sets the redactor applied to the subject and body of every email
+func (n *EmailNotifier) SetRedactor(redactor *Redactor) {
+	n.redactor = redactor
+}
+
 // SendNotification sends a deployment notification email
 func (n *EmailNotifier) SendNotification(project *ProjectConfig, result *DeployResult, triggerSource string) error {
 	// Skip if no email config or no recipients
@@ -41,14 +53,24 @@ func (n *EmailNotifier) SendNotification(project *ProjectConfig, result *DeployR
 
 	email := composeDeploymentEmail(project, result, triggerSource)
 	email.To = project.EmailRecipients
+	email.Subject = n.redactor.Redact(email.Subject)
+	email.Body = n.redactor.Redact(email.Body)
 
-	return n.send(email)
+	if err := n.send(email); err != nil {
+		n.metrics.IncEmailFailure(project.Name)
+		return err
+	}
+	return nil
 }
 
 // composeDeploymentEmail creates the email content for a deployment result
 func composeDeploymentEmail(project *ProjectConfig, result *DeployResult, triggerSource string) *Email {
 	status := "SUCCESS"
-	if !result.Success {
+	if result.Cancelled {
+		status = "CANCELLED"
+	} else if result.Interrupted {
+		status = "INTERRUPTED"
+	} else if !result.Success {
 		status = "FAILED"
 	}
 
@@ -58,12 +80,36 @@ func composeDeploymentEmail(project *ProjectConfig, result *DeployResult, trigge
 	body.WriteString(fmt.Sprintf("Project: %s\n", project.Name))
 	body.WriteString(fmt.Sprintf("Trigger Source: %s\n", triggerSource))
 	body.WriteString(fmt.Sprintf("Branch: %s\n", project.GitBranch))
+	if result.Tag != "" {
+		body.WriteString(fmt.Sprintf("Tag: %s\n", result.Tag))
+	}
 	body.WriteString(fmt.Sprintf("Status: %s\n", status))
+	if result.Cancelled {
+		body.WriteString(fmt.Sprintf("Cancelled By: %s\n", result.CancelledBy))
+	}
 	body.WriteString(fmt.Sprintf("Start Time: %s\n", result.StartTime.Format("2006-01-02 15:04:05")))
 	body.WriteString(fmt.Sprintf("End Time: %s\n", result.EndTime.Format("2006-01-02 15:04:05")))
 	body.WriteString(fmt.Sprintf("Duration: %v\n", result.Duration()))
+	if result.LogFile != "" {
+		body.WriteString(fmt.Sprintf("Log File: %s\n", result.LogFile))
+	}
 	body.WriteString("\n")
 
+	if check := result.HealthCheck; check != nil {
+		healthStatus := "passed"
+		if !check.Healthy {
+			healthStatus = "failed"
+		}
+		body.WriteString(fmt.Sprintf("Health Check: %s (%s, %d attempts)\n", healthStatus, check.URL, check.Attempts))
+		if result.RolledBack {
+			body.WriteString("Rolled Back: yes\n")
+		}
+		body.WriteString("\n")
+	}
+
+	writeStepResults(&body, "Steps", result.Steps)
+	writeStepResults(&body, "Hooks", result.Hooks)
+
 	if result.Error != "" {
 		body.WriteString(fmt.Sprintf("Error: %s\n", result.Error))
 		body.WriteString("\n")
@@ -82,6 +128,25 @@ func composeDeploymentEmail(project *ProjectConfig, result *DeployResult, trigge
 	}
 }
 
+// writeStepResults writes one status line per step or hook
+func writeStepResults(body *strings.Builder, title string, steps []StepResult) {
+	if len(steps) == 0 {
+		return
+	}
+	body.WriteString(title + ":\n")
+	for _, step := range steps {
+		line := fmt.Sprintf("  [%s] %s", strings.ToUpper(step.Status()), step.Name)
+		if !step.Skipped {
+			line += fmt.Sprintf(" (%v)", step.Duration())
+		}
+		if step.Error != "" {
+			line += ": " + step.Error
+		}
+		body.WriteString(line + "\n")
+	}
+	body.WriteString("\n")
+}
+
 // send sends an email using SMTP
 func (n *EmailNotifier) send(email *Email) error {
 	if n.config == nil {
@@ -63,6 +63,29 @@ func TestEmailCompositionFailure(t *testing.T) {
 	}
 }
 
+// TestEmailCompositionSteps tests that step results are listed in the email
+func TestEmailCompositionSteps(t *testing.T) {
+	now := time.Now()
+	result := &DeployResult{
+		Success:   false,
+		StartTime: now,
+		EndTime:   now.Add(5 * time.Second),
+		Steps: []StepResult{
+			{Name: "install", Success: true, StartTime: now, EndTime: now.Add(2 * time.Second)},
+			{Name: "build", Error: "exit status 1", StartTime: now, EndTime: now.Add(3 * time.Second)},
+			{Name: "reload", Skipped: true},
+		},
+	}
+
+	email := composeDeploymentEmail(&ProjectConfig{Name: "Frontend"}, result, "WEBHOOK")
+
+	for _, expected := range []string{"[SUCCESS] install (2s)", "[FAILED] build (3s): exit status 1", "[SKIPPED] reload"} {
+		if !strings.Contains(email.Body, expected) {
+			t.Errorf("Expected email body to contain %q, got: %s", expected, email.Body)
+		}
+	}
+}
+
 // TestEmailSkipWhenUnconfigured tests that email is skipped when not configured
 func TestEmailSkipWhenUnconfigured(t *testing.T) {
 	notifier := NewEmailNotifier(nil, nil)
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Event kinds a project can allow in its events list. Forge-specific event
+// types (X-GitHub-Event, X-Gitlab-Event, ...) are normalized to these.
+const (
+	EventPush         = "push"          // Branch push
+	EventTag          = "tag"           // Tag push
+	EventRelease      = "release"       // Published release
+	EventWorkflowRun  = "workflow_run"  // Successfully completed GitHub Actions workflow run
+	EventMergeRequest = "merge_request" // Merged merge/pull request
+)
+
+// EventPing is the kind of connectivity checks (e.g., GitHub's ping on webhook
+// creation); they are answered with 200 and never deploy
+const EventPing = "ping"
+
+// validEvents lists the event kinds accepted in a project's events list
+var validEvents = []string{EventPush, EventTag, EventRelease, EventWorkflowRun, EventMergeRequest}
+
+// defaultEvents returns the events of a project without an events list:
+// tag events when git_tag_pattern is set, Defaults.Events otherwise. Release
+// events are opt-in, as publishing a release also pushes its tag.
+func defaultEvents(project *ProjectConfig) []string {
+	if project.GitTagPattern != "" {
+		return []string{EventTag}
+	}
+	return Defaults.Events
+}
+
+// projectAllowsEvent reports whether a project deploys on the given event kind
+func projectAllowsEvent(project *ProjectConfig, kind string) bool {
+	events := project.Events
+	if len(events) == 0 {
+		events = defaultEvents(project)
+	}
+	return kind != "" && slices.Contains(events, kind)
+}
+
+// validateRefPattern checks a git_tag_pattern: a regular expression when it
+// starts with "^", a glob (path.Match syntax) otherwise
+func validateRefPattern(pattern string) error {
+	if strings.HasPrefix(pattern, "^") {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid regular expression: %v", err)
+		}
+		return nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid glob: %v", err)
+	}
+	return nil
+}
+
+// matchRefPattern reports whether a tag or branch name matches a pattern
+// (see validateRefPattern). An empty pattern matches every name.
+func matchRefPattern(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	if strings.HasPrefix(pattern, "^") {
+		re, err := regexp.Compile(pattern)
+		return err == nil && re.MatchString(name)
+	}
+	matched, err := path.Match(pattern, name)
+	return err == nil && matched
+}
+
+// refEventKind classifies a push payload as a branch or tag push by its ref.
+// Pushes deleting the ref get no kind.
+func refEventKind(event *WebhookEvent) string {
+	switch {
+	case isZeroSHA(event.Commit):
+		return ""
+	case event.Tag != "":
+		return EventTag
+	case event.Branch != "":
+		return EventPush
+	}
+	return ""
+}
+
+// isZeroSHA reports whether a commit SHA is all zeros, the new commit of a
+// push deleting a branch or tag
+func isZeroSHA(sha string) bool {
+	return sha != "" && strings.Trim(sha, "0") == ""
+}
+
+// classifyGitHubEvent sets the kind of a GitHub, Gitea or Forgejo webhook from
+// its event type, filling in branch, tag and commit for non-push events.
+// Unsupported events and actions (issues, opened pull requests, ...) get no kind.
+func classifyGitHubEvent(event *WebhookEvent, payload []byte) {
+	var data struct {
+		Action  string `json:"action"`
+		Release struct {
+			TagName string `json:"tag_name"`
+		} `json:"release"`
+		WorkflowRun struct {
+			Event          string `json:"event"`
+			HeadBranch     string `json:"head_branch"`
+			HeadSHA        string `json:"head_sha"`
+			Conclusion     string `json:"conclusion"`
+			HeadRepository struct {
+				FullName string `json:"full_name"`
+			} `json:"head_repository"`
+		} `json:"workflow_run"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		PullRequest struct {
+			Merged         bool   `json:"merged"`
+			MergeCommitSHA string `json:"merge_commit_sha"`
+			Base           struct {
+				Ref string `json:"ref"`
+			} `json:"base"`
+		} `json:"pull_request"`
+	}
+
+	switch event.Event {
+	case "", "push":
+		// Without an event header, classify by ref
+		event.Kind = refEventKind(event)
+	case "ping":
+		event.Kind = EventPing
+	case "release":
+		if json.Unmarshal(payload, &data) == nil && data.Action == "published" {
+			event.Kind = EventRelease
+			event.Tag = data.Release.TagName
+		}
+	case "workflow_run":
+		// Only runs of pushes to the repository itself: pull request runs and
+		// runs of forks name branches and commits the repository does not have
+		if json.Unmarshal(payload, &data) == nil && data.Action == "completed" && data.WorkflowRun.Conclusion == "success" &&
+			data.WorkflowRun.Event == "push" && data.WorkflowRun.HeadRepository.FullName == data.Repository.FullName {
+			event.Kind = EventWorkflowRun
+			event.Branch = data.WorkflowRun.HeadBranch
+			event.Commit = data.WorkflowRun.HeadSHA
+		}
+	case "pull_request":
+		if json.Unmarshal(payload, &data) == nil && data.Action == "closed" && data.PullRequest.Merged {
+			event.Kind = EventMergeRequest
+			event.Branch = data.PullRequest.Base.Ref
+			event.Commit = data.PullRequest.MergeCommitSHA
+		}
+	}
+}
+
+// classifyGitLabEvent sets the kind of a GitLab webhook from X-Gitlab-Event
+func classifyGitLabEvent(event *WebhookEvent, payload []byte) {
+	var data struct {
+		Action           string `json:"action"`
+		Tag              string `json:"tag"`
+		ObjectAttributes struct {
+			Action         string `json:"action"`
+			TargetBranch   string `json:"target_branch"`
+			MergeCommitSHA string `json:"merge_commit_sha"`
+			LastCommit     struct {
+				ID string `json:"id"`
+			} `json:"last_commit"`
+		} `json:"object_attributes"`
+	}
+
+	switch event.Event {
+	case "", "Push Hook", "Tag Push Hook":
+		event.Kind = refEventKind(event)
+	case "Release Hook":
+		if json.Unmarshal(payload, &data) == nil && data.Action == "create" {
+			event.Kind = EventRelease
+			event.Tag = data.Tag
+		}
+	case "Merge Request Hook":
+		if json.Unmarshal(payload, &data) == nil && data.ObjectAttributes.Action == "merge" {
+			attrs := data.ObjectAttributes
+			event.Kind = EventMergeRequest
+			event.Branch = attrs.TargetBranch
+			// Fast-forward merges have no merge commit
+			event.Commit = attrs.MergeCommitSHA
+			if event.Commit == "" {
+				event.Commit = attrs.LastCommit.ID
+			}
+		}
+	}
+}
+
+// classifyBitbucketEvent sets the kind of a Bitbucket Cloud or Server webhook from X-Event-Key
+func classifyBitbucketEvent(event *WebhookEvent, payload []byte) {
+	var data struct {
+		// Bitbucket Cloud
+		PullRequestCloud struct {
+			Destination struct {
+				Branch struct {
+					Name string `json:"name"`
+				} `json:"branch"`
+			} `json:"destination"`
+			MergeCommit struct {
+				Hash string `json:"hash"`
+			} `json:"merge_commit"`
+		} `json:"pullrequest"`
+		// Bitbucket Server
+		PullRequestServer struct {
+			ToRef struct {
+				DisplayID string `json:"displayId"`
+			} `json:"toRef"`
+			Properties struct {
+				MergeCommit struct {
+					ID string `json:"id"`
+				} `json:"mergeCommit"`
+			} `json:"properties"`
+		} `json:"pullRequest"`
+	}
+
+	switch event.Event {
+	case "", "repo:push", "repo:refs_changed":
+		event.Kind = refEventKind(event)
+	case "diagnostics:ping":
+		event.Kind = EventPing
+	case "pullrequest:fulfilled":
+		if json.Unmarshal(payload, &data) == nil {
+			event.Kind = EventMergeRequest
+			event.Branch = data.PullRequestCloud.Destination.Branch.Name
+			event.Commit = data.PullRequestCloud.MergeCommit.Hash
+		}
+	case "pr:merged":
+		if json.Unmarshal(payload, &data) == nil {
+			event.Kind = EventMergeRequest
+			event.Branch = data.PullRequestServer.ToRef.DisplayID
+			event.Commit = data.PullRequestServer.Properties.MergeCommit.ID
+		}
+	}
+}
+
+// eventDescription names an event for log messages (its kind, or the raw event type)
+func eventDescription(event *WebhookEvent) string {
+	if event.Kind != "" {
+		return event.Kind
+	}
+	if isZeroSHA(event.Commit) {
+		return "ref deletion"
+	}
+	if event.Event != "" {
+		return event.Event
+	}
+	return "unknown"
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestClassifyEvents tests normalizing forge event types and payloads to event kinds
+func TestClassifyEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		payload string
+		kind    string
+		branch  string
+		tag     string
+		commit  string
+	}{
+		{"github push", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "push"}, `{"ref":"refs/heads/main","after":"abc"}`, EventPush, "main", "", "abc"},
+		{"github tag push", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "push"}, `{"ref":"refs/tags/v1.0.0"}`, EventTag, "", "v1.0.0", ""},
+		{"github push without event header", map[string]string{"X-Hub-Signature-256": "x"}, `{"ref":"refs/heads/main"}`, EventPush, "main", "", ""},
+		{"github ping", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "ping"}, `{"zen":"Keep it simple."}`, EventPing, "", "", ""},
+		{"github issues", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "issues"}, `{"action":"opened"}`, "", "", "", ""},
+		{"github release published", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "release"}, `{"action":"published","release":{"tag_name":"v2.0.0"}}`, EventRelease, "", "v2.0.0", ""},
+		{"github release drafted", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "release"}, `{"action":"created","release":{"tag_name":"v2.0.0"}}`, "", "", "", ""},
+		{"github branch deletion", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "push"}, `{"ref":"refs/heads/main","after":"0000000000000000000000000000000000000000","deleted":true}`, "", "main", "", "0000000000000000000000000000000000000000"},
+		{"github workflow_run success", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "workflow_run"}, `{"action":"completed","workflow_run":{"event":"push","head_branch":"main","head_sha":"def","conclusion":"success","head_repository":{"full_name":"org/app"}},"repository":{"full_name":"org/app"}}`, EventWorkflowRun, "main", "", "def"},
+		{"github workflow_run of pull request", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "workflow_run"}, `{"action":"completed","workflow_run":{"event":"pull_request","head_branch":"main","head_sha":"def","conclusion":"success","head_repository":{"full_name":"org/app"}},"repository":{"full_name":"org/app"}}`, "", "", "", ""},
+		{"github workflow_run of fork", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "workflow_run"}, `{"action":"completed","workflow_run":{"event":"push","head_branch":"main","head_sha":"def","conclusion":"success","head_repository":{"full_name":"someone/app"}},"repository":{"full_name":"org/app"}}`, "", "", "", ""},
+		{"github workflow_run failure", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "workflow_run"}, `{"action":"completed","workflow_run":{"head_branch":"main","conclusion":"failure"}}`, "", "", "", ""},
+		{"github pull request merged", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "pull_request"}, `{"action":"closed","pull_request":{"merged":true,"merge_commit_sha":"fed","base":{"ref":"main"}}}`, EventMergeRequest, "main", "", "fed"},
+		{"github pull request opened", map[string]string{"X-Hub-Signature-256": "x", "X-GitHub-Event": "pull_request"}, `{"action":"opened","pull_request":{"base":{"ref":"main"}}}`, "", "", "", ""},
+		{"gitlab branch deletion", map[string]string{"X-Gitlab-Token": "x", "X-Gitlab-Event": "Push Hook"}, `{"ref":"refs/heads/main","after":"0000000000000000000000000000000000000000","checkout_sha":null}`, "", "main", "", "0000000000000000000000000000000000000000"},
+		{"gitlab tag push", map[string]string{"X-Gitlab-Token": "x", "X-Gitlab-Event": "Tag Push Hook"}, `{"ref":"refs/tags/v1.0.0","checkout_sha":"abc"}`, EventTag, "", "v1.0.0", "abc"},
+		{"gitlab merge request merged", map[string]string{"X-Gitlab-Token": "x", "X-Gitlab-Event": "Merge Request Hook"}, `{"object_attributes":{"action":"merge","target_branch":"main","last_commit":{"id":"abc"}}}`, EventMergeRequest, "main", "", "abc"},
+		{"gitlab merge request opened", map[string]string{"X-Gitlab-Token": "x", "X-Gitlab-Event": "Merge Request Hook"}, `{"object_attributes":{"action":"open","target_branch":"main"}}`, "", "", "", ""},
+		{"gitlab release", map[string]string{"X-Gitlab-Token": "x", "X-Gitlab-Event": "Release Hook"}, `{"action":"create","tag":"v3.0.0"}`, EventRelease, "", "v3.0.0", ""},
+		{"gitlab issue", map[string]string{"X-Gitlab-Token": "x", "X-Gitlab-Event": "Issue Hook"}, `{"object_attributes":{"action":"open"}}`, "", "", "", ""},
+		{"bitbucket server ping", map[string]string{"X-Event-Key": "diagnostics:ping", "X-Hub-Signature": "x"}, `{"test":true}`, EventPing, "", "", ""},
+		{"bitbucket cloud pull request merged", map[string]string{"X-Event-Key": "pullrequest:fulfilled", "X-Hub-Signature": "x"}, `{"pullrequest":{"destination":{"branch":{"name":"main"}},"merge_commit":{"hash":"abc"}}}`, EventMergeRequest, "main", "", "abc"},
+		{"bitbucket server pull request merged", map[string]string{"X-Event-Key": "pr:merged", "X-Hub-Signature": "x"}, `{"pullRequest":{"toRef":{"displayId":"main"},"properties":{"mergeCommit":{"id":"abc"}}}}`, EventMergeRequest, "main", "", "abc"},
+		{"internal trigger", map[string]string{}, `{"ref":"refs/heads/main"}`, EventPush, "main", "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/test", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			event := parseWebhookEvent(req, []byte(tc.payload))
+			if event.Kind != tc.kind || event.Branch != tc.branch || event.Tag != tc.tag || event.Commit != tc.commit {
+				t.Errorf("Expected kind=%q branch=%q tag=%q commit=%q, got kind=%q branch=%q tag=%q commit=%q",
+					tc.kind, tc.branch, tc.tag, tc.commit, event.Kind, event.Branch, event.Tag, event.Commit)
+			}
+		})
+	}
+}
+
+// TestWebhookEventFiltering tests that ping is answered with 200 and only allowed events deploy
+func TestWebhookEventFiltering(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "Default",
+				WebhookPath:    "/hooks/default",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+			{
+				Name:           "Releases",
+				WebhookPath:    "/hooks/releases",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+				Events:         []string{EventTag, EventWorkflowRun},
+			},
+		},
+	}
+	metrics := NewMetrics()
+	handler := NewWebhookHandler(cfg, nil)
+	handler.SetMetrics(metrics)
+
+	tests := []struct {
+		name    string
+		path    string
+		event   string
+		payload string
+		status  int
+		body    string
+	}{
+		{"ping", "/hooks/default", "ping", `{"zen":"Design for failure."}`, http.StatusOK, "Pong"},
+		{"push allowed by default", "/hooks/default", "push", `{"ref":"refs/heads/main"}`, http.StatusAccepted, "Accepted"},
+		{"issue ignored", "/hooks/default", "issues", `{"action":"opened"}`, http.StatusAccepted, "Accepted (event ignored, skipped)"},
+		{"tag push ignored by default", "/hooks/default", "push", `{"ref":"refs/tags/v1.0.0"}`, http.StatusAccepted, "Accepted (event ignored, skipped)"},
+		{"push not in events", "/hooks/releases", "push", `{"ref":"refs/heads/main"}`, http.StatusAccepted, "Accepted (event ignored, skipped)"},
+		{"tag in events", "/hooks/releases", "push", `{"ref":"refs/tags/v1.0.0"}`, http.StatusAccepted, "Accepted"},
+		{"workflow_run in events", "/hooks/releases", "workflow_run", `{"action":"completed","workflow_run":{"event":"push","head_branch":"main","conclusion":"success","head_repository":{"full_name":"org/app"}},"repository":{"full_name":"org/app"}}`, http.StatusAccepted, "Accepted"},
+		{"workflow_run of pull request ignored", "/hooks/releases", "workflow_run", `{"action":"completed","workflow_run":{"event":"pull_request","head_branch":"main","conclusion":"success","head_repository":{"full_name":"org/app"}},"repository":{"full_name":"org/app"}}`, http.StatusAccepted, "Accepted (event ignored, skipped)"},
+		{"branch deletion ignored", "/hooks/default", "push", `{"ref":"refs/heads/main","after":"0000000000000000000000000000000000000000","deleted":true}`, http.StatusAccepted, "Accepted (event ignored, skipped)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tc.path, strings.NewReader(tc.payload))
+			req.Header.Set("X-Hub-Signature-256", "sha256="+hexHMAC(tc.payload, "mysecret"))
+			req.Header.Set("X-GitHub-Event", tc.event)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.status || rr.Body.String() != tc.body {
+				t.Errorf("Expected %d %q, got %d %q", tc.status, tc.body, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	for _, expected := range []string{
+		`sdeploy_webhooks_total{project="Default",outcome="ping"} 1`,
+		`sdeploy_webhooks_total{project="Default",outcome="event_ignored"} 3`,
+		`sdeploy_webhooks_total{project="Releases",outcome="accepted"} 2`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected %s in metrics, got:\n%s", expected, buf.String())
+		}
+	}
+}
+
+// TestMatchRefPattern tests glob and regular expression git_tag_pattern matching
+func TestMatchRefPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"", "anything", true},
+		{"v*", "v1.2.3", true},
+		{"v*", "release-1", false},
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/hotfix", false},
+		{`^v\d+\.\d+\.\d+$`, "v1.2.3", true},
+		{`^v\d+\.\d+\.\d+$`, "v1.2.3-rc1", false},
+		{"^(", "(", false},
+	}
+
+	for _, tc := range tests {
+		if got := matchRefPattern(tc.pattern, tc.name); got != tc.expected {
+			t.Errorf("matchRefPattern(%q, %q) = %t, expected %t", tc.pattern, tc.name, got, tc.expected)
+		}
+	}
+}
+
+// TestWebhookTagPattern tests that tags not matching git_tag_pattern are skipped
+// and that a tag pattern makes tag the default event
+func TestWebhookTagPattern(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "Releases",
+				WebhookPath:    "/hooks/releases",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+				GitTagPattern:  "v*",
+			},
+		},
+	}
+	metrics := NewMetrics()
+	handler := NewWebhookHandler(cfg, nil)
+	handler.SetMetrics(metrics)
+
+	tests := []struct {
+		name    string
+		event   string
+		payload string
+		body    string
+	}{
+		{"matching tag", "push", `{"ref":"refs/tags/v1.0.0"}`, "Accepted"},
+		{"release ignored by default", "release", `{"action":"published","release":{"tag_name":"v1.1.0"}}`, "Accepted (event ignored, skipped)"},
+		{"mismatched tag", "push", `{"ref":"refs/tags/nightly"}`, "Accepted (tag mismatch, skipped)"},
+		{"branch push ignored", "push", `{"ref":"refs/heads/main"}`, "Accepted (event ignored, skipped)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/releases", strings.NewReader(tc.payload))
+			req.Header.Set("X-Hub-Signature-256", "sha256="+hexHMAC(tc.payload, "mysecret"))
+			req.Header.Set("X-GitHub-Event", tc.event)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusAccepted || rr.Body.String() != tc.body {
+				t.Errorf("Expected 202 %q, got %d %q", tc.body, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `sdeploy_webhooks_total{project="Releases",outcome="tag_mismatch"} 1`) {
+		t.Errorf("Expected tag_mismatch metric, got:\n%s", buf.String())
+	}
+}
+
+// TestWebhookReleaseDeploysOnce tests that publishing a release, which sends
+// both a tag push and a release event, deploys the tag once by default
+func TestWebhookReleaseDeploysOnce(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "Releases",
+				WebhookPath:    "/hooks/releases",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecutePath:    tmpDir,
+				ExecuteCommand: "echo $SDEPLOY_GIT_TAG >> runs.txt",
+				GitTagPattern:  "v*",
+				OnBusy:         OnBusyQueue,
+			},
+		},
+	}
+	deployer := NewDeployer(nil)
+	handler := NewWebhookHandler(cfg, nil)
+	handler.SetDeployer(deployer)
+
+	for _, delivery := range []struct {
+		event   string
+		payload string
+	}{
+		{"push", `{"ref":"refs/tags/v1.0.0"}`},
+		{"release", `{"action":"published","release":{"tag_name":"v1.0.0"}}`},
+	} {
+		req := httptest.NewRequest("POST", "/hooks/releases", strings.NewReader(delivery.payload))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hexHMAC(delivery.payload, "mysecret"))
+		req.Header.Set("X-GitHub-Event", delivery.event)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Deployments start asynchronously; wait for the first run, then for all runs
+	runsPath := filepath.Join(tmpDir, "runs.txt")
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(runsPath); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	waitForIdle(t, deployer)
+
+	content, err := os.ReadFile(runsPath)
+	if err != nil {
+		t.Fatalf("Failed to read runs file: %v", err)
+	}
+	if got := strings.Fields(string(content)); strings.Join(got, ",") != "v1.0.0" {
+		t.Errorf("Expected a single deployment of v1.0.0, got %v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// healthCheckBodyLimit caps how much of the response body is searched for body_contains
+const healthCheckBodyLimit = 1 << 20
+
+// HealthCheckResult holds the outcome of a post-deploy health check
+type HealthCheckResult struct {
+	URL        string `json:"url"`
+	Healthy    bool   `json:"healthy"`
+	Attempts   int    `json:"attempts"`
+	StatusCode int    `json:"status_code,omitempty"` // Status of the last response
+	Error      string `json:"error,omitempty"`       // Reason the last attempt failed
+}
+
+// checkHealthOnce performs a single health check request
+func checkHealthOnce(ctx context.Context, hc *HealthCheck) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(hc.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != hc.ExpectedStatus {
+		return resp.StatusCode, fmt.Errorf("expected status %d, got %d", hc.ExpectedStatus, resp.StatusCode)
+	}
+
+	if hc.BodyContains != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, healthCheckBodyLimit))
+		if err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to read response body: %v", err)
+		}
+		if !strings.Contains(string(body), hc.BodyContains) {
+			return resp.StatusCode, fmt.Errorf("response body does not contain %q", hc.BodyContains)
+		}
+	}
+
+	return resp.StatusCode, nil
+}
+
+// runHealthCheck polls the project's health_check until it passes or retries
+// are exhausted, recording the outcome in result
+func (d *Deployer) runHealthCheck(ctx context.Context, project *ProjectConfig, result *DeployResult) error {
+	hc := project.HealthCheck
+	check := &HealthCheckResult{URL: hc.URL}
+	result.HealthCheck = check
+
+	attempts := hc.Retries + 1
+	for attempt := 1; attempt <= attempts; attempt++ {
+		check.Attempts = attempt
+		status, err := checkHealthOnce(ctx, hc)
+		check.StatusCode = status
+		if err == nil {
+			check.Healthy = true
+			check.Error = ""
+			if d.logger != nil {
+				d.logger.InfofContext(ctx, project.Name, "Health check passed: %s (attempt %d/%d)", hc.URL, attempt, attempts)
+			}
+			return nil
+		}
+		check.Error = err.Error()
+		if d.logger != nil {
+			d.logger.WarnfContext(ctx, project.Name, "Health check failed: %s (attempt %d/%d): %v", hc.URL, attempt, attempts, err)
+		}
+
+		if attempt < attempts {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("health check cancelled: %v", ctx.Err())
+			case <-time.After(time.Duration(hc.IntervalSeconds) * time.Second):
+			}
+		}
+	}
+
+	return fmt.Errorf("health check failed after %d attempts: %s", attempts, check.Error)
+}
+
+// rollback restores the previous release (release_mode) and runs rollback_command
+// after a failed health check. A health check stopped by a cancel or shutdown
+// says nothing about the release, so it is kept.
+func (d *Deployer) rollback(ctx context.Context, project *ProjectConfig, result *DeployResult, previousRelease, dir string, env []string) {
+	if runStopped(ctx) {
+		if d.logger != nil {
+			d.logger.WarnfContext(ctx, project.Name, "Health check stopped: %v; not rolling back", context.Cause(ctx))
+		}
+		return
+	}
+
+	if project.ReleaseMode && previousRelease != "" {
+		previousDir := filepath.Join(releasesPath(project), previousRelease)
+		if err := activateRelease(project, previousDir); err != nil {
+			if d.logger != nil {
+				d.logger.ErrorfContext(ctx, project.Name, "Failed to roll back to release %s: %v", previousRelease, err)
+			}
+		} else {
+			result.RolledBack = true
+			if d.logger != nil {
+				d.logger.WarnfContext(ctx, project.Name, "Rolled back to release %s", previousRelease)
+			}
+			// Only releases that passed are kept as rollback targets
+			d.discardRelease(ctx, project, result.ReleaseDir)
+			dir = filepath.Join(previousDir, project.ExecutePath)
+		}
+	}
+
+	if project.RollbackCommand == "" {
+		return
+	}
+	if err := d.runHook(context.WithoutCancel(ctx), project, result, "rollback_command", project.RollbackCommand, dir, env); err == nil {
+		result.RolledBack = true
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newHealthServer returns a test server that fails the first failures requests
+func newHealthServer(t *testing.T, failures int32) *httptest.Server {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestCheckHealthOnce tests status and body matching of a single health check
+func TestCheckHealthOnce(t *testing.T) {
+	server := newHealthServer(t, 0)
+
+	tests := []struct {
+		name    string
+		check   HealthCheck
+		healthy bool
+	}{
+		{"status match", HealthCheck{URL: server.URL, ExpectedStatus: 200, TimeoutSeconds: 5}, true},
+		{"body match", HealthCheck{URL: server.URL, ExpectedStatus: 200, BodyContains: `"ok"`, TimeoutSeconds: 5}, true},
+		{"body mismatch", HealthCheck{URL: server.URL, ExpectedStatus: 200, BodyContains: "ready", TimeoutSeconds: 5}, false},
+		{"status mismatch", HealthCheck{URL: server.URL, ExpectedStatus: 204, TimeoutSeconds: 5}, false},
+		{"connection refused", HealthCheck{URL: "http://127.0.0.1:1", ExpectedStatus: 200, TimeoutSeconds: 5}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := checkHealthOnce(context.Background(), &tc.check)
+			if (err == nil) != tc.healthy {
+				t.Errorf("Expected healthy=%t, got error: %v", tc.healthy, err)
+			}
+		})
+	}
+}
+
+// TestDeployHealthCheckRetries tests that the health check is retried until it passes
+func TestDeployHealthCheckRetries(t *testing.T) {
+	server := newHealthServer(t, 2)
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		LocalPath:      t.TempDir(),
+		ExecuteCommand: "echo deployed",
+		HealthCheck:    &HealthCheck{URL: server.URL, ExpectedStatus: 200, Retries: 3, TimeoutSeconds: 5},
+	}
+
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+	if result.HealthCheck == nil || !result.HealthCheck.Healthy || result.HealthCheck.Attempts != 3 {
+		t.Errorf("Expected healthy after 3 attempts, got %+v", result.HealthCheck)
+	}
+}
+
+// TestDeployHealthCheckFailureRunsRollback tests that a failing health check fails the run and runs rollback_command
+func TestDeployHealthCheckFailureRunsRollback(t *testing.T) {
+	polled := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case polled <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:            "TestProject",
+		WebhookPath:     "/hooks/test",
+		LocalPath:       tmpDir,
+		ExecuteCommand:  "echo deployed",
+		HealthCheck:     &HealthCheck{URL: server.URL, ExpectedStatus: 200, Retries: 1, TimeoutSeconds: 5},
+		RollbackCommand: "echo $SDEPLOY_RUN_ID > rollback.txt",
+		Hooks:           DeployHooks{PostDeploySuccess: "touch success.txt"},
+	}
+
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if result.Success {
+		t.Fatal("Expected run to be marked failed")
+	}
+	if !strings.Contains(result.Error, "health check failed after 2 attempts") {
+		t.Errorf("Expected health check error, got: %s", result.Error)
+	}
+	if result.HealthCheck.Healthy || result.HealthCheck.StatusCode != http.StatusBadGateway {
+		t.Errorf("Unexpected health check result: %+v", result.HealthCheck)
+	}
+	if !result.RolledBack {
+		t.Error("Expected RolledBack to be true")
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "rollback.txt"))
+	if err != nil || strings.TrimSpace(string(content)) != result.RunID {
+		t.Errorf("Expected rollback_command to run with run ID, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "success.txt")); !os.IsNotExist(err) {
+		t.Error("Expected post_deploy_success not to run after a failed health check")
+	}
+}
+
+// TestDeployHealthCheckCancelKeepsRelease tests that cancelling a run during
+// health check polling does not roll it back
+func TestDeployHealthCheckCancelKeepsRelease(t *testing.T) {
+	polled := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case polled <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:            "TestProject",
+		WebhookPath:     "/hooks/test",
+		LocalPath:       tmpDir,
+		ExecuteCommand:  "echo deployed",
+		HealthCheck:     &HealthCheck{URL: server.URL, ExpectedStatus: 200, Retries: 5, IntervalSeconds: 5, TimeoutSeconds: 5},
+		RollbackCommand: "touch rollback.txt",
+	}
+
+	done := make(chan DeployResult, 1)
+	go func() { done <- deployer.Deploy(context.Background(), project, "WEBHOOK") }()
+	select {
+	case <-polled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the health check")
+	}
+	if _, err := deployer.Cancel(project.WebhookPath, "api"); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	result := <-done
+	if !result.Cancelled {
+		t.Errorf("Expected a cancelled run, got %+v", result)
+	}
+	if result.RolledBack {
+		t.Error("Expected a cancelled run not to be rolled back")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "rollback.txt")); !os.IsNotExist(err) {
+		t.Error("Expected rollback_command not to run after a cancel")
+	}
+}
+
+// TestDeployHealthCheckReleaseRollback tests that release_mode repoints current after a failed health check
+func TestDeployHealthCheckReleaseRollback(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	pushTestCommit(t, work, "v1")
+
+	deployer := NewDeployer(nil)
+	project := newReleaseProject(t, origin)
+	project.KeepReleases = 1
+
+	first := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !first.Success {
+		t.Fatalf("Expected success, got error: %s (output: %s)", first.Error, first.Output)
+	}
+
+	pushTestCommit(t, work, "v2")
+	project.HealthCheck = &HealthCheck{URL: newHealthServer(t, 100).URL, ExpectedStatus: 200, TimeoutSeconds: 5}
+	second := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if second.Success || !second.RolledBack {
+		t.Fatalf("Expected failed and rolled back run, got success=%t rolled_back=%t", second.Success, second.RolledBack)
+	}
+	if got := readCurrentFile(t, project, "build.txt"); got != "v1" {
+		t.Errorf("Expected current to be rolled back to v1, got %q", got)
+	}
+	if _, err := os.Stat(second.ReleaseDir); !os.IsNotExist(err) {
+		t.Error("Expected unhealthy release to be removed")
+	}
+}
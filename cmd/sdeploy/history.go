@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRunNotFound is returned when a run ID is not present in the history store
+var ErrRunNotFound = errors.New("run not found")
+
+// HistoryStore persists deployment results as JSON files under <state_dir>/history
+// Layout: <state_dir>/history/<project-key>/<run-id>.json
+type HistoryStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewHistoryStore creates a history store rooted at the given state directory
+func NewHistoryStore(stateDir string) (*HistoryStore, error) {
+	if stateDir == "" {
+		return nil, fmt.Errorf("state_dir is not configured")
+	}
+	dir := filepath.Join(stateDir, "history")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &HistoryStore{dir: dir}, nil
+}
+
+// Dir returns the history directory
+func (s *HistoryStore) Dir() string {
+	return s.dir
+}
+
+// newRunID generates a unique, time-ordered run ID (e.g., 20240115-103000-123456-1a2b3c4d)
+func newRunID() string {
+	// Microseconds keep runs started within the same second in order
+	now := time.Now()
+	stamp := fmt.Sprintf("%s-%06d", now.Format("20060102-150405"), now.Nanosecond()/int(time.Microsecond))
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		// Fall back to nanoseconds if the random source is unavailable
+		return fmt.Sprintf("%s-%08x", stamp, uint32(now.UnixNano()))
+	}
+	return fmt.Sprintf("%s-%s", stamp, hex.EncodeToString(buf))
+}
+
+// isValidRunID checks that a run ID is safe to use as a file name
+func isValidRunID(runID string) bool {
+	if runID == "" || strings.Contains(runID, "..") {
+		return false
+	}
+	for _, r := range runID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// projectKey returns a file-system safe key for a project, based on its name
+// (or webhook path when no name is configured)
+func projectKey(project *ProjectConfig) string {
+	name := project.Name
+	if name == "" {
+		name = project.WebhookPath
+	}
+	key := slugify(name)
+	if key == "" {
+		key = "default"
+	}
+	return key
+}
+
+// slugify lowercases a name and replaces characters other than letters,
+// digits, '.' and '_' with '-' (e.g., feature/Login becomes feature-login)
+func slugify(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-.")
+}
+
+// truncateOutput keeps the last limit bytes of output, marking the cut
+func truncateOutput(output string, limit int) string {
+	if limit <= 0 || len(output) <= limit {
+		return output
+	}
+	return "... [truncated] ...\n" + output[len(output)-limit:]
+}
+
+// Record persists a deployment result and prunes old runs beyond keep
+func (s *HistoryStore) Record(key string, result *DeployResult, keep int) error {
+	if !isValidRunID(result.RunID) {
+		return fmt.Errorf("invalid run ID: %q", result.RunID)
+	}
+
+	stored := *result
+	stored.Output = truncateOutput(stored.Output, Defaults.HistoryOutputLimit)
+
+	data, err := json.MarshalIndent(&stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	projectDir := filepath.Join(s.dir, key)
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		return fmt.Errorf("failed to create project history directory: %w", err)
+	}
+
+	// Write to a temp file first so readers never see a partial record
+	path := filepath.Join(projectDir, result.RunID+".json")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+
+	return s.prune(projectDir, keep)
+}
+
+// prune removes the oldest runs of a project beyond keep (caller must hold mu)
+func (s *HistoryStore) prune(projectDir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	ids, err := listRunIDs(projectDir)
+	if err != nil {
+		return err
+	}
+	for len(ids) > keep {
+		if err := os.Remove(filepath.Join(projectDir, ids[0]+".json")); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to prune run %s: %w", ids[0], err)
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// listRunIDs returns run IDs stored in a project directory, oldest first
+func listRunIDs(projectDir string) ([]string, error) {
+	entries, err := os.ReadDir(projectDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// List returns up to limit runs for a project, newest first (limit <= 0 returns all)
+func (s *HistoryStore) List(key string, limit int) ([]DeployResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	projectDir := filepath.Join(s.dir, key)
+	ids, err := listRunIDs(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []DeployResult
+	for i := len(ids) - 1; i >= 0; i-- {
+		if limit > 0 && len(runs) >= limit {
+			break
+		}
+		run, err := readRun(filepath.Join(projectDir, ids[i]+".json"))
+		if err != nil {
+			continue
+		}
+		runs = append(runs, *run)
+	}
+	return runs, nil
+}
+
+// Get returns the run with the given ID
+func (s *HistoryStore) Get(runID string) (*DeployResult, error) {
+	if !isValidRunID(runID) {
+		return nil, ErrRunNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*", runID+".json"))
+	if err != nil || len(matches) == 0 {
+		return nil, ErrRunNotFound
+	}
+	return readRun(matches[0])
+}
+
+// readRun decodes a single run file
+func readRun(path string) (*DeployResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var run DeployResult
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to decode run %s: %w", filepath.Base(path), err)
+	}
+	return &run, nil
+}
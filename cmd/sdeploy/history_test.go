@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNewRunIDUnique tests that run IDs are unique and file-system safe
+func TestNewRunIDUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := newRunID()
+		if !isValidRunID(id) {
+			t.Fatalf("Expected valid run ID, got %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("Duplicate run ID generated: %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+// TestNewRunIDOrdered tests that run IDs started within the same second sort in start order
+func TestNewRunIDOrdered(t *testing.T) {
+	prev := newRunID()
+	for i := 0; i < 20; i++ {
+		time.Sleep(time.Millisecond)
+		id := newRunID()
+		if id <= prev {
+			t.Fatalf("Expected %q to sort after %q", id, prev)
+		}
+		prev = id
+	}
+}
+
+// TestIsValidRunID tests run ID validation against path traversal
+func TestIsValidRunID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"20240115-103000-1a2b3c4d", true},
+		{"", false},
+		{"../etc/passwd", false},
+		{"run/1", false},
+		{"run..1", false},
+	}
+
+	for _, tc := range tests {
+		if got := isValidRunID(tc.id); got != tc.valid {
+			t.Errorf("isValidRunID(%q) = %t, expected %t", tc.id, got, tc.valid)
+		}
+	}
+}
+
+// TestProjectKey tests project key sanitization
+func TestProjectKey(t *testing.T) {
+	tests := []struct {
+		project  ProjectConfig
+		expected string
+	}{
+		{ProjectConfig{Name: "Frontend App"}, "frontend-app"},
+		{ProjectConfig{Name: "api_v2"}, "api_v2"},
+		{ProjectConfig{WebhookPath: "/hooks/backend"}, "hooks-backend"},
+		{ProjectConfig{Name: "../../etc"}, "etc"},
+		{ProjectConfig{}, "default"},
+	}
+
+	for _, tc := range tests {
+		if got := projectKey(&tc.project); got != tc.expected {
+			t.Errorf("projectKey(%+v) = %q, expected %q", tc.project, got, tc.expected)
+		}
+	}
+}
+
+// TestHistoryStoreRecordAndGet tests persisting and reading back a run
+func TestHistoryStoreRecordAndGet(t *testing.T) {
+	store, err := NewHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewHistoryStore failed: %v", err)
+	}
+
+	result := &DeployResult{
+		RunID:         "20240115-103000-aaaaaaaa",
+		Project:       "Frontend",
+		TriggerSource: "WEBHOOK",
+		Branch:        "main",
+		Commit:        "abc123",
+		Success:       true,
+		Output:        "build ok",
+		StartTime:     time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+		EndTime:       time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC),
+	}
+
+	if err := store.Record("frontend", result, 10); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	got, err := store.Get(result.RunID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Project != "Frontend" || got.Commit != "abc123" || got.Output != "build ok" || !got.Success {
+		t.Errorf("Unexpected run read back: %+v", got)
+	}
+	if got.Duration() != 45*time.Second {
+		t.Errorf("Expected duration 45s, got %v", got.Duration())
+	}
+
+	if _, err := store.Get("20240115-103000-bbbbbbbb"); err != ErrRunNotFound {
+		t.Errorf("Expected ErrRunNotFound for unknown run, got %v", err)
+	}
+	if _, err := store.Get("../frontend"); err != ErrRunNotFound {
+		t.Errorf("Expected ErrRunNotFound for invalid run ID, got %v", err)
+	}
+}
+
+// TestHistoryStoreRetention tests that old runs are pruned per project
+func TestHistoryStoreRetention(t *testing.T) {
+	store, err := NewHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewHistoryStore failed: %v", err)
+	}
+
+	ids := []string{
+		"20240115-100000-00000001",
+		"20240115-100001-00000002",
+		"20240115-100002-00000003",
+		"20240115-100003-00000004",
+	}
+	for _, id := range ids {
+		if err := store.Record("frontend", &DeployResult{RunID: id}, 2); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	// A different project is not affected by frontend's retention
+	if err := store.Record("backend", &DeployResult{RunID: ids[0]}, 2); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	runs, err := store.List("frontend", 0)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("Expected 2 retained runs, got %d", len(runs))
+	}
+	// Newest first
+	if runs[0].RunID != ids[3] || runs[1].RunID != ids[2] {
+		t.Errorf("Expected newest runs %s, %s; got %s, %s", ids[3], ids[2], runs[0].RunID, runs[1].RunID)
+	}
+
+	limited, _ := store.List("frontend", 1)
+	if len(limited) != 1 {
+		t.Errorf("Expected List limit to return 1 run, got %d", len(limited))
+	}
+
+	backend, _ := store.List("backend", 0)
+	if len(backend) != 1 {
+		t.Errorf("Expected backend to keep its run, got %d", len(backend))
+	}
+}
+
+// TestHistoryStoreTruncatesOutput tests that stored output is truncated
+func TestHistoryStoreTruncatesOutput(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewHistoryStore(dir)
+	if err != nil {
+		t.Fatalf("NewHistoryStore failed: %v", err)
+	}
+
+	output := strings.Repeat("x", Defaults.HistoryOutputLimit) + "tail"
+	result := &DeployResult{RunID: "20240115-100000-00000001", Output: output}
+	if err := store.Record("frontend", result, 10); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	// The caller's result is left untouched
+	if result.Output != output {
+		t.Error("Expected Record not to modify the caller's result")
+	}
+
+	got, err := store.Get(result.RunID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !strings.HasPrefix(got.Output, "... [truncated] ...") || !strings.HasSuffix(got.Output, "tail") {
+		t.Errorf("Expected truncated output keeping the tail, got %d bytes", len(got.Output))
+	}
+}
+
+// TestNewHistoryStoreErrors tests history store creation errors
+func TestNewHistoryStoreErrors(t *testing.T) {
+	if _, err := NewHistoryStore(""); err == nil {
+		t.Error("Expected error for empty state_dir")
+	}
+
+	filePath := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(filePath, []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if _, err := NewHistoryStore(filePath); err == nil {
+		t.Error("Expected error when state_dir is a file")
+	}
+}
+
+// TestDeployRecordsHistory tests that every Deploy invocation is recorded with a run ID
+func TestDeployRecordsHistory(t *testing.T) {
+	store, err := NewHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewHistoryStore failed: %v", err)
+	}
+
+	deployer := NewDeployer(nil)
+	deployer.SetHistoryStore(store)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		GitBranch:      "main",
+		ExecuteCommand: "echo hello && exit 3",
+	}
+
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if result.RunID == "" {
+		t.Fatal("Expected run ID to be assigned")
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+	}
+
+	stored, err := store.Get(result.RunID)
+	if err != nil {
+		t.Fatalf("Expected run to be persisted: %v", err)
+	}
+	if stored.Project != "TestProject" || stored.TriggerSource != "WEBHOOK" || stored.Branch != "main" {
+		t.Errorf("Unexpected stored run: %+v", stored)
+	}
+	if stored.Success || stored.ExitCode != 3 || !strings.Contains(stored.Output, "hello") {
+		t.Errorf("Expected failed run with exit code 3 and output, got: %+v", stored)
+	}
+
+	second := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if second.RunID == result.RunID {
+		t.Error("Expected each deployment to get a unique run ID")
+	}
+
+	runs, _ := store.List(projectKey(project), 0)
+	if len(runs) != 2 {
+		t.Errorf("Expected 2 recorded runs, got %d", len(runs))
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Hook names, as used in config, logs and results
+const (
+	HookPreDeploy         = "pre_deploy"
+	HookPostDeploySuccess = "post_deploy_success"
+	HookPostDeployFailure = "post_deploy_failure"
+	HookAlways            = "always"
+)
+
+// configuredHooks returns the names of the configured hooks
+func configuredHooks(hooks DeployHooks) []string {
+	var names []string
+	for _, hook := range []struct{ name, command string }{
+		{HookPreDeploy, hooks.PreDeploy},
+		{HookPostDeploySuccess, hooks.PostDeploySuccess},
+		{HookPostDeployFailure, hooks.PostDeployFailure},
+		{HookAlways, hooks.Always},
+	} {
+		if hook.command != "" {
+			names = append(names, hook.name)
+		}
+	}
+	return names
+}
+
+// runHook runs a hook command (if configured) with the project's timeout and
+// records its result. Returns the command error.
+func (d *Deployer) runHook(ctx context.Context, project *ProjectConfig, result *DeployResult, name, command, dir string, env []string) error {
+	if command == "" {
+		return nil
+	}
+
+	if d.logger != nil {
+		d.logger.InfofContext(ctx, project.Name, "Running %s hook", name)
+	}
+
+	hook := StepResult{Name: name, Command: command, StartTime: time.Now()}
+	output, err := d.runCommand(ctx, project, commandSpec{
+		command:        command,
+		dir:            dir,
+		timeoutSeconds: project.TimeoutSeconds,
+		env:            env,
+	})
+	hook.EndTime = time.Now()
+	hook.Output = output
+	hook.ExitCode = exitCodeFromError(err)
+	hook.Success = err == nil
+	if err != nil {
+		hook.Error = err.Error()
+	}
+	result.Hooks = append(result.Hooks, hook)
+
+	if err != nil && d.logger != nil {
+		d.logger.LogAttrs(slog.LevelError, project.Name, fmt.Sprintf("%s hook failed: %v", name, err), append(runAttrs(result), stepAttrs(&hook)...)...)
+	}
+	return err
+}
+
+// runPostDeployHooks runs post_deploy_success or post_deploy_failure, then always.
+// Hooks receive the outcome via SDEPLOY_DEPLOY_STATUS, SDEPLOY_DEPLOY_ERROR and
+// SDEPLOY_EXIT_CODE. Hook failures are recorded but do not change the outcome.
+func (d *Deployer) runPostDeployHooks(ctx context.Context, project *ProjectConfig, result *DeployResult, dir string) {
+	hooks := project.Hooks
+	if result.Skipped || hooks.PostDeploySuccess == "" && hooks.PostDeployFailure == "" && hooks.Always == "" {
+		return
+	}
+
+	// Hooks must run even if the deployment itself was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	env := append(deployEnv(project, result),
+		fmt.Sprintf("SDEPLOY_DEPLOY_STATUS=%s", result.Status()),
+		fmt.Sprintf("SDEPLOY_DEPLOY_ERROR=%s", result.Error),
+		fmt.Sprintf("SDEPLOY_EXIT_CODE=%s", strconv.Itoa(result.ExitCode)),
+	)
+
+	if result.Success {
+		d.runHook(ctx, project, result, HookPostDeploySuccess, hooks.PostDeploySuccess, dir, env)
+	} else {
+		d.runHook(ctx, project, result, HookPostDeployFailure, hooks.PostDeployFailure, dir, env)
+	}
+	d.runHook(ctx, project, result, HookAlways, hooks.Always, dir, env)
+
+	result.EndTime = time.Now()
+}
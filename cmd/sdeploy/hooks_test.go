@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// hookNames returns the names of the hooks that ran, in order
+func hookNames(result DeployResult) string {
+	names := make([]string, 0, len(result.Hooks))
+	for _, hook := range result.Hooks {
+		names = append(names, hook.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// TestDeployHooksSuccess tests hook order and env for a successful deployment
+func TestDeployHooksSuccess(t *testing.T) {
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		LocalPath:      tmpDir,
+		ExecuteCommand: "echo build >> order.txt",
+		Hooks: DeployHooks{
+			PreDeploy:         "echo pre_deploy >> order.txt",
+			PostDeploySuccess: "echo \"post_deploy_success $SDEPLOY_DEPLOY_STATUS $SDEPLOY_EXIT_CODE\" >> order.txt",
+			PostDeployFailure: "echo post_deploy_failure >> order.txt",
+			Always:            "echo \"always $SDEPLOY_RUN_ID\" >> order.txt",
+		},
+	}
+
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+	if got := hookNames(result); got != "pre_deploy,post_deploy_success,always" {
+		t.Errorf("Expected hooks pre_deploy,post_deploy_success,always, got %s", got)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "order.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read order file: %v", err)
+	}
+	expected := "pre_deploy\nbuild\npost_deploy_success success 0\nalways " + result.RunID + "\n"
+	if string(content) != expected {
+		t.Errorf("Expected order:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+// TestDeployHooksFailure tests that failure hooks get the deployment error
+func TestDeployHooksFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		LocalPath:      tmpDir,
+		ExecuteCommand: "exit 4",
+		Hooks: DeployHooks{
+			PostDeploySuccess: "echo post_deploy_success >> hooks.txt",
+			PostDeployFailure: "echo \"$SDEPLOY_DEPLOY_STATUS $SDEPLOY_EXIT_CODE $SDEPLOY_DEPLOY_ERROR\" >> hooks.txt",
+			Always:            "exit 1",
+		},
+	}
+
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if result.Success || result.ExitCode != 4 {
+		t.Fatalf("Expected failure with exit code 4, got success=%t exit=%d", result.Success, result.ExitCode)
+	}
+	if got := hookNames(result); got != "post_deploy_failure,always" {
+		t.Errorf("Expected hooks post_deploy_failure,always, got %s", got)
+	}
+	// A failing always hook is recorded but does not change the outcome
+	if result.Hooks[1].Success || result.Hooks[1].ExitCode != 1 {
+		t.Errorf("Expected failed always hook with exit code 1, got %+v", result.Hooks[1])
+	}
+	if result.Error != "exit status 4" {
+		t.Errorf("Expected deployment error to be unchanged, got %q", result.Error)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(tmpDir, "hooks.txt"))
+	if strings.TrimSpace(string(content)) != "failed 4 exit status 4" {
+		t.Errorf("Expected failure hook env, got %q", content)
+	}
+}
+
+// TestDeployPreDeployHookFailure tests that a failing pre_deploy hook aborts the build
+func TestDeployPreDeployHookFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		LocalPath:      tmpDir,
+		ExecuteCommand: "touch built.txt",
+		Hooks: DeployHooks{
+			PreDeploy: "exit 7",
+			Always:    "touch always.txt",
+		},
+	}
+
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if result.Success {
+		t.Fatal("Expected deployment to fail")
+	}
+	if !strings.Contains(result.Error, "pre_deploy hook failed") || result.ExitCode != 7 {
+		t.Errorf("Expected pre_deploy failure with exit code 7, got error=%q exit=%d", result.Error, result.ExitCode)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "built.txt")); !os.IsNotExist(err) {
+		t.Error("Expected build not to run after pre_deploy failure")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "always.txt")); err != nil {
+		t.Error("Expected always hook to run after pre_deploy failure")
+	}
+}
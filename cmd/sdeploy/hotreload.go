@@ -17,6 +17,7 @@ type ConfigManager struct {
 	watcher       *fsnotify.Watcher
 	stopChan      chan struct{}
 	reloadPending atomic.Bool
+	metrics       *Metrics
 
 	// Callback functions for notifying dependent components
 	onReload func(*Config)
@@ -39,6 +40,11 @@ func NewConfigManager(configPath string, logger *Logger) (*ConfigManager, error)
 	return cm, nil
 }
 
+// SetMetrics sets the metrics registry used to count reloads
+func (cm *ConfigManager) SetMetrics(metrics *Metrics) {
+	cm.metrics = metrics
+}
+
 // GetConfig returns the current configuration (thread-safe read)
 func (cm *ConfigManager) GetConfig() *Config {
 	cm.mu.RLock()
@@ -58,6 +64,18 @@ func (cm *ConfigManager) GetProject(webhookPath string) *ProjectConfig {
 	return nil
 }
 
+// GetProjectByName returns a project config by name (thread-safe read)
+func (cm *ConfigManager) GetProjectByName(name string) *ProjectConfig {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	for i := range cm.config.Projects {
+		if cm.config.Projects[i].Name == name {
+			return &cm.config.Projects[i]
+		}
+	}
+	return nil
+}
+
 // SetOnReload sets the callback function to be called after successful reload
 func (cm *ConfigManager) SetOnReload(callback func(*Config)) {
 	cm.mu.Lock()
@@ -147,12 +165,14 @@ func (cm *ConfigManager) reloadConfig() {
 		if cm.logger != nil {
 			cm.logger.Errorf("", "Failed to reload configuration: %v", err)
 		}
+		cm.metrics.IncReload(false)
 		return
 	}
 
 	// Check if listen_port changed (not hot-reloadable)
 	cm.mu.RLock()
 	oldPort := cm.config.ListenPort
+	oldMetricsPath, oldMetricsPort := cm.config.MetricsPath, cm.config.MetricsPort
 	cm.mu.RUnlock()
 
 	if newConfig.ListenPort != oldPort {
@@ -161,11 +181,19 @@ func (cm *ConfigManager) reloadConfig() {
 		}
 	}
 
+	// Metrics routes are mounted at startup (not hot-reloadable)
+	if newConfig.MetricsPath != oldMetricsPath || newConfig.MetricsPort != oldMetricsPort {
+		if cm.logger != nil {
+			cm.logger.Warn("", "metrics_path/metrics_port changed. Restart required for this change to take effect.")
+		}
+	}
+
 	// Apply the new configuration
 	cm.mu.Lock()
 	cm.config = newConfig
 	onReload := cm.onReload
 	cm.mu.Unlock()
+	cm.metrics.IncReload(true)
 
 	if cm.logger != nil {
 		cm.logger.Info("", "Configuration reloaded successfully")
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Log output formats selected by log_format
+const (
+	LogFormatText = "text" // [timestamp] [LEVEL] [project] message
+	LogFormatJSON = "json" // one JSON object per line
+)
+
 // Logger provides thread-safe logging with configurable output
 type Logger struct {
 	mu         sync.Mutex
@@ -17,6 +26,14 @@ type Logger struct {
 	file       *os.File
 	filePath   string
 	daemonMode bool
+	format     string
+	handler    slog.Handler
+	writeErr   error // last write error, cleared by the next successful write
+	rotation   LogRotation
+	size       int64 // current size of the log file, for size-based rotation
+	redactor   *Redactor
+	mill       sync.WaitGroup // background compression and cleanup of rotated files
+	millMu     sync.Mutex     // serializes background compression and cleanup
 }
 
 // NewLogger creates a new logger instance
@@ -29,6 +46,7 @@ func NewLogger(writer io.Writer, filePath string, daemonMode bool) *Logger {
 	l := &Logger{
 		daemonMode: daemonMode,
 	}
+	l.setFormat(LogFormatText)
 
 	// If writer is provided, use it directly (for testing)
 	if writer != nil {
@@ -49,24 +67,75 @@ func NewLogger(writer io.Writer, filePath string, daemonMode bool) *Logger {
 		logPath = filePath
 	}
 	l.filePath = logPath
+	l.openFile()
+	return l
+}
 
+// openFile opens l.filePath in append mode, falling back to stderr on failure.
+// Caller must hold l.mu or own l.
+func (l *Logger) openFile() {
 	// Ensure parent directory exists
-	if err := ensureParentDir(logPath); err != nil {
-		reportLogFileError("create directory", filepath.Dir(logPath), err, "0755")
+	if err := ensureParentDir(l.filePath); err != nil {
+		reportLogFileError("create directory", filepath.Dir(l.filePath), err, "0755")
 		l.writer = os.Stderr
-		return l
+		return
 	}
 
-	// Open log file
-	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	// Open log file, keeping previous content
+	file, err := os.OpenFile(l.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		reportLogFileError("open/create file", logPath, err, "0644")
+		reportLogFileError("open/create file", l.filePath, err, "0644")
 		l.writer = os.Stderr
-	} else {
-		l.file = file
-		l.writer = file
+		return
+	}
+
+	l.file = file
+	l.writer = file
+	l.size = 0
+	if info, err := file.Stat(); err == nil {
+		l.size = info.Size()
 	}
-	return l
+}
+
+// Reopen closes and reopens the log file, e.g., after an external logrotate
+// moved it away. It does nothing when not logging to a file.
+func (l *Logger) Reopen() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.filePath == "" {
+		return
+	}
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	l.openFile()
+}
+
+// SetFilePath switches the daemon log file to path (Defaults.LogPath if empty).
+// It does nothing in console mode or when the path is unchanged.
+func (l *Logger) SetFilePath(path string) {
+	if path == "" {
+		path = Defaults.LogPath
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.filePath == "" || l.filePath == path {
+		return
+	}
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	l.filePath = path
+	l.openFile()
+}
+
+// FilePath returns the log file path, or "" when logging to the console
+func (l *Logger) FilePath() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.filePath
 }
 
 // reportLogFileError outputs a detailed error message to stderr when log file operations fail
@@ -134,45 +203,173 @@ func (l *Logger) IsDaemonMode() bool {
 	return l.daemonMode
 }
 
-// Close closes the underlying file if one was opened
+// Close closes the underlying file if one was opened and waits for rotated
+// files to be compressed
 func (l *Logger) Close() {
 	l.mu.Lock()
-	defer l.mu.Unlock()
 	if l.file != nil {
 		l.file.Close()
 		l.file = nil
 	}
+	l.mu.Unlock()
+	l.mill.Wait()
+}
+
+// SetFormat switches the output format (text or json); unknown formats fall back to text
+func (l *Logger) SetFormat(format string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.setFormat(format)
+}
+
+// setFormat builds the slog handler for format; caller must hold l.mu or own l
+func (l *Logger) setFormat(format string) {
+	out := loggerOutput{l}
+	if format == LogFormatJSON {
+		l.format = LogFormatJSON
+		l.handler = slog.NewJSONHandler(out, &slog.HandlerOptions{ReplaceAttr: replaceJSONAttr})
+		return
+	}
+	l.format = LogFormatText
+	l.handler = &textHandler{out: out}
+}
+
+// SetRedactor sets the redactor applied to every message and string attribute
+func (l *Logger) SetRedactor(redactor *Redactor) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redactor = redactor
+}
+
+// IsJSON returns whether the logger writes JSON lines
+func (l *Logger) IsJSON() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.format == LogFormatJSON
 }
 
 // log writes a log message with the specified level
-func (l *Logger) log(level, project, message string) {
+func (l *Logger) log(level slog.Level, project, message string, attrs ...slog.Attr) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	record := slog.NewRecord(time.Now(), level, l.redactor.Redact(message), 0)
+	if project != "" {
+		record.AddAttrs(slog.String("project", project))
+	}
+	record.AddAttrs(l.redactor.redactAttrs(attrs)...)
+	_ = l.handler.Handle(context.Background(), record)
+}
+
+// LogAttrs logs a message with structured attributes. Attributes appear as
+// JSON fields in json format; text format prints only the message.
+func (l *Logger) LogAttrs(level slog.Level, project, message string, attrs ...slog.Attr) {
+	l.log(level, project, message, attrs...)
+}
+
+// loggerOutput writes handler output to the logger's current writer and
+// records write errors. Handlers only write while l.mu is held.
+type loggerOutput struct {
+	l *Logger
+}
+
+// Write implements io.Writer
+func (o loggerOutput) Write(p []byte) (int, error) {
+	l := o.l
+	if l.file != nil && l.rotation.needsRotation(l.size, len(p)) {
+		l.rotate()
+	}
+	n, err := l.writer.Write(p)
+	l.size += int64(n)
+	l.writeErr = err
+	return n, err
+}
+
+// textHandler is a slog.Handler producing the classic
+// "[timestamp] [LEVEL] [project] message" lines
+type textHandler struct {
+	out io.Writer
+}
+
+// Enabled implements slog.Handler
+func (h *textHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+// Handle implements slog.Handler
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	project := ""
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "project" {
+			project = a.Value.String()
+			return false
+		}
+		return true
+	})
+
+	timestamp := r.Time.Format("2006-01-02 15:04:05")
 	var logLine string
 	if project == "" {
 		// No project specified, use simpler format without empty brackets
-		logLine = fmt.Sprintf("[%s] [%s] %s\n", timestamp, level, message)
+		logLine = fmt.Sprintf("[%s] [%s] %s\n", timestamp, r.Level, r.Message)
 	} else {
-		logLine = fmt.Sprintf("[%s] [%s] [%s] %s\n", timestamp, level, project, message)
+		logLine = fmt.Sprintf("[%s] [%s] [%s] %s\n", timestamp, r.Level, project, r.Message)
+	}
+	_, err := h.out.Write([]byte(logLine))
+	return err
+}
+
+// WithAttrs implements slog.Handler (attributes are not rendered in text format)
+func (h *textHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+// WithGroup implements slog.Handler
+func (h *textHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// replaceJSONAttr renames slog's built-in keys to ts/level/msg and lowercases levels
+func replaceJSONAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		a.Key = "ts"
+	case slog.LevelKey:
+		a.Value = slog.StringValue(strings.ToLower(a.Value.String()))
+	}
+	return a
+}
+
+// Health reports whether log output is working: it returns an error if the
+// daemon log file could not be opened or the last write failed
+func (l *Logger) Health() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.writeErr != nil {
+		return fmt.Errorf("log write failed: %w", l.writeErr)
+	}
+	if l.daemonMode && l.filePath != "" && l.file == nil {
+		return fmt.Errorf("log file %s unavailable, logging to stderr", l.filePath)
 	}
-	_, _ = l.writer.Write([]byte(logLine))
+	return nil
 }
 
 // Info logs an informational message
 func (l *Logger) Info(project, message string) {
-	l.log("INFO", project, message)
+	l.log(slog.LevelInfo, project, message)
 }
 
 // Warn logs a warning message
 func (l *Logger) Warn(project, message string) {
-	l.log("WARN", project, message)
+	l.log(slog.LevelWarn, project, message)
 }
 
 // Error logs an error message
 func (l *Logger) Error(project, message string) {
-	l.log("ERROR", project, message)
+	l.log(slog.LevelError, project, message)
 }
 
 // Infof logs a formatted informational message
@@ -189,3 +386,19 @@ func (l *Logger) Warnf(project, format string, args ...interface{}) {
 func (l *Logger) Errorf(project, format string, args ...interface{}) {
 	l.Error(project, fmt.Sprintf(format, args...))
 }
+
+// InfofContext logs a formatted informational message with the log attributes
+// of the run ctx belongs to (run_id, trigger)
+func (l *Logger) InfofContext(ctx context.Context, project, format string, args ...interface{}) {
+	l.log(slog.LevelInfo, project, fmt.Sprintf(format, args...), runContextAttrs(ctx)...)
+}
+
+// WarnfContext logs a formatted warning message with the log attributes of the run ctx belongs to
+func (l *Logger) WarnfContext(ctx context.Context, project, format string, args ...interface{}) {
+	l.log(slog.LevelWarn, project, fmt.Sprintf(format, args...), runContextAttrs(ctx)...)
+}
+
+// ErrorfContext logs a formatted error message with the log attributes of the run ctx belongs to
+func (l *Logger) ErrorfContext(ctx context.Context, project, format string, args ...interface{}) {
+	l.log(slog.LevelError, project, fmt.Sprintf(format, args...), runContextAttrs(ctx)...)
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -447,3 +450,153 @@ func TestLoggerConsoleModeIgnoresFilePath(t *testing.T) {
 		t.Error("Expected log file to NOT be created in console mode")
 	}
 }
+
+// TestLoggerJSONFormat tests one JSON object per line with structured attributes
+func TestLoggerJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	logger.SetFormat(LogFormatJSON)
+
+	logger.Info("", "Service started")
+	logger.LogAttrs(slog.LevelError, "TestProject", "Command output",
+		slog.String("run_id", "20240115-103000-abcd"), slog.String("output", "line 1\nline 2"), slog.Int("exit_code", 2))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 JSON lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var first, second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Failed to parse JSON log line %q: %v", lines[0], err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("Failed to parse JSON log line %q: %v", lines[1], err)
+	}
+
+	if first["level"] != "info" || first["msg"] != "Service started" || first["ts"] == nil {
+		t.Errorf("Unexpected first record: %v", first)
+	}
+	if _, ok := first["project"]; ok {
+		t.Errorf("Expected no project field for global messages, got %v", first)
+	}
+	if second["level"] != "error" || second["project"] != "TestProject" || second["run_id"] != "20240115-103000-abcd" {
+		t.Errorf("Unexpected second record: %v", second)
+	}
+	if second["output"] != "line 1\nline 2" || second["exit_code"] != float64(2) {
+		t.Errorf("Expected structured output and exit_code, got %v", second)
+	}
+}
+
+// TestLoggerTextFormatIgnoresAttrs tests that text format keeps the classic line layout
+func TestLoggerTextFormatIgnoresAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+
+	logger.LogAttrs(slog.LevelWarn, "TestProject", "Skipped", slog.String("run_id", "abc"))
+
+	output := buf.String()
+	if !strings.HasSuffix(output, "] [WARN] [TestProject] Skipped\n") {
+		t.Errorf("Expected classic text line, got %q", output)
+	}
+
+	// Unknown formats fall back to text
+	buf.Reset()
+	logger.SetFormat("xml")
+	logger.Info("", "hello")
+	if !strings.HasSuffix(buf.String(), "] [INFO] hello\n") {
+		t.Errorf("Expected text fallback, got %q", buf.String())
+	}
+}
+
+// TestDeployJSONLogs tests that deployment lifecycle lines carry run attributes in JSON format
+func TestDeployJSONLogs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	logger.SetFormat(LogFormatJSON)
+
+	deployer := NewDeployer(logger)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecuteCommand: "echo first; echo second",
+	}
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+
+	records := map[string]map[string]interface{}{}
+	var outputs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to parse JSON log line %q: %v", line, err)
+		}
+		msg, _ := record["msg"].(string)
+		records[strings.SplitN(msg, " in ", 2)[0]] = record
+		if msg == "Command output" {
+			outputs = append(outputs, record)
+		}
+	}
+
+	// Command output is logged line by line as it is produced
+	if len(outputs) != 2 || outputs[0]["output"] != "first" || outputs[1]["output"] != "second" {
+		t.Fatalf("Expected one command output record per line, got %v", outputs)
+	}
+	if outputs[0]["run_id"] != result.RunID || outputs[0]["stream"] != "stdout" {
+		t.Errorf("Expected command output record with run_id and stream, got %v", outputs[0])
+	}
+	completed := records["Deployment completed"]
+	if completed == nil || completed["run_id"] != result.RunID || completed["trigger"] != "INTERNAL" {
+		t.Fatalf("Expected completion record with run attributes, got %v", completed)
+	}
+	if _, ok := completed["duration_ms"]; !ok || completed["exit_code"] != float64(0) {
+		t.Errorf("Expected duration_ms and exit_code on completion record, got %v", completed)
+	}
+	if exec := records["Executing command"]; exec == nil || exec["command"] != project.ExecuteCommand {
+		t.Errorf("Expected single executing command record, got %v", exec)
+	}
+}
+
+// TestDeployJSONLogsRunAttrs tests that every record logged during a run,
+// including git operations, preflight checks and hooks, carries run_id and trigger
+func TestDeployJSONLogsRunAttrs(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	pushTestCommit(t, work, "v1")
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	logger.SetFormat(LogFormatJSON)
+	deployer := NewDeployer(logger)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		GitRepo:        origin,
+		GitBranch:      "main",
+		GitUpdate:      true,
+		LocalPath:      filepath.Join(t.TempDir(), "app"),
+		ExecuteCommand: "echo deployed",
+		Hooks:          DeployHooks{PreDeploy: "true", Always: "true"},
+	}
+
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+	}
+
+	messages := 0
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to parse JSON log line %q: %v", line, err)
+		}
+		messages++
+		if record["run_id"] != result.RunID || record["trigger"] != "INTERNAL" {
+			t.Errorf("Expected run attributes on every run record, got %v", record)
+		}
+	}
+	if messages < 10 {
+		t.Errorf("Expected git, preflight and hook records, got %d records:\n%s", messages, buf.String())
+	}
+}
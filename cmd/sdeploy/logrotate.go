@@ -0,0 +1,166 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the timestamp suffix of rotated log files
+// (e.g., sdeploy.log.20240115-103000.000, or .gz when compressed)
+const backupTimeFormat = "20060102-150405.000"
+
+// LogRotation configures built-in rotation of the daemon log file
+type LogRotation struct {
+	MaxSizeMB  int  // Rotate once the file would exceed this size; 0 disables rotation
+	MaxBackups int  // Rotated files to keep; 0 keeps all
+	MaxAgeDays int  // Remove rotated files older than this; 0 disables age-based removal
+	Compress   bool // Gzip rotated files
+}
+
+// SetRotation sets the rotation policy of the daemon log file
+func (l *Logger) SetRotation(rotation LogRotation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotation = rotation
+}
+
+// needsRotation reports whether writing n more bytes to a file of size bytes
+// exceeds the size limit. A single oversized write to an empty file is allowed.
+func (r LogRotation) needsRotation(size int64, n int) bool {
+	if r.MaxSizeMB <= 0 || size == 0 {
+		return false
+	}
+	return size+int64(n) > int64(r.MaxSizeMB)*1024*1024
+}
+
+// rotate moves the current log file to a timestamped backup and opens a fresh
+// file. Compressing the backup and removing old backups happen in the
+// background, so logging does not wait for them. Caller must hold l.mu.
+func (l *Logger) rotate() {
+	l.file.Close()
+	l.file = nil
+
+	backup := l.filePath + "." + time.Now().Format(backupTimeFormat)
+	if err := os.Rename(l.filePath, backup); err != nil {
+		fmt.Fprintf(os.Stderr, "[SDeploy] Log rotation failed: %v\n", err)
+		backup = ""
+	}
+
+	l.openFile()
+
+	logPath, rotation := l.filePath, l.rotation
+	l.mill.Add(1)
+	go func() {
+		defer l.mill.Done()
+		l.millMu.Lock()
+		defer l.millMu.Unlock()
+		millLogBackups(logPath, rotation, backup)
+	}()
+}
+
+// millLogBackups compresses a rotated file (if enabled) and removes old backups
+func millLogBackups(logPath string, rotation LogRotation, backup string) {
+	if backup != "" && rotation.Compress {
+		// The backup may already be pruned by an earlier rotation's cleanup
+		if err := compressFile(backup); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "[SDeploy] Log compression failed: %v\n", err)
+		}
+	}
+	if err := pruneLogBackups(logPath, rotation, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "[SDeploy] Log backup cleanup failed: %v\n", err)
+	}
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// logBackup is a rotated log file and the time it was rotated
+type logBackup struct {
+	path string
+	time time.Time
+}
+
+// listLogBackups returns the rotated files of logPath, oldest first
+func listLogBackups(logPath string) ([]logBackup, error) {
+	entries, err := os.ReadDir(filepath.Dir(logPath))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(logPath) + "."
+	var backups []logBackup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz")
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, logBackup{path: filepath.Join(filepath.Dir(logPath), name), time: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.Before(backups[j].time) })
+	return backups, nil
+}
+
+// pruneLogBackups removes rotated files beyond MaxBackups or older than MaxAgeDays
+func pruneLogBackups(logPath string, rotation LogRotation, now time.Time) error {
+	backups, err := listLogBackups(logPath)
+	if err != nil {
+		return err
+	}
+
+	excess := 0
+	if rotation.MaxBackups > 0 && len(backups) > rotation.MaxBackups {
+		excess = len(backups) - rotation.MaxBackups
+	}
+	cutoff := now.AddDate(0, 0, -rotation.MaxAgeDays)
+
+	for i, backup := range backups {
+		expired := rotation.MaxAgeDays > 0 && backup.time.Before(cutoff)
+		if i < excess || expired {
+			if err := os.Remove(backup.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
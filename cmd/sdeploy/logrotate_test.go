@@ -0,0 +1,175 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoggerRotation tests size-based rotation with compression and backup limits
+func TestLoggerRotation(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "sdeploy.log")
+	logger := NewLogger(nil, logPath, true)
+	defer logger.Close()
+	logger.SetRotation(LogRotation{MaxSizeMB: 1, MaxBackups: 2, Compress: true})
+
+	// Each rotation needs just over 1 MB of log lines
+	line := strings.Repeat("x", 1000)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 1100; j++ {
+			logger.Info("Project", line)
+		}
+		// Distinct backup timestamps
+		time.Sleep(2 * time.Millisecond)
+	}
+	// Close waits for the background compression of rotated files
+	logger.Close()
+
+	backups, err := listLogBackups(logPath)
+	if err != nil {
+		t.Fatalf("listLogBackups failed: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 kept backups, got %d", len(backups))
+	}
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup.path, ".gz") {
+			t.Errorf("Expected compressed backup, got %s", backup.path)
+		}
+	}
+
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatalf("Failed to stat log file: %v", err)
+	}
+	if info.Size() > 1024*1024 {
+		t.Errorf("Expected active log file below 1 MB, got %d bytes", info.Size())
+	}
+
+	// Compressed backups contain the rotated log lines
+	file, err := os.Open(backups[0].path)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to read gzip backup: %v", err)
+	}
+	content, _ := io.ReadAll(gz)
+	if !strings.Contains(string(content), "[INFO] [Project] xxx") {
+		t.Error("Expected backup to contain log lines")
+	}
+}
+
+// TestLoggerNoRotationByDefault tests that the log file grows without rotation when unset
+func TestLoggerNoRotationByDefault(t *testing.T) {
+	if (LogRotation{}).needsRotation(10*1024*1024, 1) {
+		t.Error("Expected no rotation when log_max_size_mb is 0")
+	}
+	if (LogRotation{MaxSizeMB: 1}).needsRotation(0, 2*1024*1024) {
+		t.Error("Expected an oversized first write to an empty file not to rotate")
+	}
+	if !(LogRotation{MaxSizeMB: 1}).needsRotation(1024*1024, 1) {
+		t.Error("Expected rotation once the size limit is exceeded")
+	}
+}
+
+// TestPruneLogBackups tests removal by count and by age, ignoring unrelated files
+func TestPruneLogBackups(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "sdeploy.log")
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.Local)
+
+	names := []string{
+		"sdeploy.log." + now.AddDate(0, 0, -10).Format(backupTimeFormat) + ".gz",
+		"sdeploy.log." + now.AddDate(0, 0, -3).Format(backupTimeFormat),
+		"sdeploy.log." + now.AddDate(0, 0, -2).Format(backupTimeFormat),
+		"sdeploy.log." + now.AddDate(0, 0, -1).Format(backupTimeFormat),
+		"sdeploy.log.old",
+		"other.log." + now.AddDate(0, 0, -30).Format(backupTimeFormat),
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	if err := pruneLogBackups(logPath, LogRotation{MaxBackups: 3, MaxAgeDays: 7}, now); err != nil {
+		t.Fatalf("pruneLogBackups failed: %v", err)
+	}
+	backups, _ := listLogBackups(logPath)
+	if len(backups) != 3 {
+		t.Errorf("Expected 3 backups after age pruning, got %d", len(backups))
+	}
+
+	if err := pruneLogBackups(logPath, LogRotation{MaxBackups: 1}, now); err != nil {
+		t.Fatalf("pruneLogBackups failed: %v", err)
+	}
+	backups, _ = listLogBackups(logPath)
+	if len(backups) != 1 || filepath.Base(backups[0].path) != names[3] {
+		t.Errorf("Expected only the newest backup to remain, got %v", backups)
+	}
+
+	for _, name := range []string{"sdeploy.log.old", names[5]} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected unrelated file %s to be kept", name)
+		}
+	}
+}
+
+// TestLoggerReopen tests reopening the log file after an external rotation
+func TestLoggerReopen(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "sdeploy.log")
+	logger := NewLogger(nil, logPath, true)
+	defer logger.Close()
+
+	logger.Info("", "before rotation")
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatalf("Failed to move log file: %v", err)
+	}
+	logger.Reopen()
+	logger.Info("", "after rotation")
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Expected reopened log file: %v", err)
+	}
+	if strings.Contains(string(content), "before rotation") || !strings.Contains(string(content), "after rotation") {
+		t.Errorf("Expected only new messages in reopened file, got %q", content)
+	}
+}
+
+// TestLoggerSetFilePath tests switching the log file on config reload
+func TestLoggerSetFilePath(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "logs", "second.log")
+
+	logger := NewLogger(nil, first, true)
+	defer logger.Close()
+	logger.Info("", "first message")
+
+	logger.SetFilePath(second)
+	logger.Info("", "second message")
+
+	if logger.FilePath() != second {
+		t.Errorf("Expected file path %s, got %s", second, logger.FilePath())
+	}
+	content, err := os.ReadFile(second)
+	if err != nil || !strings.Contains(string(content), "second message") {
+		t.Errorf("Expected second message in new log file, got %q (err: %v)", content, err)
+	}
+
+	// Console loggers ignore file paths
+	console := NewLogger(nil, "", false)
+	console.SetFilePath(first)
+	if console.FilePath() != "" {
+		t.Errorf("Expected console logger to stay on stderr, got %s", console.FilePath())
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 )
 
 const (
@@ -44,12 +47,23 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Run CLI commands (e.g., sdeploy rollback <project>) without starting the daemon
+	if flag.NArg() > 0 {
+		os.Exit(runSubcommand(cfg, flag.Args(), os.Stdout, os.Stderr))
+	}
+
 	// Initialize logger
 	// Console mode: logs to stderr for interactive use
 	// Daemon mode: logs to file for background service use
-	logger := NewLogger(nil, "", *daemonMode)
+	logger := NewLogger(nil, cfg.LogFilepath, *daemonMode)
+	logger.SetFormat(cfg.LogFormat)
+	logger.SetRotation(cfg.LogRotation())
 	defer logger.Close()
 
+	// Mask secrets in logs, run logs, history and emails; updated on reload
+	redactor := NewRedactor(cfg)
+	logger.SetRedactor(redactor)
+
 	logger.Infof("", "%s %s - Service started", ServiceName, Version)
 
 	// Log configuration summary
@@ -62,10 +76,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Initialize metrics (exposed when metrics_path or metrics_port is set)
+	metrics := NewMetrics()
+	configManager.SetMetrics(metrics)
+
 	// Initialize email notifier
 	var notifier *EmailNotifier
 	if IsEmailConfigValid(cfg.EmailConfig) {
 		notifier = NewEmailNotifier(cfg.EmailConfig, logger)
+		notifier.SetMetrics(metrics)
+		notifier.SetRedactor(redactor)
 		logger.Info("", "Email notifications enabled")
 	} else {
 		logger.Info("", "Email notification disabled: email_config is missing or invalid.")
@@ -75,15 +95,83 @@ func main() {
 	deployer := NewDeployer(logger)
 	deployer.SetNotifier(notifier)
 	deployer.SetConfigManager(configManager)
+	deployer.SetMetrics(metrics)
+	deployer.SetRedactor(redactor)
+	metrics.SetInFlightFunc(deployer.ActiveBuilds)
+
+	deployer.SetStateDir(cfg.StateDir)
+
+	// Initialize deployment history store
+	historyStore, err := NewHistoryStore(cfg.StateDir)
+	if err != nil {
+		logger.Warnf("", "Deployment history disabled: %v", err)
+	} else {
+		deployer.SetHistoryStore(historyStore)
+		logger.Infof("", "Deployment history enabled: %s", historyStore.Dir())
+	}
+
+	// Initialize per-run log files (enabled when run_logs is set)
+	if cfg.RunLogs {
+		runLogStore, err := NewRunLogStore(cfg.StateDir)
+		if err != nil {
+			logger.Warnf("", "Run logs disabled: %v", err)
+		} else {
+			deployer.SetRunLogStore(runLogStore)
+			logger.Infof("", "Run logs enabled: %s", runLogStore.Dir())
+		}
+	}
 
 	// Initialize webhook handler with hot reload support
 	handler := NewWebhookHandlerWithConfigManager(configManager, logger)
 	handler.SetDeployer(deployer)
+	handler.SetMetrics(metrics)
 
-	// Set up callback for config reload to update email notifier
+	// Remember delivery IDs under state_dir to reject replayed webhooks
+	deliveryStore, err := NewDeliveryStore(cfg.StateDir)
+	if err != nil {
+		logger.Warnf("", "Replay protection disabled: %v", err)
+	} else {
+		handler.SetDeliveryStore(deliveryStore)
+		logger.Infof("", "Replay protection enabled: %s", deliveryStore.Dir())
+	}
+
+	// Deployments run under a root context that is cancelled when they outlast
+	// the shutdown timeout
+	rootCtx, interruptRuns := context.WithCancelCause(context.Background())
+	defer interruptRuns(nil)
+	handler.SetBaseContext(rootCtx)
+
+	// Initialize status and history API (enabled when api_token is set)
+	apiHandler := NewAPIHandler(configManager, logger)
+	apiHandler.SetDeployer(deployer)
+	apiHandler.SetHistoryStore(historyStore)
+
+	// Route /api/ to the API, probes to the probe handler, everything else to the webhook handler
+	probeHandler := NewProbeHandler(configManager, logger)
+	mux := http.NewServeMux()
+	mux.Handle(APIPathPrefix, apiHandler)
+	mux.Handle(HealthzPath, probeHandler)
+	mux.Handle(ReadyzPath, probeHandler)
+	mux.Handle("/", handler)
+
+	// Serve metrics on the listen port unless a separate metrics_port is set
+	var metricsSrv *http.Server
+	if cfg.MetricsPort != 0 {
+		metricsSrv = metricsServer(cfg.MetricsPort, cfg.MetricsPath, metrics)
+	} else if cfg.MetricsPath != "" {
+		mux.Handle(cfg.MetricsPath, metrics)
+	}
+
+	// Set up callback for config reload to update logging and email notifier
 	configManager.SetOnReload(func(newCfg *Config) {
+		redactor.Update(newCfg)
+		logger.SetFilePath(newCfg.LogFilepath)
+		logger.SetRotation(newCfg.LogRotation())
+		logger.SetFormat(newCfg.LogFormat)
 		if IsEmailConfigValid(newCfg.EmailConfig) {
 			newNotifier := NewEmailNotifier(newCfg.EmailConfig, logger)
+			newNotifier.SetMetrics(metrics)
+			newNotifier.SetRedactor(redactor)
 			deployer.SetNotifier(newNotifier)
 		} else {
 			deployer.SetNotifier(nil)
@@ -100,11 +188,21 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, getShutdownSignals()...)
 
+	// Reopen the log file on SIGUSR1 (for external logrotate)
+	reopenChan := make(chan os.Signal, 1)
+	signal.Notify(reopenChan, getReopenLogSignals()...)
+	go func() {
+		for range reopenChan {
+			logger.Reopen()
+			logger.Infof("", "Reopened log file %s", logger.FilePath())
+		}
+	}()
+
 	// Start HTTP server in goroutine
 	addr := fmt.Sprintf(":%d", cfg.ListenPort)
 	server := &http.Server{
 		Addr:    addr,
-		Handler: handler,
+		Handler: mux,
 	}
 
 	go func() {
@@ -115,27 +213,102 @@ func main() {
 		}
 	}()
 
+	if metricsSrv != nil {
+		go func() {
+			logger.Infof("", "Metrics server starting on %s", metricsSrv.Addr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("", "Metrics server error: %v", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Wait for shutdown signal
 	sig := <-sigChan
 	logger.Infof("", "Received signal %v, shutting down...", sig)
 
-	// Graceful shutdown
-	if err := server.Close(); err != nil {
-		logger.Errorf("", "Error during shutdown: %v", err)
+	// Graceful shutdown: stop accepting webhooks, then drain running deployments
+	timeout := time.Duration(configManager.GetConfig().ShutdownTimeout) * time.Second
+	shutdown(logger, server, deployer, timeout, interruptRuns)
+	if metricsSrv != nil {
+		metricsSrv.Close()
 	}
 
 	logger.Infof("", "%s %s - Service terminated", ServiceName, Version)
 }
 
+// interruptTimeout is how long shutdown waits for interrupted deployments to
+// stop their commands, run their hooks and record their results
+var interruptTimeout = 20 * time.Second
+
+// shutdown stops the server from accepting requests and waits up to timeout
+// for running deployments (and the pending runs they hand over to) to finish.
+// Deployments still running afterwards are interrupted and recorded as such.
+func shutdown(logger *Logger, server *http.Server, deployer *Deployer, timeout time.Duration, interruptRuns context.CancelCauseFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if deployer.HasActiveBuilds() {
+		logger.Infof("", "Waiting up to %v for %d running deployments to finish", timeout, deployer.ActiveBuilds())
+	}
+
+	// Open live output streams end with their run, so Shutdown may wait for them too
+	if err := server.Shutdown(ctx); err != nil && err != context.DeadlineExceeded {
+		logger.Errorf("", "Error during shutdown: %v", err)
+	}
+
+	if !deployer.WaitIdle(ctx) {
+		logger.Warnf("", "Shutdown timeout of %v reached, interrupting %d running deployments", timeout, deployer.ActiveBuilds())
+		interruptRuns(ErrShutdown)
+		// Interrupted runs stop their commands, run their hooks and record their results.
+		// Hooks may not have a timeout, so give up on them after interruptTimeout.
+		interruptCtx, cancelInterrupt := context.WithTimeout(context.Background(), interruptTimeout)
+		defer cancelInterrupt()
+		if !deployer.WaitIdle(interruptCtx) {
+			logger.Errorf("", "%d interrupted deployments did not finish within %v, exiting without recording them", deployer.ActiveBuilds(), interruptTimeout)
+		}
+	}
+
+	// Close connections left open after the timeout
+	if err := server.Close(); err != nil {
+		logger.Errorf("", "Error during shutdown: %v", err)
+	}
+}
+
 // logConfigSummary logs all configuration settings on startup
 func logConfigSummary(logger *Logger, cfg *Config, daemonMode bool) {
 	logger.Info("", "Configuration loaded:")
 	logger.Infof("", "  Listen Port: %d", cfg.ListenPort)
 	if daemonMode {
-		logger.Infof("", "  Log File: %s", Defaults.LogPath)
+		logger.Infof("", "  Log File: %s", cfg.LogFilepath)
+		if cfg.LogMaxSizeMB > 0 {
+			logger.Infof("", "  Log Rotation: %d MB, keep %d backups (compress: %t)", cfg.LogMaxSizeMB, cfg.LogMaxBackups, cfg.LogCompress)
+		}
 	} else {
 		logger.Info("", "  Log Output: console (stderr)")
 	}
+	logger.Infof("", "  Log Format: %s", cfg.LogFormat)
+	logger.Infof("", "  Log Payloads: %t", cfg.LogPayloads)
+	if len(cfg.RedactEnv) > 0 || len(cfg.RedactPatterns) > 0 {
+		logger.Infof("", "  Redaction: %d env vars, %d patterns (plus webhook secrets, smtp_pass, api_token)", len(cfg.RedactEnv), len(cfg.RedactPatterns))
+	}
+	logger.Infof("", "  State Dir: %s", cfg.StateDir)
+	logger.Infof("", "  History Limit: %d runs per project", cfg.HistoryLimit)
+	logger.Infof("", "  Shutdown Timeout: %ds", cfg.ShutdownTimeout)
+	logger.Infof("", "  Replay Protection: %d delivery IDs per project, signed trigger skew %ds", cfg.DeliveryIDKeep, cfg.TriggerMaxSkew)
+	if cfg.APIToken != "" {
+		logger.Infof("", "  Status API: enabled (%s)", APIPathPrefix)
+	} else {
+		logger.Info("", "  Status API: disabled")
+	}
+	switch {
+	case cfg.MetricsPort != 0:
+		logger.Infof("", "  Metrics: enabled (:%d%s)", cfg.MetricsPort, cfg.MetricsPath)
+	case cfg.MetricsPath != "":
+		logger.Infof("", "  Metrics: enabled (%s)", cfg.MetricsPath)
+	default:
+		logger.Info("", "  Metrics: disabled")
+	}
 	if IsEmailConfigValid(cfg.EmailConfig) {
 		logger.Info("", "  Email Notifications: enabled")
 	} else {
@@ -146,23 +319,45 @@ func logConfigSummary(logger *Logger, cfg *Config, daemonMode bool) {
 		logger.Infof("", "Project [%d]: %s", i+1, project.Name)
 		logger.Infof("", "  - Webhook Path: %s", project.WebhookPath)
 		// Print Webhook URL with curl example
-		logger.Infof("", "  - Webhook URL: curl -X POST \"http://<YOUR_HOST>:%d%s?secret=%s\" -d '{\"ref\":\"refs/heads/%s\"}'",
-			cfg.ListenPort, project.WebhookPath, project.WebhookSecret, project.GitBranch)
+		logger.Infof("", "  - Webhook URL: curl -X POST \"http://<YOUR_HOST>:%d%s?secret=<WEBHOOK_SECRET>\" -d '{\"ref\":\"refs/heads/%s\"}'",
+			cfg.ListenPort, project.WebhookPath, project.GitBranch)
 		// Order: Git Repo, Git Branch, Git Update, Local Path, Execute Path, Execute Command
 		if project.GitRepo != "" {
 			logger.Infof("", "  - Git Repo: %s", project.GitRepo)
 		}
 		logger.Infof("", "  - Git Branch: %s", project.GitBranch)
+		if len(project.Branches) > 0 {
+			logger.Infof("", "  - Branches: %s", project.branchDescription())
+		}
+		logger.Infof("", "  - Events: %s", strings.Join(project.Events, ", "))
+		if project.GitTagPattern != "" {
+			logger.Infof("", "  - Git Tag Pattern: %s", project.GitTagPattern)
+		}
+		if project.hasPathFilters() {
+			logger.Infof("", "  - Path Filters: %s", project.pathFilterDescription())
+		}
 		logger.Infof("", "  - Git Update: %t", project.GitUpdate)
+		if project.ReleaseMode {
+			logger.Infof("", "  - Release Mode: enabled (keep %d releases)", project.KeepReleases)
+		}
 		if project.LocalPath != "" {
 			logger.Infof("", "  - Local Path: %s", project.LocalPath)
 		}
 		if project.ExecutePath != "" {
 			logger.Infof("", "  - Execute Path: %s", project.ExecutePath)
 		}
-		logger.Infof("", "  - Execute Command: %s", project.ExecuteCommand)
+		if len(project.Steps) > 0 {
+			for j, step := range project.Steps {
+				logger.Infof("", "  - Step %d: %s: %s", j+1, step.Name, step.Command)
+			}
+		} else {
+			logger.Infof("", "  - Execute Command: %s", project.ExecuteCommand)
+		}
 		if project.TimeoutSeconds > 0 {
-			logger.Infof("", "  - Timeout: %ds", project.TimeoutSeconds)
+			logger.Infof("", "  - Timeout: %ds (kill grace: %v)", project.TimeoutSeconds, project.killGrace())
+		}
+		if hooks := configuredHooks(project.Hooks); len(hooks) > 0 {
+			logger.Infof("", "  - Hooks: %s", strings.Join(hooks, ", "))
 		}
 		logger.Infof("", "  - Email Recipients: %d", len(project.EmailRecipients))
 		logger.Infof("", "-------------------------------------------------------")
@@ -173,13 +368,17 @@ func logConfigSummary(logger *Logger, cfg *Config, daemonMode bool) {
 func printUsage() {
 	fmt.Printf("%s %s - Simple Webhook Deployment Daemon\n", ServiceName, Version)
 	fmt.Println()
-	fmt.Println("Usage: sdeploy [options]")
+	fmt.Println("Usage: sdeploy [options] [command]")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  -c <path>  Path to config file (YAML format)")
 	fmt.Println("  -d         Run as daemon (background service)")
 	fmt.Println("  -h         Show this help message")
 	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  rollback <project>  Point current to the previous release (release_mode)")
+	fmt.Println("  cancel <project>    Cancel the project's running deployment (needs api_token)")
+	fmt.Println()
 	fmt.Println("Config file search order:")
 	fmt.Println("  1. Path from -c flag")
 	fmt.Println("  2. /etc/sdeploy.conf")
@@ -193,4 +392,6 @@ func printUsage() {
 	fmt.Println("  sdeploy              # Run in console mode")
 	fmt.Println("  sdeploy -d           # Run as daemon")
 	fmt.Println("  sdeploy -c /path/to/sdeploy.conf -d")
+	fmt.Println("  sdeploy rollback \"Frontend App\"  # Roll back to the previous release")
+	fmt.Println("  sdeploy cancel \"Frontend App\"    # Stop a hanging deployment")
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestServer serves an empty handler on a random local port
+func startTestServer(t *testing.T) *http.Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: http.NotFoundHandler()}
+	go server.Serve(ln)
+	return server
+}
+
+// TestShutdown tests draining finished deployments and interrupting those
+// that outlast the shutdown timeout
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		interrupted bool
+	}{
+		{"drains running deployment", "sleep 0.3", false},
+		{"interrupts after timeout", "sleep 30 & wait", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := NewLogger(&buf, "", false)
+			deployer := NewDeployer(logger)
+			project := &ProjectConfig{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				ExecutePath:    t.TempDir(),
+				ExecuteCommand: tc.command,
+			}
+
+			rootCtx, interruptRuns := context.WithCancelCause(context.Background())
+			defer interruptRuns(nil)
+
+			done := make(chan DeployResult, 1)
+			go func() { done <- deployer.Deploy(rootCtx, project, "WEBHOOK") }()
+			for i := 0; i < 100 && !deployer.HasActiveBuilds(); i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			shutdown(logger, startTestServer(t), deployer, time.Second, interruptRuns)
+
+			// Shutdown returns only once the run has been recorded
+			if deployer.HasActiveBuilds() {
+				t.Error("Expected no active builds after shutdown")
+			}
+			result := <-done
+			if result.Interrupted != tc.interrupted || result.Success == tc.interrupted {
+				t.Errorf("Expected interrupted=%t, got %+v", tc.interrupted, result)
+			}
+			if got := strings.Contains(buf.String(), "interrupting 1 running deployments"); got != tc.interrupted {
+				t.Errorf("Expected interrupt log %t, got:\n%s", tc.interrupted, buf.String())
+			}
+		})
+	}
+}
+
+// TestShutdownInterruptsPendingRuns tests that runs pending at shutdown are
+// recorded as interrupted without running their command or hooks
+func TestShutdownInterruptsPendingRuns(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewHistoryStore failed: %v", err)
+	}
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	deployer := NewDeployer(logger)
+	deployer.SetHistoryStore(store)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecutePath:    tmpDir,
+		ExecuteCommand: "touch ran-$SDEPLOY_TRIGGER_SOURCE; sleep 30 & wait",
+		Hooks:          DeployHooks{Always: "touch hook-$SDEPLOY_TRIGGER_SOURCE"},
+		OnBusy:         OnBusyQueue,
+	}
+
+	rootCtx, interruptRuns := context.WithCancelCause(context.Background())
+	defer interruptRuns(nil)
+
+	go deployer.Deploy(rootCtx, project, "FIRST")
+	for i := 0; i < 100 && !deployer.IsDeploying(project.WebhookPath); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if result := deployer.Deploy(rootCtx, project, "SECOND"); !result.Queued {
+		t.Fatalf("Expected SECOND to be queued, got %+v", result)
+	}
+
+	shutdown(logger, startTestServer(t), deployer, 200*time.Millisecond, interruptRuns)
+
+	for _, name := range []string{"ran-SECOND", "hook-SECOND"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected the pending run not to start (%s exists)", name)
+		}
+	}
+	runs, err := store.List(projectKey(project), 0)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	statuses := map[string]string{}
+	for _, run := range runs {
+		statuses[run.TriggerSource] = run.Status()
+	}
+	if statuses["FIRST"] != "interrupted" || statuses["SECOND"] != "interrupted" {
+		t.Errorf("Expected both runs recorded as interrupted, got %v", statuses)
+	}
+	if !strings.Contains(buf.String(), "Pending deployment interrupted by shutdown") {
+		t.Errorf("Expected the dropped pending run to be logged, got:\n%s", buf.String())
+	}
+}
+
+// TestShutdownWaitsForAcceptedDeployments tests that a deployment accepted
+// before shutdown but not yet started is waited for
+func TestShutdownWaitsForAcceptedDeployments(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger := NewLogger(&bytes.Buffer{}, "", false)
+	deployer := NewDeployer(logger)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecutePath:    tmpDir,
+		ExecuteCommand: "touch deployed",
+	}
+
+	rootCtx, interruptRuns := context.WithCancelCause(context.Background())
+	defer interruptRuns(nil)
+
+	// Accepted as the webhook handler does, with the deployment starting late
+	accepted := deployer.Accept()
+	go func() {
+		defer accepted()
+		time.Sleep(200 * time.Millisecond)
+		deployer.Deploy(rootCtx, project, "WEBHOOK")
+	}()
+
+	shutdown(logger, startTestServer(t), deployer, 5*time.Second, interruptRuns)
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "deployed")); err != nil {
+		t.Errorf("Expected shutdown to wait for the accepted deployment: %v", err)
+	}
+}
+
+// TestShutdownInterruptTimeout tests that shutdown stops waiting for
+// interrupted deployments whose hooks do not finish
+func TestShutdownInterruptTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { interruptTimeout = timeout }(interruptTimeout)
+	interruptTimeout = 200 * time.Millisecond
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	deployer := NewDeployer(logger)
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecutePath:    t.TempDir(),
+		ExecuteCommand: "sleep 30 & wait",
+		Hooks:          DeployHooks{Always: "sleep 3"},
+	}
+
+	rootCtx, interruptRuns := context.WithCancelCause(context.Background())
+	defer interruptRuns(nil)
+
+	go deployer.Deploy(rootCtx, project, "WEBHOOK")
+	for i := 0; i < 100 && !deployer.HasActiveBuilds(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	shutdown(logger, startTestServer(t), deployer, 200*time.Millisecond, interruptRuns)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected shutdown to give up on the hook, took %v", elapsed)
+	}
+	deployer.WaitIdle(context.Background())
+	if !strings.Contains(buf.String(), "1 interrupted deployments did not finish") {
+		t.Errorf("Expected the unfinished deployment to be logged, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhook outcomes counted by sdeploy_webhooks_total
+const (
+	WebhookAccepted         = "accepted"
+	WebhookUnauthorized     = "unauthorized"
+	WebhookBranchMismatch   = "branch_mismatch"
+	WebhookTagMismatch      = "tag_mismatch"
+	WebhookNotFound         = "not_found"
+	WebhookMethodNotAllowed = "method_not_allowed"
+	WebhookBadRequest       = "bad_request"
+	WebhookReplayed         = "replayed"
+	WebhookPing             = "ping"
+	WebhookEventIgnored     = "event_ignored"
+	WebhookNoChanges        = "no_changes"
+)
+
+// Deploy results counted by sdeploy_deploys_total
+const (
+	DeploySuccess     = "success"
+	DeployFailed      = "failed"
+	DeploySkipped     = "skipped"
+	DeployTimedOut    = "timed_out"
+	DeployCancelled   = "cancelled"
+	DeployInterrupted = "interrupted"
+)
+
+// deployDurationBuckets are the upper bounds (seconds) of the deploy duration histogram
+var deployDurationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+// durationHistogram holds cumulative-ready bucket counts for one project
+type durationHistogram struct {
+	counts []uint64 // per bucket (non-cumulative), len(deployDurationBuckets)
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects counters exposed in the Prometheus text exposition format.
+// A nil *Metrics is valid and records nothing.
+type Metrics struct {
+	mu            sync.Mutex
+	webhooks      map[[2]string]uint64 // {project, outcome}
+	deploys       map[[2]string]uint64 // {project, result}
+	durations     map[string]*durationHistogram
+	reloads       map[string]uint64 // {result}
+	emailFailures map[string]uint64 // {project}
+	inFlight      func() int
+}
+
+// NewMetrics creates an empty metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		webhooks:      make(map[[2]string]uint64),
+		deploys:       make(map[[2]string]uint64),
+		durations:     make(map[string]*durationHistogram),
+		reloads:       make(map[string]uint64),
+		emailFailures: make(map[string]uint64),
+	}
+}
+
+// SetInFlightFunc sets the source of the in-flight deployments gauge
+func (m *Metrics) SetInFlightFunc(fn func() int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight = fn
+}
+
+// IncWebhook counts a webhook request by project and outcome
+func (m *Metrics) IncWebhook(project, outcome string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webhooks[[2]string{project, outcome}]++
+}
+
+// ObserveDeploy counts a deployment result and records its duration (skipped runs have none)
+func (m *Metrics) ObserveDeploy(project string, result *DeployResult) {
+	if m == nil || result.Queued {
+		return
+	}
+
+	outcome := DeployFailed
+	switch {
+	case result.Skipped:
+		outcome = DeploySkipped
+	case result.Cancelled:
+		outcome = DeployCancelled
+	case result.Interrupted:
+		outcome = DeployInterrupted
+	case result.Success:
+		outcome = DeploySuccess
+	case result.TimedOut:
+		outcome = DeployTimedOut
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deploys[[2]string{project, outcome}]++
+
+	if result.Skipped {
+		return
+	}
+	h := m.durations[project]
+	if h == nil {
+		h = &durationHistogram{counts: make([]uint64, len(deployDurationBuckets))}
+		m.durations[project] = h
+	}
+	seconds := result.Duration().Seconds()
+	for i, bound := range deployDurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// IncReload counts a config reload attempt (success or failure)
+func (m *Metrics) IncReload(success bool) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reloads[result]++
+}
+
+// IncEmailFailure counts a failed notification email
+func (m *Metrics) IncEmailFailure(project string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.emailFailures[project]++
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	writeHeader(&b, "sdeploy_webhooks_total", "counter", "Webhook requests received by project and outcome.")
+	for _, key := range sortedPairKeys(m.webhooks) {
+		fmt.Fprintf(&b, "sdeploy_webhooks_total{project=%s,outcome=%s} %d\n", quoteLabel(key[0]), quoteLabel(key[1]), m.webhooks[key])
+	}
+
+	writeHeader(&b, "sdeploy_deploys_total", "counter", "Deployments by project and result.")
+	for _, key := range sortedPairKeys(m.deploys) {
+		fmt.Fprintf(&b, "sdeploy_deploys_total{project=%s,result=%s} %d\n", quoteLabel(key[0]), quoteLabel(key[1]), m.deploys[key])
+	}
+
+	writeHeader(&b, "sdeploy_deploy_duration_seconds", "histogram", "Duration of executed deployments.")
+	for _, project := range sortedKeys(m.durations) {
+		h := m.durations[project]
+		var cumulative uint64
+		for i, bound := range deployDurationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "sdeploy_deploy_duration_seconds_bucket{project=%s,le=\"%s\"} %d\n", quoteLabel(project), formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(&b, "sdeploy_deploy_duration_seconds_bucket{project=%s,le=\"+Inf\"} %d\n", quoteLabel(project), h.count)
+		fmt.Fprintf(&b, "sdeploy_deploy_duration_seconds_sum{project=%s} %s\n", quoteLabel(project), formatFloat(h.sum))
+		fmt.Fprintf(&b, "sdeploy_deploy_duration_seconds_count{project=%s} %d\n", quoteLabel(project), h.count)
+	}
+
+	writeHeader(&b, "sdeploy_deploys_in_flight", "gauge", "Deployments currently running.")
+	inFlight := 0
+	if m.inFlight != nil {
+		inFlight = m.inFlight()
+	}
+	fmt.Fprintf(&b, "sdeploy_deploys_in_flight %d\n", inFlight)
+
+	writeHeader(&b, "sdeploy_config_reloads_total", "counter", "Configuration reloads by result.")
+	for _, result := range []string{"success", "failure"} {
+		fmt.Fprintf(&b, "sdeploy_config_reloads_total{result=%s} %d\n", quoteLabel(result), m.reloads[result])
+	}
+
+	writeHeader(&b, "sdeploy_email_failures_total", "counter", "Notification emails that failed to send.")
+	for _, project := range sortedKeys(m.emailFailures) {
+		fmt.Fprintf(&b, "sdeploy_email_failures_total{project=%s} %d\n", quoteLabel(project), m.emailFailures[project])
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric family
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
+
+// quoteLabel quotes a label value, escaping backslashes, quotes and newlines
+func quoteLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + value + `"`
+}
+
+// formatFloat formats a float without trailing zeros
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// sortedPairKeys returns the keys of a two-label counter in a stable order
+func sortedPairKeys(m map[[2]string]uint64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricsServer creates the standalone metrics server used when metrics_port is set
+func metricsServer(port int, path string, metrics *Metrics) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(path, metrics)
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeMetrics returns the exposition text served by the metrics handler
+func scrapeMetrics(t *testing.T, metrics *Metrics) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	metrics.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected Content-Type: %s", ct)
+	}
+	return rr.Body.String()
+}
+
+// assertMetricLine fails the test if the exposition text lacks the given sample line
+func assertMetricLine(t *testing.T, body, line string) {
+	t.Helper()
+	for _, l := range strings.Split(body, "\n") {
+		if l == line {
+			return
+		}
+	}
+	t.Errorf("Expected metric line %q in:\n%s", line, body)
+}
+
+// TestMetricsExposition tests counters, the duration histogram and the in-flight gauge
+func TestMetricsExposition(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.SetInFlightFunc(func() int { return 2 })
+
+	start := time.Now()
+	metrics.ObserveDeploy("app", &DeployResult{Success: true, StartTime: start, EndTime: start.Add(3 * time.Second)})
+	metrics.ObserveDeploy("app", &DeployResult{StartTime: start, EndTime: start.Add(45 * time.Second)})
+	metrics.ObserveDeploy("app", &DeployResult{TimedOut: true, StartTime: start, EndTime: start.Add(time.Hour)})
+	metrics.ObserveDeploy("app", &DeployResult{Skipped: true})
+	metrics.ObserveDeploy("app", &DeployResult{Queued: true})
+	metrics.IncWebhook("app", WebhookAccepted)
+	metrics.IncWebhook("app", WebhookAccepted)
+	metrics.IncWebhook(`we"ird`, WebhookUnauthorized)
+	metrics.IncReload(true)
+	metrics.IncReload(false)
+	metrics.IncReload(false)
+	metrics.IncEmailFailure("app")
+
+	body := scrapeMetrics(t, metrics)
+	for _, line := range []string{
+		"# TYPE sdeploy_webhooks_total counter",
+		`sdeploy_webhooks_total{project="app",outcome="accepted"} 2`,
+		`sdeploy_webhooks_total{project="we\"ird",outcome="unauthorized"} 1`,
+		`sdeploy_deploys_total{project="app",result="success"} 1`,
+		`sdeploy_deploys_total{project="app",result="failed"} 1`,
+		`sdeploy_deploys_total{project="app",result="timed_out"} 1`,
+		`sdeploy_deploys_total{project="app",result="skipped"} 1`,
+		"# TYPE sdeploy_deploy_duration_seconds histogram",
+		`sdeploy_deploy_duration_seconds_bucket{project="app",le="1"} 0`,
+		`sdeploy_deploy_duration_seconds_bucket{project="app",le="5"} 1`,
+		`sdeploy_deploy_duration_seconds_bucket{project="app",le="60"} 2`,
+		`sdeploy_deploy_duration_seconds_bucket{project="app",le="1800"} 2`,
+		`sdeploy_deploy_duration_seconds_bucket{project="app",le="+Inf"} 3`,
+		`sdeploy_deploy_duration_seconds_sum{project="app"} 3648`,
+		`sdeploy_deploy_duration_seconds_count{project="app"} 3`,
+		"sdeploy_deploys_in_flight 2",
+		`sdeploy_config_reloads_total{result="success"} 1`,
+		`sdeploy_config_reloads_total{result="failure"} 2`,
+		`sdeploy_email_failures_total{project="app"} 1`,
+	} {
+		assertMetricLine(t, body, line)
+	}
+
+	rr := httptest.NewRecorder()
+	metrics.ServeHTTP(rr, httptest.NewRequest("POST", "/metrics", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for POST, got %d", rr.Code)
+	}
+}
+
+// TestMetricsNilSafe tests that a nil registry records nothing without panicking
+func TestMetricsNilSafe(t *testing.T) {
+	var metrics *Metrics
+	metrics.SetInFlightFunc(func() int { return 1 })
+	metrics.IncWebhook("app", WebhookAccepted)
+	metrics.ObserveDeploy("app", &DeployResult{Success: true})
+	metrics.IncReload(true)
+	metrics.IncEmailFailure("app")
+}
+
+// TestWebhookMetrics tests that webhook outcomes are counted per project
+func TestWebhookMetrics(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+	metrics := NewMetrics()
+	handler := NewWebhookHandler(cfg, nil)
+	handler.SetMetrics(metrics)
+
+	mismatch := `{"ref":"refs/heads/develop"}`
+	requests := []struct {
+		method    string
+		path      string
+		body      string
+		signature string
+	}{
+		{"POST", "/hooks/test?secret=mysecret", `{"ref":"refs/heads/main"}`, ""},
+		{"POST", "/hooks/test?secret=wrong", `{"ref":"refs/heads/main"}`, ""},
+		{"POST", "/hooks/test", mismatch, "sha256=" + hexHMAC(mismatch, "mysecret")},
+		{"POST", "/hooks/unknown?secret=mysecret", `{}`, ""},
+		{"GET", "/hooks/test", "", ""},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		if r.signature != "" {
+			req.Header.Set("X-Hub-Signature-256", r.signature)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrapeMetrics(t, metrics)
+	assertMetricLine(t, body, `sdeploy_webhooks_total{project="TestProject",outcome="accepted"} 1`)
+	assertMetricLine(t, body, `sdeploy_webhooks_total{project="TestProject",outcome="unauthorized"} 1`)
+	assertMetricLine(t, body, `sdeploy_webhooks_total{project="TestProject",outcome="branch_mismatch"} 1`)
+	assertMetricLine(t, body, `sdeploy_webhooks_total{project="",outcome="not_found"} 1`)
+	assertMetricLine(t, body, `sdeploy_webhooks_total{project="",outcome="method_not_allowed"} 1`)
+}
+
+// TestDeployMetrics tests that the deployer records results and exposes in-flight builds
+func TestDeployMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	deployer := NewDeployer(nil)
+	deployer.SetMetrics(metrics)
+	metrics.SetInFlightFunc(deployer.ActiveBuilds)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecuteCommand: "echo ok",
+	}
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+
+	project.ExecuteCommand = "sleep 10"
+	project.TimeoutSeconds = 1
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+
+	body := scrapeMetrics(t, metrics)
+	assertMetricLine(t, body, `sdeploy_deploys_total{project="TestProject",result="success"} 1`)
+	assertMetricLine(t, body, `sdeploy_deploys_total{project="TestProject",result="timed_out"} 1`)
+	assertMetricLine(t, body, `sdeploy_deploy_duration_seconds_count{project="TestProject"} 2`)
+	assertMetricLine(t, body, "sdeploy_deploys_in_flight 0")
+}
+
+// TestConfigReloadMetrics tests that successful and failed reloads are counted
+func TestConfigReloadMetrics(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "sdeploy.conf")
+	validConfig := `
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret1
+    execute_command: make
+`
+	if err := os.WriteFile(configPath, []byte(validConfig), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cm, err := NewConfigManager(configPath, nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager failed: %v", err)
+	}
+	metrics := NewMetrics()
+	cm.SetMetrics(metrics)
+
+	cm.reloadConfig()
+	if err := os.WriteFile(configPath, []byte("projects: [unclosed"), 0644); err != nil {
+		t.Fatalf("Failed to write invalid config: %v", err)
+	}
+	cm.reloadConfig()
+
+	body := scrapeMetrics(t, metrics)
+	assertMetricLine(t, body, `sdeploy_config_reloads_total{result="success"} 1`)
+	assertMetricLine(t, body, `sdeploy_config_reloads_total{result="failure"} 1`)
+}
+
+// TestEmailFailureMetrics tests that failed notification emails are counted per project
+func TestEmailFailureMetrics(t *testing.T) {
+	notifier := NewEmailNotifier(&EmailConfig{
+		SMTPHost:    "127.0.0.1",
+		SMTPPort:    1, // Nothing listens here
+		SMTPUser:    "user",
+		SMTPPass:    "pass",
+		EmailSender: "sdeploy@example.com",
+	}, nil)
+	metrics := NewMetrics()
+	notifier.SetMetrics(metrics)
+
+	project := &ProjectConfig{Name: "TestProject", EmailRecipients: []string{"test@example.com"}}
+	result := &DeployResult{Success: true, StartTime: time.Now(), EndTime: time.Now()}
+	if err := notifier.SendNotification(project, result, "WEBHOOK"); err == nil {
+		t.Fatal("Expected send to fail without an SMTP server")
+	}
+
+	assertMetricLine(t, scrapeMetrics(t, metrics), `sdeploy_email_failures_total{project="TestProject"} 1`)
+}
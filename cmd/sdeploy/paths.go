@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// maxPayloadCommits is the number of commits GitHub lists in a push payload at
+// most; a push of more commits has incomplete file lists
+const maxPayloadCommits = 2048
+
+// pushCommit holds the files changed by a commit of a GitHub, Gitea or GitLab push payload
+type pushCommit struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// setChangedFiles fills in the paths changed by a push payload's commits.
+// total is the number of pushed commits reported by the payload (0 if it
+// reports none); when the payload lists fewer commits, or none at all, the
+// file lists are incomplete and FilesComplete stays false.
+func (event *WebhookEvent) setChangedFiles(commits []pushCommit, total int) {
+	if len(commits) == 0 || len(commits) < total || len(commits) >= maxPayloadCommits {
+		return
+	}
+
+	seen := make(map[string]bool)
+	files := []string{}
+	for _, commit := range commits {
+		for _, list := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range list {
+				if !seen[file] {
+					seen[file] = true
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	event.ChangedFiles = files
+	event.FilesComplete = true
+}
+
+// mergeReplaced folds the changes of a pending run replaced by on_busy:
+// coalesce into req, so path filters also check the replaced pushes: the file
+// lists are merged and the oldest previous commit is kept. Replacing a run
+// that deploys regardless of path filters makes req deploy too.
+func (req *deployRequest) mergeReplaced(replaced *deployRequest) {
+	if !req.isWebhookPush() {
+		return
+	}
+	if !replaced.isWebhookPush() || replaced.deployAll {
+		req.deployAll = true
+		return
+	}
+
+	merged := *req.event
+	merged.Before = replaced.event.Before
+	merged.FilesComplete = replaced.event.FilesComplete && req.event.FilesComplete
+	merged.ChangedFiles = nil
+	if merged.FilesComplete {
+		seen := make(map[string]bool)
+		for _, file := range append(slices.Clone(replaced.event.ChangedFiles), req.event.ChangedFiles...) {
+			if !seen[file] {
+				seen[file] = true
+				merged.ChangedFiles = append(merged.ChangedFiles, file)
+			}
+		}
+	}
+	req.event = &merged
+}
+
+// hasPathFilters reports whether the project filters pushes by changed paths
+func (p *ProjectConfig) hasPathFilters() bool {
+	return len(p.IncludePaths) > 0 || len(p.ExcludePaths) > 0
+}
+
+// relevantFiles returns the changed files that deploy the project: files not
+// matching exclude_paths that, when include_paths is set, match include_paths
+func (p *ProjectConfig) relevantFiles(files []string) []string {
+	var relevant []string
+	for _, file := range files {
+		if matchAnyPath(p.ExcludePaths, file) {
+			continue
+		}
+		if len(p.IncludePaths) > 0 && !matchAnyPath(p.IncludePaths, file) {
+			continue
+		}
+		relevant = append(relevant, file)
+	}
+	return relevant
+}
+
+// pathFilterDescription names a project's path filters for log messages
+func (p *ProjectConfig) pathFilterDescription() string {
+	var parts []string
+	if len(p.IncludePaths) > 0 {
+		parts = append(parts, "include_paths "+strings.Join(p.IncludePaths, ", "))
+	}
+	if len(p.ExcludePaths) > 0 {
+		parts = append(parts, "exclude_paths "+strings.Join(p.ExcludePaths, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// matchAnyPath reports whether the file matches any of the path globs
+func matchAnyPath(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if matchPathGlob(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathGlob matches a repository-relative file path against a glob.
+// Segments use path.Match syntax; a "**" segment matches any number of
+// directories (e.g., services/api/** or **/*.md).
+func matchPathGlob(pattern, file string) bool {
+	return matchPathSegments(strings.Split(pattern, "/"), strings.Split(file, "/"))
+}
+
+// matchPathSegments matches path segments against pattern segments
+func matchPathSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Match the rest of the pattern at every remaining depth
+			for i := 0; i <= len(segments); i++ {
+				if matchPathSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, err := path.Match(pattern[0], segments[0]); err != nil || !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// validatePathGlob checks the syntax of an include_paths or exclude_paths glob
+func validatePathGlob(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty pattern")
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// gitChangedFiles lists the files changed between a commit and HEAD of the
+// repository in dir, with git diff --name-only
+func gitChangedFiles(ctx context.Context, dir, since string) ([]string, error) {
+	if !isCommitSHA(since) || strings.Trim(since, "0") == "" {
+		return nil, fmt.Errorf("no previous commit to compare with")
+	}
+	// core.quotepath=off prints non-ASCII paths verbatim rather than quoted
+	cmd := buildCommand(ctx, fmt.Sprintf("git -c core.quotepath=off diff --name-only %s HEAD", since))
+	setProcessGroup(cmd)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff --name-only %s HEAD failed: %v", since, err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
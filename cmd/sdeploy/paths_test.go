@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMatchPathGlob tests include_paths/exclude_paths glob matching
+func TestMatchPathGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		file     string
+		expected bool
+	}{
+		{"services/api/**", "services/api/main.go", true},
+		{"services/api/**", "services/api/internal/db/db.go", true},
+		{"services/api/**", "services/web/main.go", false},
+		{"services/*/Dockerfile", "services/api/Dockerfile", true},
+		{"services/*/Dockerfile", "services/api/build/Dockerfile", false},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/guide/setup.md", true},
+		{"**/*.md", "docs/guide/setup.go", false},
+		{"go.mod", "go.mod", true},
+		{"go.mod", "services/api/go.mod", false},
+		{"*.go", "services/api/main.go", false},
+	}
+
+	for _, tc := range tests {
+		if got := matchPathGlob(tc.pattern, tc.file); got != tc.expected {
+			t.Errorf("matchPathGlob(%q, %q) = %t, expected %t", tc.pattern, tc.file, got, tc.expected)
+		}
+	}
+}
+
+// TestProjectRelevantFiles tests combining include_paths and exclude_paths
+func TestProjectRelevantFiles(t *testing.T) {
+	project := &ProjectConfig{
+		IncludePaths: []string{"services/api/**", "go.mod"},
+		ExcludePaths: []string{"**/*.md"},
+	}
+	files := []string{"services/api/main.go", "services/api/README.md", "services/web/main.go", "go.mod"}
+	if got := strings.Join(project.relevantFiles(files), ","); got != "services/api/main.go,go.mod" {
+		t.Errorf("Expected services/api/main.go,go.mod, got %s", got)
+	}
+
+	excludeOnly := &ProjectConfig{ExcludePaths: []string{"docs/**"}}
+	if len(excludeOnly.relevantFiles([]string{"docs/index.md"})) != 0 || len(excludeOnly.relevantFiles([]string{"docs/index.md", "main.go"})) != 1 {
+		t.Error("Expected exclude_paths alone to ignore only excluded files")
+	}
+}
+
+// TestParseEventChangedFiles tests collecting changed files from push payloads
+func TestParseEventChangedFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		payload  string
+		files    string
+		complete bool
+	}{
+		{"github", map[string]string{"X-Hub-Signature-256": "x"},
+			`{"ref":"refs/heads/main","before":"aaa","commits":[{"added":["a.go"],"modified":["b.go"]},{"removed":["c.go"],"modified":["a.go"]}]}`, "a.go,b.go,c.go", true},
+		{"github without commits", map[string]string{"X-Hub-Signature-256": "x"}, `{"ref":"refs/heads/main","before":"aaa","commits":[]}`, "", false},
+		{"gitlab complete", map[string]string{"X-Gitlab-Token": "x"},
+			`{"ref":"refs/heads/main","total_commits_count":1,"commits":[{"modified":["a.go"]}]}`, "a.go", true},
+		{"gitlab truncated", map[string]string{"X-Gitlab-Token": "x"},
+			`{"ref":"refs/heads/main","total_commits_count":25,"commits":[{"modified":["a.go"]}]}`, "", false},
+		{"gitea truncated", map[string]string{"X-Gitea-Signature": "x"},
+			`{"ref":"refs/heads/main","total_commits":30,"commits":[{"modified":["a.go"]}]}`, "", false},
+		{"bitbucket", map[string]string{"X-Event-Key": "repo:refs_changed", "X-Hub-Signature": "x"},
+			`{"changes":[{"ref":{"id":"refs/heads/main"},"fromHash":"aaa","toHash":"bbb"}]}`, "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/test", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			event := parseWebhookEvent(req, []byte(tc.payload))
+			if got := strings.Join(event.ChangedFiles, ","); got != tc.files || event.FilesComplete != tc.complete {
+				t.Errorf("Expected files=%q complete=%t, got files=%q complete=%t", tc.files, tc.complete, got, event.FilesComplete)
+			}
+		})
+	}
+}
+
+// TestWebhookPathFilters tests skipping pushes whose file lists change no relevant path
+func TestWebhookPathFilters(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "API",
+				WebhookPath:    "/hooks/api",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+				IncludePaths:   []string{"services/api/**"},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	metrics := NewMetrics()
+	handler := NewWebhookHandler(cfg, NewLogger(&buf, "", false))
+	handler.SetMetrics(metrics)
+
+	tests := []struct {
+		name    string
+		payload string
+		body    string
+	}{
+		{"relevant change", `{"ref":"refs/heads/main","commits":[{"modified":["services/api/main.go","README.md"]}]}`, "Accepted"},
+		{"unrelated change", `{"ref":"refs/heads/main","commits":[{"modified":["services/web/main.go"]}]}`, "Accepted (no relevant changes, skipped)"},
+		{"no file lists", `{"ref":"refs/heads/main","before":"aaa","commits":[]}`, "Accepted"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/api", strings.NewReader(tc.payload))
+			req.Header.Set("X-Hub-Signature-256", "sha256="+hexHMAC(tc.payload, "mysecret"))
+			req.Header.Set("X-GitHub-Event", "push")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusAccepted || rr.Body.String() != tc.body {
+				t.Errorf("Expected 202 %q, got %d %q", tc.body, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if !strings.Contains(buf.String(), "No relevant changes: none of 1 changed files match include_paths services/api/**") {
+		t.Errorf("Expected skip log line, got:\n%s", buf.String())
+	}
+	var out bytes.Buffer
+	metrics.WriteTo(&out)
+	if !strings.Contains(out.String(), `sdeploy_webhooks_total{project="API",outcome="no_changes"} 1`) {
+		t.Errorf("Expected no_changes metric, got:\n%s", out.String())
+	}
+}
+
+// pushTestFile commits a new file in work, pushes it to origin and returns the commit SHA
+func pushTestFile(t *testing.T, work, name string) string {
+	t.Helper()
+	file := filepath.Join(work, name)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	runGit(t, work, "add", name)
+	runGit(t, work, "commit", "-m", name)
+	runGit(t, work, "push", "origin", "main")
+	return runGit(t, work, "rev-parse", "HEAD")
+}
+
+// TestDeployPathFiltersGitDiff tests checking path filters with git diff when
+// the webhook carries no complete file lists
+func TestDeployPathFiltersGitDiff(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	base := pushTestCommit(t, work, "v1")
+
+	docs := pushTestFile(t, work, "docs/index.md")
+
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:           "API",
+		WebhookPath:    "/hooks/api",
+		GitRepo:        origin,
+		GitBranch:      "main",
+		GitUpdate:      true,
+		GitStrategy:    GitStrategyFetchReset,
+		LocalPath:      filepath.Join(t.TempDir(), "app"),
+		ExecuteCommand: "echo deployed",
+		IncludePaths:   []string{"services/api/**"},
+	}
+
+	result := deployer.DeployEvent(context.Background(), project, "WEBHOOK", &WebhookEvent{Kind: EventPush, Branch: "main", Before: base, Commit: docs})
+	if !result.Skipped || result.Output != "" {
+		t.Errorf("Expected docs-only push to be skipped, got %+v", result)
+	}
+
+	api := pushTestFile(t, work, "services/api/main.go")
+	result = deployer.DeployEvent(context.Background(), project, "WEBHOOK", &WebhookEvent{Kind: EventPush, Branch: "main", Before: docs, Commit: api})
+	if !result.Success || !strings.Contains(result.Output, "deployed") {
+		t.Errorf("Expected services/api push to deploy, got %+v", result)
+	}
+
+	// Without a previous commit (e.g., a new branch) the project is deployed
+	result = deployer.DeployEvent(context.Background(), project, "WEBHOOK", &WebhookEvent{Kind: EventPush, Branch: "main", Before: strings.Repeat("0", 40), Commit: api})
+	if !result.Success {
+		t.Errorf("Expected push without a previous commit to deploy, got %+v", result)
+	}
+}
+
+// TestDeployPathFiltersCoalesced tests that a coalesced run checks the changes
+// of the pushes it replaced, not only those of the newest push
+func TestDeployPathFiltersCoalesced(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	base := pushTestCommit(t, work, "v1")
+
+	runsFile := filepath.Join(t.TempDir(), "runs.txt")
+	deployer := NewDeployer(nil)
+	project := &ProjectConfig{
+		Name:           "API",
+		WebhookPath:    "/hooks/api",
+		GitRepo:        origin,
+		GitBranch:      "main",
+		GitUpdate:      true,
+		GitStrategy:    GitStrategyFetchReset,
+		LocalPath:      filepath.Join(t.TempDir(), "app"),
+		ExecuteCommand: "echo $SDEPLOY_TRIGGER_SOURCE >> " + runsFile + " && sleep 0.3",
+		IncludePaths:   []string{"services/api/**"},
+		OnBusy:         OnBusyCoalesce,
+	}
+
+	go deployer.Deploy(context.Background(), project, "INTERNAL")
+	for i := 0; i < 100 && !deployer.IsDeploying(project.WebhookPath); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A relevant push is replaced by an unrelated one while the first run is busy
+	api := pushTestFile(t, work, "services/api/main.go")
+	deployer.DeployEvent(context.Background(), project, "WEBHOOK", &WebhookEvent{Kind: EventPush, Branch: "main", Before: base, Commit: api})
+	docs := pushTestFile(t, work, "docs/index.md")
+	result := deployer.DeployEvent(context.Background(), project, "WEBHOOK", &WebhookEvent{Kind: EventPush, Branch: "main", Before: api, Commit: docs})
+	if !result.Queued || result.QueueLength != 1 {
+		t.Fatalf("Expected the docs push to replace the pending run, got %+v", result)
+	}
+
+	waitForIdle(t, deployer)
+
+	content, err := os.ReadFile(runsFile)
+	if err != nil {
+		t.Fatalf("Failed to read runs file: %v", err)
+	}
+	if got := strings.Fields(string(content)); strings.Join(got, ",") != "INTERNAL,WEBHOOK" {
+		t.Errorf("Expected the coalesced run to deploy the services/api change, got runs %v", got)
+	}
+}
+
+// TestMergeReplaced tests merging the changes of a pending run replaced by on_busy: coalesce
+func TestMergeReplaced(t *testing.T) {
+	project := &ProjectConfig{Name: "API", IncludePaths: []string{"services/api/**"}}
+	push := func(before string, complete bool, files ...string) *deployRequest {
+		return &deployRequest{project: project, triggerSource: "WEBHOOK",
+			event: &WebhookEvent{Kind: EventPush, Before: before, ChangedFiles: files, FilesComplete: complete}}
+	}
+
+	req := push("b2", true, "docs/index.md", "README.md")
+	req.mergeReplaced(push("b1", true, "services/api/main.go", "README.md"))
+	if req.event.Before != "b1" || !req.event.FilesComplete ||
+		strings.Join(req.event.ChangedFiles, ",") != "services/api/main.go,README.md,docs/index.md" {
+		t.Errorf("Expected merged files since b1, got %+v", req.event)
+	}
+
+	req = push("b2", true, "docs/index.md")
+	req.mergeReplaced(push("b1", false))
+	if req.event.Before != "b1" || req.event.FilesComplete || !req.filtersChangedPaths() {
+		t.Errorf("Expected an incomplete merge checked with git diff since b1, got %+v", req.event)
+	}
+
+	req = push("b2", false)
+	req.mergeReplaced(&deployRequest{project: project, triggerSource: "INTERNAL"})
+	if req.filtersChangedPaths() {
+		t.Error("Expected replacing an internal trigger to deploy regardless of path filters")
+	}
+}
@@ -19,7 +19,7 @@ func getEffectiveExecutePath(localPath, executePath string) string {
 // It verifies and creates directories with standard permissions.
 func runPreflightChecks(ctx context.Context, project *ProjectConfig, logger *Logger) error {
 	if logger != nil {
-		logger.Infof(project.Name, "Running preflight checks")
+		logger.InfofContext(ctx, project.Name, "Running preflight checks")
 	}
 
 	// Get effective execute_path (default to local_path if not set)
@@ -27,27 +27,28 @@ func runPreflightChecks(ctx context.Context, project *ProjectConfig, logger *Log
 
 	// Check and create local_path if needed
 	if project.LocalPath != "" {
-		if err := ensureDirectoryExists(project.LocalPath, logger, project.Name); err != nil {
+		if err := ensureDirectoryExists(ctx, project.LocalPath, logger, project.Name); err != nil {
 			return fmt.Errorf("failed to ensure local_path exists: %w", err)
 		}
 	}
 
-	// Check and create execute_path if needed (and different from local_path)
-	if effectiveExecutePath != "" && effectiveExecutePath != project.LocalPath {
-		if err := ensureDirectoryExists(effectiveExecutePath, logger, project.Name); err != nil {
+	// Check and create execute_path if needed (and different from local_path).
+	// In release_mode, execute_path lives inside each release directory.
+	if !project.ReleaseMode && effectiveExecutePath != "" && effectiveExecutePath != project.LocalPath {
+		if err := ensureDirectoryExists(ctx, effectiveExecutePath, logger, project.Name); err != nil {
 			return fmt.Errorf("failed to ensure execute_path exists: %w", err)
 		}
 	}
 
 	if logger != nil {
-		logger.Infof(project.Name, "Preflight checks completed")
+		logger.InfofContext(ctx, project.Name, "Preflight checks completed")
 	}
 
 	return nil
 }
 
 // ensureDirectoryExists ensures a directory exists with standard permissions (0755).
-func ensureDirectoryExists(dirPath string, logger *Logger, projectName string) error {
+func ensureDirectoryExists(ctx context.Context, dirPath string, logger *Logger, projectName string) error {
 	// Check if directory already exists
 	info, err := os.Stat(dirPath)
 	if err == nil {
@@ -66,7 +67,7 @@ func ensureDirectoryExists(dirPath string, logger *Logger, projectName string) e
 
 	// Directory does not exist, create it
 	if logger != nil {
-		logger.Infof(projectName, "Creating directory: %s", dirPath)
+		logger.InfofContext(ctx, projectName, "Creating directory: %s", dirPath)
 	}
 
 	if err := os.MkdirAll(dirPath, 0755); err != nil {
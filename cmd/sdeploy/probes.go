@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Probe paths served outside the webhook handler (no POST or auth required)
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+)
+
+// Probe check states
+const (
+	ProbeOK      = "ok"
+	ProbeFailed  = "fail"
+	ProbeSkipped = "skipped"
+)
+
+// ProbeHandler serves the liveness and readiness endpoints
+type ProbeHandler struct {
+	configManager *ConfigManager
+	logger        *Logger
+	startTime     time.Time
+	mux           *http.ServeMux
+	lookPath      func(file string) (string, error) // exec.LookPath, replaced in tests
+}
+
+// probeCheck is the result of a single readiness check
+type probeCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// probeResponse is the JSON body returned by both probes
+type probeResponse struct {
+	Status        string       `json:"status"`
+	UptimeSeconds int64        `json:"uptime_seconds"`
+	Checks        []probeCheck `json:"checks"`
+}
+
+// NewProbeHandler creates a new liveness/readiness handler
+func NewProbeHandler(cm *ConfigManager, logger *Logger) *ProbeHandler {
+	h := &ProbeHandler{
+		configManager: cm,
+		logger:        logger,
+		startTime:     time.Now(),
+		mux:           http.NewServeMux(),
+		lookPath:      exec.LookPath,
+	}
+
+	h.mux.HandleFunc("GET "+HealthzPath, h.handleHealthz)
+	h.mux.HandleFunc("GET "+ReadyzPath, h.handleReadyz)
+
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// handleHealthz reports that the process is up and the HTTP loop is serving requests
+func (h *ProbeHandler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h.writeProbe(w, []probeCheck{{Name: "http", Status: ProbeOK}})
+}
+
+// handleReadyz reports whether sdeploy is able to accept and run deployments
+func (h *ProbeHandler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	var cfg *Config
+	if h.configManager != nil {
+		cfg = h.configManager.GetConfig()
+	}
+
+	checks := []probeCheck{
+		checkConfig(cfg),
+		h.checkLogger(),
+		checkStateDir(cfg),
+		h.checkGit(cfg),
+	}
+	h.writeProbe(w, checks)
+}
+
+// writeProbe writes the probe response: 200 if no check failed, 503 otherwise
+func (h *ProbeHandler) writeProbe(w http.ResponseWriter, checks []probeCheck) {
+	resp := probeResponse{
+		Status:        ProbeOK,
+		UptimeSeconds: int64(time.Since(h.startTime).Seconds()),
+		Checks:        checks,
+	}
+	status := http.StatusOK
+	for _, check := range checks {
+		if check.Status == ProbeFailed {
+			resp.Status = ProbeFailed
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, resp)
+}
+
+// checkConfig verifies a configuration is loaded
+func checkConfig(cfg *Config) probeCheck {
+	if cfg == nil {
+		return probeCheck{Name: "config", Status: ProbeFailed, Detail: "no configuration loaded"}
+	}
+	return probeCheck{Name: "config", Status: ProbeOK, Detail: fmt.Sprintf("%d projects", len(cfg.Projects))}
+}
+
+// checkLogger verifies the log writer is healthy
+func (h *ProbeHandler) checkLogger() probeCheck {
+	if h.logger == nil {
+		return probeCheck{Name: "log", Status: ProbeSkipped, Detail: "no logger configured"}
+	}
+	if err := h.logger.Health(); err != nil {
+		return probeCheck{Name: "log", Status: ProbeFailed, Detail: err.Error()}
+	}
+	return probeCheck{Name: "log", Status: ProbeOK}
+}
+
+// checkStateDir verifies state_dir is writable by creating and removing a temporary file
+func checkStateDir(cfg *Config) probeCheck {
+	if cfg == nil || cfg.StateDir == "" {
+		return probeCheck{Name: "state_dir", Status: ProbeSkipped, Detail: "state_dir not configured"}
+	}
+	file, err := os.CreateTemp(cfg.StateDir, ".readyz-*")
+	if err != nil {
+		return probeCheck{Name: "state_dir", Status: ProbeFailed, Detail: fmt.Sprintf("%s is not writable: %v", cfg.StateDir, err)}
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return probeCheck{Name: "state_dir", Status: ProbeOK, Detail: cfg.StateDir}
+}
+
+// checkGit verifies the git binary is present when any project uses git_repo
+func (h *ProbeHandler) checkGit(cfg *Config) probeCheck {
+	if !usesGit(cfg) {
+		return probeCheck{Name: "git", Status: ProbeSkipped, Detail: "no project uses git_repo"}
+	}
+	path, err := h.lookPath("git")
+	if err != nil {
+		return probeCheck{Name: "git", Status: ProbeFailed, Detail: "git binary not found in PATH"}
+	}
+	return probeCheck{Name: "git", Status: ProbeOK, Detail: path}
+}
+
+// usesGit reports whether any configured project deploys from a git repository
+func usesGit(cfg *Config) bool {
+	if cfg == nil {
+		return false
+	}
+	for i := range cfg.Projects {
+		if cfg.Projects[i].GitRepo != "" {
+			return true
+		}
+	}
+	return false
+}
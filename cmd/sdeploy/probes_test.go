@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newProbeTestHandler creates a probe handler backed by a config written to a temp file
+func newProbeTestHandler(t *testing.T, config string) *ProbeHandler {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "sdeploy.conf")
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	cm, err := NewConfigManager(configPath, nil)
+	if err != nil {
+		t.Fatalf("NewConfigManager failed: %v", err)
+	}
+	return NewProbeHandler(cm, NewLogger(&bytes.Buffer{}, "", false))
+}
+
+// serveProbe performs a probe request and decodes the JSON response
+func serveProbe(t *testing.T, h *ProbeHandler, method, path string) (int, probeResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+	var resp probeResponse
+	if rr.Code != http.StatusMethodNotAllowed && method != "HEAD" {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode probe response %q: %v", rr.Body.String(), err)
+		}
+	}
+	return rr.Code, resp
+}
+
+// checkStatus returns the status of the named check, or "" if absent
+func checkStatus(resp probeResponse, name string) string {
+	for _, check := range resp.Checks {
+		if check.Name == name {
+			return check.Status
+		}
+	}
+	return ""
+}
+
+// TestProbeHealthz tests the liveness endpoint and its method handling
+func TestProbeHealthz(t *testing.T) {
+	h := NewProbeHandler(nil, nil)
+
+	code, resp := serveProbe(t, h, "GET", HealthzPath)
+	if code != http.StatusOK || resp.Status != ProbeOK {
+		t.Errorf("Expected 200 ok, got %d %q", code, resp.Status)
+	}
+	if code, _ := serveProbe(t, h, "HEAD", HealthzPath); code != http.StatusOK {
+		t.Errorf("Expected 200 for HEAD, got %d", code)
+	}
+	if code, _ := serveProbe(t, h, "POST", HealthzPath); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", code)
+	}
+}
+
+// TestProbeReadyz tests readiness checks for config, logger, state_dir and git
+func TestProbeReadyz(t *testing.T) {
+	stateDir := t.TempDir()
+	h := newProbeTestHandler(t, `
+state_dir: `+stateDir+`
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret1
+    git_repo: https://example.com/app.git
+    local_path: /tmp/app
+    execute_command: make
+`)
+	h.lookPath = func(string) (string, error) { return "/usr/bin/git", nil }
+
+	code, resp := serveProbe(t, h, "GET", ReadyzPath)
+	if code != http.StatusOK || resp.Status != ProbeOK {
+		t.Fatalf("Expected 200 ok, got %d %+v", code, resp)
+	}
+	for _, name := range []string{"config", "log", "state_dir", "git"} {
+		if got := checkStatus(resp, name); got != ProbeOK {
+			t.Errorf("Expected check %s to be ok, got %q", name, got)
+		}
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 0 {
+		t.Errorf("Expected readiness probe to leave state_dir empty, found %d entries", len(entries))
+	}
+
+	// Missing git binary fails readiness
+	h.lookPath = func(string) (string, error) { return "", errors.New("not found") }
+	code, resp = serveProbe(t, h, "GET", ReadyzPath)
+	if code != http.StatusServiceUnavailable || checkStatus(resp, "git") != ProbeFailed {
+		t.Errorf("Expected 503 with failed git check, got %d %+v", code, resp)
+	}
+
+	// Unwritable state_dir fails readiness
+	h.lookPath = func(string) (string, error) { return "/usr/bin/git", nil }
+	os.RemoveAll(stateDir)
+	code, resp = serveProbe(t, h, "GET", ReadyzPath)
+	if code != http.StatusServiceUnavailable || checkStatus(resp, "state_dir") != ProbeFailed {
+		t.Errorf("Expected 503 with failed state_dir check, got %d %+v", code, resp)
+	}
+}
+
+// TestProbeReadyzSkipsGit tests that the git check is skipped when no project uses git_repo
+func TestProbeReadyzSkipsGit(t *testing.T) {
+	h := newProbeTestHandler(t, `
+state_dir: `+t.TempDir()+`
+projects:
+  - name: App
+    webhook_path: /hooks/app
+    webhook_secret: secret1
+    execute_command: make
+`)
+	h.lookPath = func(string) (string, error) { return "", errors.New("not found") }
+
+	code, resp := serveProbe(t, h, "GET", ReadyzPath)
+	if code != http.StatusOK || checkStatus(resp, "git") != ProbeSkipped {
+		t.Errorf("Expected 200 with skipped git check, got %d %+v", code, resp)
+	}
+}
+
+// TestProbeReadyzLogFailure tests that a failing log writer fails readiness
+func TestProbeReadyzLogFailure(t *testing.T) {
+	h := newProbeTestHandler(t, `
+state_dir: `+t.TempDir()+`
+projects: []
+`)
+	h.logger = NewLogger(failingWriter{}, "", false)
+	h.logger.Info("", "message")
+
+	code, resp := serveProbe(t, h, "GET", ReadyzPath)
+	if code != http.StatusServiceUnavailable || checkStatus(resp, "log") != ProbeFailed {
+		t.Errorf("Expected 503 with failed log check, got %d %+v", code, resp)
+	}
+}
+
+// failingWriter is an io.Writer that always fails
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
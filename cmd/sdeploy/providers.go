@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Git forge providers that send webhooks
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderGitea     = "gitea"
+	ProviderBitbucket = "bitbucket"
+	ProviderGeneric   = "generic" // Internal triggers (?secret=) with a {"ref": ...} payload
+)
+
+// WebhookProvider authenticates and parses webhooks sent by a git forge
+type WebhookProvider interface {
+	// Name returns the provider identifier (e.g., github)
+	Name() string
+	// Detect reports whether the request carries this provider's headers
+	Detect(r *http.Request) bool
+	// Authenticate validates the request against the project's webhook secret
+	Authenticate(r *http.Request, body []byte, secret string) bool
+	// ParseEvent extracts branch, tag, commit and repo from the payload
+	ParseEvent(r *http.Request, body []byte) *WebhookEvent
+}
+
+// webhookProviders lists providers in detection order.
+// Forges that also send GitHub-compatible headers must come before GitHub.
+var webhookProviders = []WebhookProvider{
+	gitlabProvider{},
+	giteaProvider{},
+	bitbucketProvider{},
+	githubProvider{},
+}
+
+// detectProvider returns the provider matching the request headers, or nil if none match
+func detectProvider(r *http.Request) WebhookProvider {
+	for _, provider := range webhookProviders {
+		if provider.Detect(r) {
+			return provider
+		}
+	}
+	return nil
+}
+
+// validateHMAC validates HMAC-SHA256 signature
+func validateHMAC(payload []byte, signature, secret string) bool {
+	// Signature format: sha256=<hex>
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return validateHexHMAC(payload, strings.TrimPrefix(signature, "sha256="), secret)
+}
+
+// validateHexHMAC validates a raw hex-encoded HMAC-SHA256 signature (no prefix)
+func validateHexHMAC(payload []byte, signature, secret string) bool {
+	providedMAC, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expectedMAC := mac.Sum(nil)
+
+	return hmac.Equal(providedMAC, expectedMAC)
+}
+
+// validateToken compares a shared secret token using constant-time comparison
+func validateToken(token, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// githubProvider handles GitHub webhooks signed with X-Hub-Signature-256
+type githubProvider struct{}
+
+func (githubProvider) Name() string { return ProviderGitHub }
+
+func (githubProvider) Detect(r *http.Request) bool {
+	return r.Header.Get("X-Hub-Signature-256") != ""
+}
+
+func (githubProvider) Authenticate(r *http.Request, body []byte, secret string) bool {
+	return validateHMAC(body, r.Header.Get("X-Hub-Signature-256"), secret)
+}
+
+func (githubProvider) ParseEvent(r *http.Request, body []byte) *WebhookEvent {
+	event := extractGitHubEvent(body)
+	event.Event = r.Header.Get("X-GitHub-Event")
+	event.Delivery = r.Header.Get("X-GitHub-Delivery")
+	classifyGitHubEvent(event, body)
+	return event
+}
+
+// extractGitHubEvent extracts branch, tag, commit and repo from a GitHub push payload
+func extractGitHubEvent(payload []byte) *WebhookEvent {
+	event := &WebhookEvent{Provider: ProviderGitHub}
+
+	var data struct {
+		Ref          string       `json:"ref"`
+		Before       string       `json:"before"`
+		After        string       `json:"after"`
+		Commits      []pushCommit `json:"commits"`
+		TotalCommits int          `json:"total_commits"` // Gitea
+		Repository   struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return event
+	}
+
+	event.Branch, event.Tag = parseRef(data.Ref)
+	event.Commit = data.After
+	event.Before = data.Before
+	event.Repo = data.Repository.FullName
+	event.setChangedFiles(data.Commits, data.TotalCommits)
+	return event
+}
+
+// gitlabProvider handles GitLab webhooks authenticated with X-Gitlab-Token
+type gitlabProvider struct{}
+
+func (gitlabProvider) Name() string { return ProviderGitLab }
+
+func (gitlabProvider) Detect(r *http.Request) bool {
+	return r.Header.Get("X-Gitlab-Token") != ""
+}
+
+func (gitlabProvider) Authenticate(r *http.Request, body []byte, secret string) bool {
+	// GitLab sends the secret token verbatim
+	return validateToken(r.Header.Get("X-Gitlab-Token"), secret)
+}
+
+func (gitlabProvider) ParseEvent(r *http.Request, body []byte) *WebhookEvent {
+	event := extractGitLabEvent(body)
+	event.Event = r.Header.Get("X-Gitlab-Event")
+	event.Delivery = r.Header.Get("X-Gitlab-Event-UUID")
+	classifyGitLabEvent(event, body)
+	return event
+}
+
+// extractGitLabEvent extracts branch, tag, commit and repo from a GitLab push or tag push payload
+func extractGitLabEvent(payload []byte) *WebhookEvent {
+	event := &WebhookEvent{Provider: ProviderGitLab}
+
+	var data struct {
+		Ref               string       `json:"ref"`
+		CheckoutSHA       string       `json:"checkout_sha"`
+		Before            string       `json:"before"`
+		After             string       `json:"after"`
+		Commits           []pushCommit `json:"commits"`
+		TotalCommitsCount int          `json:"total_commits_count"` // Commits are limited to 20
+		Project           struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return event
+	}
+
+	event.Branch, event.Tag = parseRef(data.Ref)
+	event.Commit = data.CheckoutSHA
+	if event.Commit == "" {
+		event.Commit = data.After
+	}
+	event.Before = data.Before
+	event.Repo = data.Project.PathWithNamespace
+	event.setChangedFiles(data.Commits, data.TotalCommitsCount)
+	return event
+}
+
+// giteaProvider handles Gitea and Forgejo webhooks signed with a raw hex HMAC
+type giteaProvider struct{}
+
+func (giteaProvider) Name() string { return ProviderGitea }
+
+func (giteaProvider) Detect(r *http.Request) bool {
+	return giteaSignature(r) != ""
+}
+
+func (giteaProvider) Authenticate(r *http.Request, body []byte, secret string) bool {
+	// Gitea signatures are raw hex without the "sha256=" prefix
+	return validateHexHMAC(body, giteaSignature(r), secret)
+}
+
+func (giteaProvider) ParseEvent(r *http.Request, body []byte) *WebhookEvent {
+	// Gitea push payloads follow the GitHub format
+	event := extractGitHubEvent(body)
+	event.Provider = ProviderGitea
+	event.Event = r.Header.Get("X-Gitea-Event")
+	if event.Event == "" {
+		event.Event = r.Header.Get("X-Forgejo-Event")
+	}
+	event.Delivery = r.Header.Get("X-Gitea-Delivery")
+	if event.Delivery == "" {
+		event.Delivery = r.Header.Get("X-Forgejo-Delivery")
+	}
+	// Gitea event types and payloads follow GitHub's
+	classifyGitHubEvent(event, body)
+	return event
+}
+
+// giteaSignature returns the Gitea or Forgejo signature header
+func giteaSignature(r *http.Request) string {
+	if signature := r.Header.Get("X-Gitea-Signature"); signature != "" {
+		return signature
+	}
+	return r.Header.Get("X-Forgejo-Signature")
+}
+
+// bitbucketProvider handles Bitbucket Cloud and Server webhooks signed with X-Hub-Signature
+type bitbucketProvider struct{}
+
+func (bitbucketProvider) Name() string { return ProviderBitbucket }
+
+func (bitbucketProvider) Detect(r *http.Request) bool {
+	// GitHub also sends X-Hub-Signature, so require Bitbucket's X-Event-Key as well
+	return r.Header.Get("X-Event-Key") != "" && r.Header.Get("X-Hub-Signature") != ""
+}
+
+func (bitbucketProvider) Authenticate(r *http.Request, body []byte, secret string) bool {
+	return validateHMAC(body, r.Header.Get("X-Hub-Signature"), secret)
+}
+
+func (bitbucketProvider) ParseEvent(r *http.Request, body []byte) *WebhookEvent {
+	event := extractBitbucketEvent(body)
+	event.Event = r.Header.Get("X-Event-Key")
+	// Bitbucket Cloud sends X-Request-UUID, Bitbucket Server X-Request-Id
+	event.Delivery = r.Header.Get("X-Request-UUID")
+	if event.Delivery == "" {
+		event.Delivery = r.Header.Get("X-Request-Id")
+	}
+	classifyBitbucketEvent(event, body)
+	return event
+}
+
+// extractBitbucketEvent extracts branch, tag, commit and repo from a Bitbucket push payload.
+// Supports Bitbucket Server (repo:refs_changed) and Bitbucket Cloud (repo:push) formats.
+func extractBitbucketEvent(payload []byte) *WebhookEvent {
+	event := &WebhookEvent{Provider: ProviderBitbucket}
+
+	var data struct {
+		// Bitbucket Server
+		Changes []struct {
+			Ref struct {
+				ID string `json:"id"`
+			} `json:"ref"`
+			FromHash string `json:"fromHash"`
+			ToHash   string `json:"toHash"`
+		} `json:"changes"`
+		// Bitbucket Cloud
+		Push struct {
+			Changes []struct {
+				New *struct {
+					Type   string `json:"type"`
+					Name   string `json:"name"`
+					Target struct {
+						Hash string `json:"hash"`
+					} `json:"target"`
+				} `json:"new"`
+				Old *struct {
+					Target struct {
+						Hash string `json:"hash"`
+					} `json:"target"`
+				} `json:"old"`
+			} `json:"changes"`
+		} `json:"push"`
+		Repository struct {
+			FullName string `json:"full_name"`
+			Slug     string `json:"slug"`
+			Project  struct {
+				Key string `json:"key"`
+			} `json:"project"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return event
+	}
+
+	if len(data.Changes) > 0 {
+		change := data.Changes[0]
+		event.Branch, event.Tag = parseRef(change.Ref.ID)
+		event.Commit = change.ToHash
+		event.Before = change.FromHash
+	} else {
+		for _, change := range data.Push.Changes {
+			// A nil "new" means the branch or tag was deleted
+			if change.New == nil {
+				continue
+			}
+			switch change.New.Type {
+			case "branch":
+				event.Branch = change.New.Name
+			case "tag":
+				event.Tag = change.New.Name
+			}
+			event.Commit = change.New.Target.Hash
+			// A nil "old" means the branch or tag was created
+			if change.Old != nil {
+				event.Before = change.Old.Target.Hash
+			}
+			break
+		}
+	}
+
+	event.Repo = data.Repository.FullName
+	if event.Repo == "" && data.Repository.Slug != "" {
+		event.Repo = data.Repository.Project.Key + "/" + data.Repository.Slug
+	}
+	return event
+}
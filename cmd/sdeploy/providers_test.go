@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// hexHMAC computes a hex-encoded HMAC-SHA256 for tests
+func hexHMAC(payload, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TestDetectProvider tests provider auto-detection by request headers
+func TestDetectProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected string
+	}{
+		{"github", map[string]string{"X-Hub-Signature-256": "sha256=abc", "X-Hub-Signature": "sha1=abc", "X-GitHub-Event": "push"}, ProviderGitHub},
+		{"gitlab", map[string]string{"X-Gitlab-Token": "secret", "X-Gitlab-Event": "Push Hook"}, ProviderGitLab},
+		{"gitea with github-compatible headers", map[string]string{"X-Gitea-Signature": "abc", "X-Hub-Signature-256": "sha256=abc"}, ProviderGitea},
+		{"forgejo", map[string]string{"X-Forgejo-Signature": "abc"}, ProviderGitea},
+		{"bitbucket", map[string]string{"X-Event-Key": "repo:refs_changed", "X-Hub-Signature": "sha256=abc"}, ProviderBitbucket},
+		{"no provider headers", map[string]string{}, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/test", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			provider := detectProvider(req)
+			name := ""
+			if provider != nil {
+				name = provider.Name()
+			}
+			if name != tc.expected {
+				t.Errorf("Expected provider %q, got %q", tc.expected, name)
+			}
+		})
+	}
+}
+
+// TestGiteaProviderAuthenticate tests raw hex HMAC validation for Gitea/Forgejo
+func TestGiteaProviderAuthenticate(t *testing.T) {
+	payload := `{"ref":"refs/heads/main"}`
+	provider := giteaProvider{}
+
+	req := httptest.NewRequest("POST", "/hooks/test", nil)
+	req.Header.Set("X-Gitea-Signature", hexHMAC(payload, "mysecret"))
+	if !provider.Authenticate(req, []byte(payload), "mysecret") {
+		t.Error("Expected valid Gitea signature to authenticate")
+	}
+	if provider.Authenticate(req, []byte(payload), "wrong") {
+		t.Error("Expected Gitea signature with wrong secret to fail")
+	}
+
+	// Gitea signatures carry no sha256= prefix
+	req.Header.Set("X-Gitea-Signature", "sha256="+hexHMAC(payload, "mysecret"))
+	if provider.Authenticate(req, []byte(payload), "mysecret") {
+		t.Error("Expected prefixed Gitea signature to fail")
+	}
+
+	req = httptest.NewRequest("POST", "/hooks/test", nil)
+	req.Header.Set("X-Forgejo-Signature", hexHMAC(payload, "mysecret"))
+	if !provider.Authenticate(req, []byte(payload), "mysecret") {
+		t.Error("Expected valid Forgejo signature to authenticate")
+	}
+}
+
+// TestBitbucketProviderAuthenticate tests X-Hub-Signature validation for Bitbucket
+func TestBitbucketProviderAuthenticate(t *testing.T) {
+	payload := `{"eventKey":"repo:refs_changed"}`
+	provider := bitbucketProvider{}
+
+	req := httptest.NewRequest("POST", "/hooks/test", nil)
+	req.Header.Set("X-Event-Key", "repo:refs_changed")
+	req.Header.Set("X-Hub-Signature", "sha256="+hexHMAC(payload, "mysecret"))
+	if !provider.Authenticate(req, []byte(payload), "mysecret") {
+		t.Error("Expected valid Bitbucket signature to authenticate")
+	}
+	if provider.Authenticate(req, []byte(payload), "wrong") {
+		t.Error("Expected Bitbucket signature with wrong secret to fail")
+	}
+}
+
+// TestExtractBitbucketEvent tests parsing Bitbucket Server and Cloud payloads
+func TestExtractBitbucketEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected WebhookEvent
+	}{
+		{
+			name:    "server branch push",
+			payload: `{"eventKey":"repo:refs_changed","repository":{"slug":"app","project":{"key":"PRJ"}},"changes":[{"ref":{"id":"refs/heads/main","displayId":"main","type":"BRANCH"},"fromHash":"aaa","toHash":"bbb","type":"UPDATE"}]}`,
+			expected: WebhookEvent{
+				Provider: ProviderBitbucket,
+				Branch:   "main",
+				Commit:   "bbb",
+				Before:   "aaa",
+				Repo:     "PRJ/app",
+			},
+		},
+		{
+			name:    "server tag push",
+			payload: `{"changes":[{"ref":{"id":"refs/tags/v2.0.0","type":"TAG"},"toHash":"ccc"}]}`,
+			expected: WebhookEvent{
+				Provider: ProviderBitbucket,
+				Tag:      "v2.0.0",
+				Commit:   "ccc",
+			},
+		},
+		{
+			name:    "cloud branch push",
+			payload: `{"push":{"changes":[{"new":{"type":"branch","name":"develop","target":{"hash":"ddd"}}}]},"repository":{"full_name":"team/app"}}`,
+			expected: WebhookEvent{
+				Provider: ProviderBitbucket,
+				Branch:   "develop",
+				Commit:   "ddd",
+				Repo:     "team/app",
+			},
+		},
+		{
+			name:    "cloud deleted branch is ignored",
+			payload: `{"push":{"changes":[{"new":null,"old":{"type":"branch","name":"old"}}]}}`,
+			expected: WebhookEvent{
+				Provider: ProviderBitbucket,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			event := extractBitbucketEvent([]byte(tc.payload))
+			if !reflect.DeepEqual(*event, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, *event)
+			}
+		})
+	}
+}
+
+// TestWebhookMultipleProviders tests that one handler accepts webhooks from all forges
+func TestWebhookMultipleProviders(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+	handler := NewWebhookHandler(cfg, nil)
+
+	githubPayload := `{"ref":"refs/heads/main"}`
+	bitbucketPayload := `{"changes":[{"ref":{"id":"refs/heads/main"},"toHash":"abc"}]}`
+
+	tests := []struct {
+		name    string
+		payload string
+		headers map[string]string
+		status  int
+	}{
+		{"github", githubPayload, map[string]string{"X-Hub-Signature-256": "sha256=" + hexHMAC(githubPayload, "mysecret")}, http.StatusAccepted},
+		{"gitlab", githubPayload, map[string]string{"X-Gitlab-Token": "mysecret"}, http.StatusAccepted},
+		{"gitea", githubPayload, map[string]string{"X-Gitea-Signature": hexHMAC(githubPayload, "mysecret")}, http.StatusAccepted},
+		{"gitea invalid", githubPayload, map[string]string{"X-Gitea-Signature": hexHMAC(githubPayload, "wrong")}, http.StatusUnauthorized},
+		{"bitbucket", bitbucketPayload, map[string]string{"X-Event-Key": "repo:refs_changed", "X-Hub-Signature": "sha256=" + hexHMAC(bitbucketPayload, "mysecret")}, http.StatusAccepted},
+		{"bitbucket invalid", bitbucketPayload, map[string]string{"X-Event-Key": "repo:refs_changed", "X-Hub-Signature": "sha256=" + hexHMAC(bitbucketPayload, "wrong")}, http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(tc.payload))
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, rr.Code)
+			}
+		})
+	}
+}
+
+// TestParseEventDelivery tests reading each forge's delivery ID header
+func TestParseEventDelivery(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"github", map[string]string{"X-Hub-Signature-256": "sha256=abc", "X-GitHub-Delivery": "id-1"}},
+		{"gitlab", map[string]string{"X-Gitlab-Token": "secret", "X-Gitlab-Event-UUID": "id-1"}},
+		{"gitea", map[string]string{"X-Gitea-Signature": "abc", "X-Gitea-Delivery": "id-1"}},
+		{"forgejo", map[string]string{"X-Forgejo-Signature": "abc", "X-Forgejo-Delivery": "id-1"}},
+		{"bitbucket cloud", map[string]string{"X-Event-Key": "repo:push", "X-Hub-Signature": "sha256=abc", "X-Request-UUID": "id-1"}},
+		{"bitbucket server", map[string]string{"X-Event-Key": "repo:refs_changed", "X-Hub-Signature": "sha256=abc", "X-Request-Id": "id-1"}},
+		{"signed trigger", map[string]string{TriggerNonceHeader: "id-1"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/test", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			if event := parseWebhookEvent(req, []byte(`{}`)); event.Delivery != "id-1" {
+				t.Errorf("Expected delivery id-1, got %q", event.Delivery)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedText replaces secrets in logs, run logs, history and emails
+const RedactedText = "[REDACTED]"
+
+// minSecretLength is the shortest secret masked literally; shorter values
+// would mangle unrelated text
+const minSecretLength = 4
+
+// Redactor masks configured secrets and user-supplied patterns in text.
+// A nil *Redactor leaves text unchanged. It is safe for concurrent use and
+// updated in place on config reload.
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  []string
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor creates a redactor for the secrets and patterns in cfg
+func NewRedactor(cfg *Config) *Redactor {
+	r := &Redactor{}
+	r.Update(cfg)
+	return r
+}
+
+// Update replaces the secrets and patterns with those of cfg
+func (r *Redactor) Update(cfg *Config) {
+	secrets, patterns := configSecrets(cfg)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secrets = secrets
+	r.patterns = patterns
+}
+
+// configSecrets collects the literal secrets and compiled redact_patterns of cfg.
+// Patterns are validated by LoadConfig, so invalid ones are skipped here.
+func configSecrets(cfg *Config) ([]string, []*regexp.Regexp) {
+	seen := make(map[string]bool)
+	var secrets []string
+	add := func(value string) {
+		if len(value) >= minSecretLength && !seen[value] {
+			seen[value] = true
+			secrets = append(secrets, value)
+		}
+	}
+
+	add(cfg.APIToken)
+	if cfg.EmailConfig != nil {
+		add(cfg.EmailConfig.SMTPPass)
+	}
+	secretEnv := make(map[string]bool)
+	for _, name := range cfg.RedactEnv {
+		secretEnv[name] = true
+		add(os.Getenv(name))
+	}
+	for i := range cfg.Projects {
+		project := &cfg.Projects[i]
+		add(project.WebhookSecret)
+		for _, step := range project.Steps {
+			for name, value := range step.Env {
+				if secretEnv[name] {
+					add(value)
+				}
+			}
+		}
+		for _, entry := range project.Branches {
+			for name, value := range entry.Env {
+				if secretEnv[name] {
+					add(value)
+				}
+			}
+		}
+	}
+
+	// Longest first, so a secret containing another is masked as a whole
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+
+	var patterns []*regexp.Regexp
+	for _, expr := range cfg.RedactPatterns {
+		if re, err := regexp.Compile(expr); err == nil {
+			patterns = append(patterns, re)
+		}
+	}
+	return secrets, patterns
+}
+
+// Redact returns s with all secrets and pattern matches replaced by RedactedText.
+// For patterns with a capture group, only the first group is replaced.
+func (r *Redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, RedactedText)
+	}
+	for _, re := range r.patterns {
+		s = redactPattern(re, s)
+	}
+	return s
+}
+
+// redactPattern replaces the matches of re in s (or their first capture group)
+func redactPattern(re *regexp.Regexp, s string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllLiteralString(s, RedactedText)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[2], m[3]
+		if start < 0 {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(RedactedText)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// redactAttrs returns attrs with string values redacted
+func (r *Redactor) redactAttrs(attrs []slog.Attr) []slog.Attr {
+	if r == nil {
+		return attrs
+	}
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		if a.Value.Kind() == slog.KindString {
+			a.Value = slog.StringValue(r.Redact(a.Value.String()))
+		}
+		redacted[i] = a
+	}
+	return redacted
+}
+
+// redactResult masks secrets in the output and errors of a deployment result
+// before it is recorded, served by the API or emailed
+func (r *Redactor) redactResult(result *DeployResult) {
+	if r == nil {
+		return
+	}
+	result.Output = r.Redact(result.Output)
+	result.Error = r.Redact(result.Error)
+	for _, steps := range [][]StepResult{result.Steps, result.Hooks} {
+		for i := range steps {
+			steps[i].Output = r.Redact(steps[i].Output)
+			steps[i].Error = r.Redact(steps[i].Error)
+		}
+	}
+	if result.HealthCheck != nil {
+		result.HealthCheck.Error = r.Redact(result.HealthCheck.Error)
+	}
+}
+
+// redactingWriter buffers output by line and writes each line redacted, so
+// secrets split across writes are still masked. Flush writes a final partial line.
+type redactingWriter struct {
+	redactor *Redactor
+	w        io.Writer
+	buf      []byte
+}
+
+// newRedactingWriter creates a line-buffered redacting writer
+func newRedactingWriter(redactor *Redactor, w io.Writer) *redactingWriter {
+	return &redactingWriter{redactor: redactor, w: w}
+}
+
+// Write implements io.Writer
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	rw.buf = append(rw.buf, p...)
+	for {
+		i := bytes.IndexByte(rw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := rw.redactor.Redact(string(rw.buf[:i+1]))
+		rw.buf = rw.buf[i+1:]
+		if _, err := io.WriteString(rw.w, line); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line
+func (rw *redactingWriter) Flush() error {
+	if len(rw.buf) == 0 {
+		return nil
+	}
+	line := rw.redactor.Redact(string(rw.buf))
+	rw.buf = nil
+	_, err := io.WriteString(rw.w, line)
+	return err
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestRedactorRedact tests masking of configured secrets, secret env vars and patterns
+func TestRedactorRedact(t *testing.T) {
+	t.Setenv("SDEPLOY_TEST_TOKEN", "env-token-value")
+
+	cfg := &Config{
+		APIToken:       "api-token-value",
+		EmailConfig:    &EmailConfig{SMTPPass: "smtp-pass-value"},
+		RedactEnv:      []string{"SDEPLOY_TEST_TOKEN", "DEPLOY_KEY"},
+		RedactPatterns: []string{`ghp_[A-Za-z0-9]+`, `password=(\S+)`},
+		Projects: []ProjectConfig{
+			{
+				Name:          "App",
+				WebhookSecret: "webhook-secret",
+				Steps: []DeployStep{
+					{Name: "build", Env: map[string]string{"DEPLOY_KEY": "step-key-value", "MODE": "production"}},
+				},
+				Branches: []BranchConfig{
+					{Pattern: "feature/*", Env: map[string]string{"DEPLOY_KEY": "branch-key-value", "MODE": "preview"}},
+				},
+			},
+			// Values shorter than minSecretLength are never masked literally
+			{Name: "Short", WebhookSecret: "abc"},
+		},
+	}
+	redactor := NewRedactor(cfg)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"secret=webhook-secret ok", "secret=[REDACTED] ok"},
+		{"Bearer api-token-value", "Bearer [REDACTED]"},
+		{"auth smtp-pass-value", "auth [REDACTED]"},
+		{"token env-token-value used", "token [REDACTED] used"},
+		{"key step-key-value", "key [REDACTED]"},
+		{"key branch-key-value", "key [REDACTED]"},
+		{"mode production", "mode production"},
+		{"mode preview", "mode preview"},
+		{"clone https://ghp_abc123@github.com/x", "clone https://[REDACTED]@github.com/x"},
+		{"login password=hunter2 user=bob", "login password=[REDACTED] user=bob"},
+		{"abc stays", "abc stays"},
+	}
+	for _, tc := range tests {
+		if got := redactor.Redact(tc.input); got != tc.expected {
+			t.Errorf("Redact(%q) = %q, expected %q", tc.input, got, tc.expected)
+		}
+	}
+
+	// A nil redactor leaves text unchanged
+	var none *Redactor
+	if got := none.Redact("webhook-secret"); got != "webhook-secret" {
+		t.Errorf("Expected nil redactor to leave text unchanged, got %q", got)
+	}
+
+	// Update replaces the secrets of the previous config
+	redactor.Update(&Config{Projects: []ProjectConfig{{Name: "App", WebhookSecret: "rotated-secret"}}})
+	if got := redactor.Redact("webhook-secret rotated-secret"); got != "webhook-secret [REDACTED]" {
+		t.Errorf("Expected only the new secret to be masked after Update, got %q", got)
+	}
+}
+
+// TestRedactingWriter tests that secrets split across writes are still masked
+func TestRedactingWriter(t *testing.T) {
+	redactor := NewRedactor(&Config{APIToken: "api-token-value"})
+	var buf bytes.Buffer
+	w := newRedactingWriter(redactor, &buf)
+
+	w.Write([]byte("first line api-to"))
+	w.Write([]byte("ken-value\nsecond "))
+	if buf.String() != "first line [REDACTED]\n" {
+		t.Errorf("Expected only complete lines to be written, got %q", buf.String())
+	}
+	w.Write([]byte("api-token-value"))
+	w.Flush()
+	if buf.String() != "first line [REDACTED]\nsecond [REDACTED]" {
+		t.Errorf("Expected partial line to be written on Flush, got %q", buf.String())
+	}
+}
+
+// TestLoggerRedaction tests that log messages and attributes are redacted in both formats
+func TestLoggerRedaction(t *testing.T) {
+	redactor := NewRedactor(&Config{APIToken: "api-token-value"})
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	logger.SetRedactor(redactor)
+	logger.Infof("App", "Using token api-token-value")
+	if strings.Contains(buf.String(), "api-token-value") || !strings.Contains(buf.String(), "Using token [REDACTED]") {
+		t.Errorf("Expected redacted text log line, got %q", buf.String())
+	}
+
+	buf.Reset()
+	logger.SetFormat(LogFormatJSON)
+	logger.LogAttrs(slog.LevelInfo, "App", "Command output", slog.String("output", "echo api-token-value"))
+	if strings.Contains(buf.String(), "api-token-value") || !strings.Contains(buf.String(), `"output":"echo [REDACTED]"`) {
+		t.Errorf("Expected redacted JSON attribute, got %q", buf.String())
+	}
+}
+
+// TestDeployRedactsOutput tests that secrets printed by a deployment are masked in
+// the result, run log and history
+func TestDeployRedactsOutput(t *testing.T) {
+	t.Setenv("SDEPLOY_TEST_TOKEN", "env-token-value")
+	cfg := &Config{RedactEnv: []string{"SDEPLOY_TEST_TOKEN"}}
+
+	stateDir := t.TempDir()
+	store, err := NewRunLogStore(stateDir)
+	if err != nil {
+		t.Fatalf("NewRunLogStore failed: %v", err)
+	}
+	history, err := NewHistoryStore(stateDir)
+	if err != nil {
+		t.Fatalf("NewHistoryStore failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	redactor := NewRedactor(cfg)
+	logger.SetRedactor(redactor)
+	deployer := NewDeployer(logger)
+	deployer.SetRedactor(redactor)
+	deployer.SetRunLogStore(store)
+	deployer.SetHistoryStore(history)
+
+	project := &ProjectConfig{
+		Name:           "App",
+		WebhookPath:    "/hooks/app",
+		ExecuteCommand: `echo "token=$SDEPLOY_TEST_TOKEN"; echo "bad $SDEPLOY_TEST_TOKEN" >&2; exit 1`,
+	}
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+
+	content, err := os.ReadFile(result.LogFile)
+	if err != nil {
+		t.Fatalf("Failed to read run log: %v", err)
+	}
+	stored, err := history.Get(result.RunID)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	email := composeDeploymentEmail(project, &result, "INTERNAL")
+
+	for name, text := range map[string]string{
+		"result output": result.Output,
+		"run log":       string(content),
+		"history":       stored.Output + stored.Error,
+		"email":         email.Body,
+		"daemon log":    buf.String(),
+	} {
+		if strings.Contains(text, "env-token-value") {
+			t.Errorf("Expected secret to be masked in %s, got:\n%s", name, text)
+		}
+	}
+	if !strings.Contains(result.Output, "token=[REDACTED]") || !strings.Contains(string(content), "token=[REDACTED]\n") {
+		t.Errorf("Expected masked output, got result %q and run log:\n%s", result.Output, content)
+	}
+}
+
+// TestDeployRedactsBranchEnv tests that a secret from a branches entry env is
+// masked in the output of the branch deployment
+func TestDeployRedactsBranchEnv(t *testing.T) {
+	project := ProjectConfig{
+		Name:           "App",
+		WebhookPath:    "/hooks/app",
+		GitBranch:      "main",
+		ExecuteCommand: `echo "key=$DEPLOY_KEY"`,
+		Branches: []BranchConfig{
+			{Pattern: "feature/*", Env: map[string]string{"DEPLOY_KEY": "branch-key-value"}},
+		},
+	}
+	cfg := &Config{RedactEnv: []string{"DEPLOY_KEY"}, Projects: []ProjectConfig{project}}
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	redactor := NewRedactor(cfg)
+	logger.SetRedactor(redactor)
+	deployer := NewDeployer(logger)
+	deployer.SetRedactor(redactor)
+
+	result := deployer.Deploy(context.Background(), cfg.Projects[0].forBranch("feature/login"), "WEBHOOK")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+	}
+	if !strings.Contains(result.Output, "key=[REDACTED]") || strings.Contains(buf.String(), "branch-key-value") {
+		t.Errorf("Expected branch env secret to be masked, got output %q and log:\n%s", result.Output, buf.String())
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Layout of local_path when release_mode is enabled:
+//
+//	<local_path>/repo                        git working copy used to fetch sources
+//	<local_path>/releases/<timestamp>-<sha>  one directory per deployment
+//	<local_path>/current                     symlink to the live release
+const (
+	releaseRepoDir  = "repo"
+	releasesDirName = "releases"
+	currentLinkName = "current"
+)
+
+// releaseLocksDir is the directory under state_dir holding release lock files
+const releaseLocksDir = "locks"
+
+// errReleasesBusy is returned when another process holds a release lock
+var errReleasesBusy = errors.New("a deployment of this project is in progress")
+
+// releaseRepoPath returns the git working copy used by release_mode
+func releaseRepoPath(project *ProjectConfig) string {
+	return filepath.Join(project.LocalPath, releaseRepoDir)
+}
+
+// releasesPath returns the directory holding all releases of a project
+func releasesPath(project *ProjectConfig) string {
+	return filepath.Join(project.LocalPath, releasesDirName)
+}
+
+// currentLinkPath returns the path of the "current" release symlink
+func currentLinkPath(project *ProjectConfig) string {
+	return filepath.Join(project.LocalPath, currentLinkName)
+}
+
+// releaseName builds a sortable release directory name (e.g., 20240115-103000-1a2b3c4)
+func releaseName(t time.Time, commit string) string {
+	name := t.Format("20060102-150405")
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if commit != "" {
+		name += "-" + commit
+	}
+	return name
+}
+
+// createRelease exports the checked-out commit of the release repo into a new
+// release directory and returns its path
+func createRelease(ctx context.Context, project *ProjectConfig, commit string) (string, error) {
+	if err := os.MkdirAll(releasesPath(project), 0755); err != nil {
+		return "", fmt.Errorf("failed to create releases directory: %w", err)
+	}
+
+	// Two deployments of the same commit within a second get distinct directories
+	base := filepath.Join(releasesPath(project), releaseName(time.Now(), commit))
+	dir := base
+	for i := 1; ; i++ {
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("failed to create release directory: %w", err)
+		}
+		dir = fmt.Sprintf("%s.%d", base, i)
+	}
+
+	if err := exportGitTree(ctx, releaseRepoPath(project), dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// exportGitTree writes the files of HEAD in repoPath to destDir (without .git)
+func exportGitTree(ctx context.Context, repoPath, destDir string) error {
+	cmd := buildCommand(ctx, "git archive --format=tar HEAD")
+	setProcessGroup(cmd)
+	cmd.Dir = repoPath
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("git archive failed: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git archive failed: %v", err)
+	}
+
+	extractErr := extractTar(stdout, destDir)
+	// Drain the pipe so git can exit if extraction stopped early
+	_, _ = io.Copy(io.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git archive failed: %v: %s", err, stderr.String())
+	}
+	if extractErr != nil {
+		return fmt.Errorf("failed to extract release: %v", extractErr)
+	}
+	return nil
+}
+
+// extractTar extracts directories, regular files and symlinks from a tar
+// stream into destDir. Entries never leave destDir: symlinks must point inside
+// it and no entry is written through a symlink.
+func extractTar(r io.Reader, destDir string) error {
+	destDir = filepath.Clean(destDir)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(destDir, header.Name)
+		if !isWithinDir(destDir, target) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		if err := checkNoSymlinks(destDir, target); err != nil {
+			return fmt.Errorf("invalid path in archive: %s: %v", header.Name, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(file, tr); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(header.Linkname) || !isWithinDir(destDir, filepath.Join(filepath.Dir(target), header.Linkname)) {
+				return fmt.Errorf("invalid symlink in archive: %s -> %s points outside the release", header.Name, header.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// releaseLockPath returns the lock file guarding the releases of a project's
+// local_path, shared by the daemon and sdeploy rollback
+func releaseLockPath(stateDir string, project *ProjectConfig) string {
+	return filepath.Join(stateDir, releaseLocksDir, slugify(project.LocalPath)+".lock")
+}
+
+// lockReleases takes the release lock of a project's local_path, waiting for
+// it unless wait is false (then failing with errReleasesBusy). The returned
+// function releases the lock.
+func lockReleases(stateDir string, project *ProjectConfig, wait bool) (func(), error) {
+	path := releaseLockPath(stateDir, project)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open release lock: %w", err)
+	}
+	if err := flockFile(file, wait); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errReleasesBusy
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return func() { file.Close() }, nil
+}
+
+// isWithinDir reports whether the clean path is dir or lies below it
+func isWithinDir(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// checkNoSymlinks fails if target or one of its parent directories below
+// destDir is a symlink, so that writing target cannot follow a link
+func checkNoSymlinks(destDir, target string) error {
+	rel, err := filepath.Rel(destDir, target)
+	if err != nil || rel == "." {
+		return err
+	}
+	path := destDir
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink", path)
+		}
+	}
+	return nil
+}
+
+// activateRelease atomically points the "current" symlink at releaseDir
+func activateRelease(project *ProjectConfig, releaseDir string) error {
+	link := currentLinkPath(project)
+	tmpLink := link + ".tmp"
+
+	// Relative target keeps local_path relocatable
+	target := filepath.Join(releasesDirName, filepath.Base(releaseDir))
+
+	os.Remove(tmpLink)
+	if err := os.Symlink(target, tmpLink); err != nil {
+		return fmt.Errorf("failed to create release symlink: %w", err)
+	}
+	// rename(2) replaces the old symlink in a single step
+	if err := os.Rename(tmpLink, link); err != nil {
+		os.Remove(tmpLink)
+		return fmt.Errorf("failed to switch release symlink: %w", err)
+	}
+	return nil
+}
+
+// currentRelease returns the name of the release "current" points to, or "" if none
+func currentRelease(project *ProjectConfig) string {
+	target, err := os.Readlink(currentLinkPath(project))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// listReleases returns release names of a project, oldest first
+func listReleases(project *ProjectConfig) ([]string, error) {
+	entries, err := os.ReadDir(releasesPath(project))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read releases directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// pruneReleases removes the oldest releases beyond keep, never removing the
+// current release. Returns the names of removed releases.
+func pruneReleases(project *ProjectConfig, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	names, err := listReleases(project)
+	if err != nil {
+		return nil, err
+	}
+
+	current := currentRelease(project)
+	var removed []string
+	for i := 0; len(names)-i > keep; i++ {
+		if names[i] == current {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(releasesPath(project), names[i])); err != nil {
+			return removed, fmt.Errorf("failed to remove release %s: %w", names[i], err)
+		}
+		removed = append(removed, names[i])
+	}
+	return removed, nil
+}
+
+// rollbackRelease repoints "current" to the release before the current one.
+// Only successful releases are kept on disk, so no rebuild is needed. Fails
+// with errReleasesBusy while the daemon is deploying the project (the release
+// lock under stateDir is held).
+func rollbackRelease(stateDir string, project *ProjectConfig) (from, to string, err error) {
+	if !project.ReleaseMode {
+		return "", "", fmt.Errorf("release_mode is not enabled for project %s", project.Name)
+	}
+
+	if stateDir != "" {
+		unlock, err := lockReleases(stateDir, project, false)
+		if err != nil {
+			return "", "", err
+		}
+		defer unlock()
+	}
+
+	names, err := listReleases(project)
+	if err != nil {
+		return "", "", err
+	}
+
+	from = currentRelease(project)
+	idx := sort.SearchStrings(names, from)
+	if from == "" || idx >= len(names) || names[idx] != from {
+		return "", "", fmt.Errorf("no current release found in %s", releasesPath(project))
+	}
+	if idx == 0 {
+		return "", "", fmt.Errorf("no release older than %s to roll back to", from)
+	}
+
+	to = names[idx-1]
+	if err := activateRelease(project, filepath.Join(releasesPath(project), to)); err != nil {
+		return "", "", err
+	}
+	return from, to, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newReleaseProject creates a release_mode project deploying from a local origin
+func newReleaseProject(t *testing.T, origin string) *ProjectConfig {
+	t.Helper()
+	return &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		GitRepo:        origin,
+		GitBranch:      "main",
+		GitUpdate:      true,
+		GitStrategy:    GitStrategyFetchReset,
+		ReleaseMode:    true,
+		KeepReleases:   2,
+		LocalPath:      filepath.Join(t.TempDir(), "app"),
+		ExecuteCommand: "cat VERSION > build.txt",
+	}
+}
+
+// readCurrentFile reads a file through the project's "current" symlink
+func readCurrentFile(t *testing.T, project *ProjectConfig, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(currentLinkPath(project), name))
+	if err != nil {
+		t.Fatalf("Failed to read %s through current symlink: %v", name, err)
+	}
+	return string(data)
+}
+
+// TestDeployReleaseMode tests building in release directories and switching the current symlink
+func TestDeployReleaseMode(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	first := pushTestCommit(t, work, "v1")
+
+	deployer := NewDeployer(nil)
+	project := newReleaseProject(t, origin)
+
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+	}
+	if !strings.HasSuffix(filepath.Base(result.ReleaseDir), "-"+first[:7]) {
+		t.Errorf("Expected release directory named after commit %s, got %s", first[:7], result.ReleaseDir)
+	}
+	if got := readCurrentFile(t, project, "build.txt"); got != "v1" {
+		t.Errorf("Expected current build output v1, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(result.ReleaseDir, ".git")); !os.IsNotExist(err) {
+		t.Error("Expected release directory to contain no .git directory")
+	}
+
+	// A failed build leaves the live release untouched and is removed
+	pushTestCommit(t, work, "v2")
+	project.ExecuteCommand = "exit 1"
+	failed := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if failed.Success {
+		t.Fatal("Expected failed build")
+	}
+	if _, err := os.Stat(failed.ReleaseDir); !os.IsNotExist(err) {
+		t.Errorf("Expected failed release %s to be removed", failed.ReleaseDir)
+	}
+	if got := readCurrentFile(t, project, "build.txt"); got != "v1" {
+		t.Errorf("Expected current to stay on v1 after failed build, got %q", got)
+	}
+
+	// Successful builds beyond keep_releases prune the oldest release
+	project.ExecuteCommand = "cat VERSION > build.txt"
+	for _, version := range []string{"v3", "v4"} {
+		pushTestCommit(t, work, version)
+		// Release names have one-second resolution
+		time.Sleep(1100 * time.Millisecond)
+		result = deployer.Deploy(context.Background(), project, "INTERNAL")
+		if !result.Success {
+			t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+		}
+	}
+	if got := readCurrentFile(t, project, "build.txt"); got != "v4" {
+		t.Errorf("Expected current build output v4, got %q", got)
+	}
+	releases, _ := listReleases(project)
+	if len(releases) != 2 {
+		t.Errorf("Expected 2 kept releases, got %v", releases)
+	}
+}
+
+// TestRollbackRelease tests repointing current to the previous release without rebuilding
+func TestRollbackRelease(t *testing.T) {
+	project := &ProjectConfig{Name: "TestProject", ReleaseMode: true, LocalPath: t.TempDir()}
+
+	for _, name := range []string{"20240115-100000-aaaaaaa", "20240115-110000-bbbbbbb"} {
+		dir := filepath.Join(releasesPath(project), name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create release: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "build.txt"), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	// No current release yet
+	if _, _, err := rollbackRelease("", project); err == nil {
+		t.Error("Expected error without a current release")
+	}
+
+	if err := activateRelease(project, filepath.Join(releasesPath(project), "20240115-110000-bbbbbbb")); err != nil {
+		t.Fatalf("activateRelease failed: %v", err)
+	}
+
+	from, to, err := rollbackRelease("", project)
+	if err != nil {
+		t.Fatalf("rollbackRelease failed: %v", err)
+	}
+	if from != "20240115-110000-bbbbbbb" || to != "20240115-100000-aaaaaaa" {
+		t.Errorf("Expected rollback bbbbbbb -> aaaaaaa, got %s -> %s", from, to)
+	}
+	if got := readCurrentFile(t, project, "build.txt"); got != "20240115-100000-aaaaaaa" {
+		t.Errorf("Expected current to point at the previous release, got %q", got)
+	}
+
+	// Nothing older to roll back to
+	if _, _, err := rollbackRelease("", project); err == nil {
+		t.Error("Expected error when no older release exists")
+	}
+
+	project.ReleaseMode = false
+	if _, _, err := rollbackRelease("", project); err == nil {
+		t.Error("Expected error when release_mode is disabled")
+	}
+}
+
+// TestPruneReleasesKeepsCurrent tests that pruning never removes the live release
+func TestPruneReleasesKeepsCurrent(t *testing.T) {
+	project := &ProjectConfig{Name: "TestProject", ReleaseMode: true, LocalPath: t.TempDir()}
+	names := []string{"20240115-100000-a", "20240115-110000-b", "20240115-120000-c", "20240115-130000-d"}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(releasesPath(project), name), 0755); err != nil {
+			t.Fatalf("Failed to create release: %v", err)
+		}
+	}
+	// After a rollback, current points at an old release
+	if err := activateRelease(project, filepath.Join(releasesPath(project), names[0])); err != nil {
+		t.Fatalf("activateRelease failed: %v", err)
+	}
+
+	removed, err := pruneReleases(project, 2)
+	if err != nil {
+		t.Fatalf("pruneReleases failed: %v", err)
+	}
+	if strings.Join(removed, ",") != names[1] {
+		t.Errorf("Expected only %s to be removed, got %v", names[1], removed)
+	}
+	kept, _ := listReleases(project)
+	if strings.Join(kept, ",") != strings.Join([]string{names[0], names[2], names[3]}, ",") {
+		t.Errorf("Unexpected kept releases: %v", kept)
+	}
+}
+
+// TestExtractTarRejectsTraversal tests that archive entries cannot escape the release directory
+func TestExtractTarRejectsTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	content := []byte("x")
+	if err := tw.WriteHeader(&tar.Header{Name: "../escape.txt", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatalf("Failed to write tar header: %v", err)
+	}
+	tw.Write(content)
+	tw.Close()
+
+	dir := t.TempDir()
+	if err := extractTar(&buf, filepath.Join(dir, "release")); err == nil {
+		t.Error("Expected error for path traversal entry")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+		t.Error("Expected no file written outside the release directory")
+	}
+}
+
+// TestExtractTarRejectsSymlinkEscape tests that symlinks cannot point outside
+// the release directory and that no entry is written through a symlink
+func TestExtractTarRejectsSymlinkEscape(t *testing.T) {
+	type entry struct {
+		name, link string
+	}
+	tests := []struct {
+		name    string
+		entries []entry
+		valid   bool
+	}{
+		{"relative link inside", []entry{{name: "docs/index.md"}, {name: "README.md", link: "docs/index.md"}}, true},
+		{"absolute link", []entry{{name: "etc", link: "/etc"}}, false},
+		{"relative link outside", []entry{{name: "docs/up", link: "../../outside"}}, false},
+		{"file through link", []entry{{name: "out", link: ".."}, {name: "out/escape.txt"}}, false},
+		{"file through link inside", []entry{{name: "public/", link: ""}, {name: "web", link: "public"}, {name: "web/index.html"}}, false},
+		{"file replacing link", []entry{{name: "docs/index.md"}, {name: "link", link: "docs/index.md"}, {name: "link"}}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for _, e := range tc.entries {
+				header := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: 1}
+				switch {
+				case e.link != "":
+					header = &tar.Header{Name: e.name, Linkname: e.link, Mode: 0777, Typeflag: tar.TypeSymlink}
+				case strings.HasSuffix(e.name, "/"):
+					header = &tar.Header{Name: e.name, Mode: 0755, Typeflag: tar.TypeDir}
+				}
+				if err := tw.WriteHeader(header); err != nil {
+					t.Fatalf("Failed to write tar header: %v", err)
+				}
+				if header.Typeflag == tar.TypeReg {
+					tw.Write([]byte("x"))
+				}
+			}
+			tw.Close()
+
+			dir := t.TempDir()
+			err := extractTar(&buf, filepath.Join(dir, "release"))
+			if tc.valid && err != nil {
+				t.Errorf("Expected archive to extract, got: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("Expected an invalid archive error")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+				t.Error("Expected no file written outside the release directory")
+			}
+		})
+	}
+}
+
+// TestDeployReleaseLock tests that sdeploy rollback is refused while a
+// release_mode deployment runs, and allowed once it has finished
+func TestDeployReleaseLock(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	pushTestCommit(t, work, "v1")
+
+	stateDir := t.TempDir()
+	deployer := NewDeployer(nil)
+	deployer.SetStateDir(stateDir)
+	project := newReleaseProject(t, origin)
+	if result := deployer.Deploy(context.Background(), project, "INTERNAL"); !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+
+	pushTestCommit(t, work, "v2")
+	project.ExecuteCommand = "sleep 0.5"
+	done := make(chan DeployResult, 1)
+	go func() { done <- deployer.Deploy(context.Background(), project, "INTERNAL") }()
+	for i := 0; i < 100 && !deployer.IsDeploying(project.WebhookPath); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, _, err := rollbackRelease(stateDir, project); !errors.Is(err, errReleasesBusy) {
+		t.Errorf("Expected rollback to be refused during the deployment, got %v", err)
+	}
+	if result := <-done; !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+	if _, _, err := rollbackRelease(stateDir, project); errors.Is(err, errReleasesBusy) {
+		t.Errorf("Expected the release lock to be released after the deployment, got %v", err)
+	}
+}
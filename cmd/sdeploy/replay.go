@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers of signed internal triggers, an alternative to ?secret= that keeps the
+// secret off the wire and cannot be replayed:
+//
+//	X-SDeploy-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>\n<nonce>\n<body>">
+const (
+	TriggerTimestampHeader = "X-SDeploy-Timestamp" // Unix time in seconds
+	TriggerNonceHeader     = "X-SDeploy-Nonce"     // Unique per request
+	TriggerSignatureHeader = "X-SDeploy-Signature"
+)
+
+// maxDeliveryIDLength bounds delivery IDs and nonces remembered per request
+const maxDeliveryIDLength = 128
+
+// DeliveryStore remembers the delivery IDs of authenticated webhooks so that
+// replayed requests can be rejected. IDs are kept per project, newest last,
+// and persisted as JSON under <state_dir>/deliveries/<project-key>.json.
+// A nil *DeliveryStore is valid and treats every delivery as new.
+type DeliveryStore struct {
+	mu       sync.Mutex
+	dir      string
+	projects map[string]*deliverySet
+}
+
+// deliverySet is the bounded seen-set of one project
+type deliverySet struct {
+	ids  []string // oldest first
+	seen map[string]bool
+}
+
+// NewDeliveryStore creates a delivery store rooted at the given state directory
+func NewDeliveryStore(stateDir string) (*DeliveryStore, error) {
+	if stateDir == "" {
+		return nil, fmt.Errorf("state_dir is not configured")
+	}
+	dir := filepath.Join(stateDir, "deliveries")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create deliveries directory: %w", err)
+	}
+	return &DeliveryStore{dir: dir, projects: make(map[string]*deliverySet)}, nil
+}
+
+// Dir returns the deliveries directory
+func (s *DeliveryStore) Dir() string {
+	return s.dir
+}
+
+// Check records the delivery IDs of one request for a project and reports
+// whether any of them was already seen. Only the newest keep IDs are
+// remembered. Empty IDs are ignored. The returned error reports a failure to
+// persist the set; the IDs are still remembered in memory.
+func (s *DeliveryStore) Check(key string, keep int, ids ...string) (bool, error) {
+	ids = slices.DeleteFunc(slices.Clone(ids), func(id string) bool { return id == "" })
+	if s == nil || len(ids) == 0 {
+		return false, nil
+	}
+	if keep <= 0 {
+		keep = Defaults.DeliveryIDKeep
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := s.projects[key]
+	if set == nil {
+		set = s.load(key)
+		s.projects[key] = set
+	}
+	for _, id := range ids {
+		if set.seen[id] {
+			return true, nil
+		}
+	}
+
+	for _, id := range ids {
+		set.ids = append(set.ids, id)
+		set.seen[id] = true
+	}
+	for len(set.ids) > keep {
+		delete(set.seen, set.ids[0])
+		set.ids = set.ids[1:]
+	}
+	return false, s.save(key, set)
+}
+
+// payloadDigest identifies a webhook body in the seen-set. Forge delivery
+// headers are not covered by the signature, so a captured body resent with a
+// new delivery ID is recognised by its digest.
+func payloadDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// load reads a project's persisted delivery IDs; a missing or unreadable file
+// starts an empty set (caller must hold mu)
+func (s *DeliveryStore) load(key string) *deliverySet {
+	set := &deliverySet{seen: make(map[string]bool)}
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return set
+	}
+	if err := json.Unmarshal(data, &set.ids); err != nil {
+		set.ids = nil
+	}
+	for _, id := range set.ids {
+		set.seen[id] = true
+	}
+	return set
+}
+
+// save persists a project's delivery IDs (caller must hold mu)
+func (s *DeliveryStore) save(key string, set *deliverySet) error {
+	data, err := json.Marshal(set.ids)
+	if err != nil {
+		return fmt.Errorf("failed to encode delivery IDs: %w", err)
+	}
+	// Write to a temp file first so a crash never leaves a partial set
+	path := s.path(key)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write delivery IDs: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write delivery IDs: %w", err)
+	}
+	return nil
+}
+
+// path returns the file holding a project's delivery IDs
+func (s *DeliveryStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+// validateSignedTrigger checks a signed internal trigger: the HMAC over
+// timestamp, nonce and body, and that the timestamp is within maxSkew of now.
+// Replays within the skew window are caught by remembering the nonce.
+func validateSignedTrigger(r *http.Request, body []byte, secret string, maxSkew time.Duration, now time.Time) error {
+	timestamp := r.Header.Get(TriggerTimestampHeader)
+	nonce := r.Header.Get(TriggerNonceHeader)
+	if timestamp == "" || nonce == "" {
+		return fmt.Errorf("missing %s or %s header", TriggerTimestampHeader, TriggerNonceHeader)
+	}
+	if len(nonce) > maxDeliveryIDLength {
+		return fmt.Errorf("%s header is longer than %d characters", TriggerNonceHeader, maxDeliveryIDLength)
+	}
+
+	signed := make([]byte, 0, len(timestamp)+len(nonce)+len(body)+2)
+	signed = append(signed, timestamp+"\n"+nonce+"\n"...)
+	signed = append(signed, body...)
+	if !validateHMAC(signed, r.Header.Get(TriggerSignatureHeader), secret) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header", TriggerTimestampHeader)
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > maxSkew || skew < -maxSkew {
+		return fmt.Errorf("timestamp is %v away from server time (max %v)", skew.Round(time.Second), maxSkew)
+	}
+	return nil
+}
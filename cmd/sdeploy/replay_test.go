@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signTrigger sets the signed trigger headers on a request for tests
+func signTrigger(req *http.Request, body, secret, nonce string, ts time.Time) {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	req.Header.Set(TriggerTimestampHeader, timestamp)
+	req.Header.Set(TriggerNonceHeader, nonce)
+	req.Header.Set(TriggerSignatureHeader, "sha256="+hexHMAC(timestamp+"\n"+nonce+"\n"+body, secret))
+}
+
+// TestDeliveryStoreCheck tests the bounded seen-set and its persistence
+func TestDeliveryStoreCheck(t *testing.T) {
+	stateDir := t.TempDir()
+	store, err := NewDeliveryStore(stateDir)
+	if err != nil {
+		t.Fatalf("NewDeliveryStore failed: %v", err)
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		if replayed, err := store.Check("app", 2, id); replayed || err != nil {
+			t.Errorf("Expected %s to be new, got replayed=%t err=%v", id, replayed, err)
+		}
+	}
+	if replayed, _ := store.Check("app", 2, "c"); !replayed {
+		t.Error("Expected c to be a replay")
+	}
+	if replayed, _ := store.Check("other", 2, "c"); replayed {
+		t.Error("Expected delivery IDs to be tracked per project")
+	}
+	if replayed, _ := store.Check("app", 2, ""); replayed {
+		t.Error("Expected an empty ID never to be a replay")
+	}
+	// A request is a replay if any of its IDs was seen
+	if replayed, _ := store.Check("app", 2, "d", "c"); !replayed {
+		t.Error("Expected d with c to be a replay")
+	}
+
+	// A restarted daemon remembers the newest IDs only
+	store, err = NewDeliveryStore(stateDir)
+	if err != nil {
+		t.Fatalf("NewDeliveryStore failed: %v", err)
+	}
+	if replayed, _ := store.Check("app", 2, "b"); !replayed {
+		t.Error("Expected b to be remembered after reload")
+	}
+	if replayed, _ := store.Check("app", 2, "a"); replayed {
+		t.Error("Expected a to be forgotten beyond keep")
+	}
+
+	var nilStore *DeliveryStore
+	if replayed, err := nilStore.Check("app", 2, "a"); replayed || err != nil {
+		t.Error("Expected nil store to treat every delivery as new")
+	}
+}
+
+// TestWebhookRejectsReplayedDelivery tests that a resent forge delivery is rejected with 409
+func TestWebhookRejectsReplayedDelivery(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+	store, err := NewDeliveryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDeliveryStore failed: %v", err)
+	}
+	metrics := NewMetrics()
+	handler := NewWebhookHandler(cfg, nil)
+	handler.SetDeliveryStore(store)
+	handler.SetMetrics(metrics)
+
+	payload := `{"ref":"refs/heads/main"}`
+	send := func(payload, delivery, signature string) int {
+		req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hexHMAC(payload, signature))
+		req.Header.Set("X-GitHub-Delivery", delivery)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := send(payload, "delivery-1", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a bad signature, got %d", code)
+	}
+	// A rejected request did not mark the ID as seen
+	if code := send(payload, "delivery-1", "mysecret"); code != http.StatusAccepted {
+		t.Errorf("Expected 202 for the first delivery, got %d", code)
+	}
+	if code := send(payload, "delivery-1", "mysecret"); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a replayed delivery, got %d", code)
+	}
+	// The delivery header is not signed: the same body under a new ID is a replay too
+	if code := send(payload, "delivery-2", "mysecret"); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a replayed body with a new delivery ID, got %d", code)
+	}
+	if code := send(`{"ref":"refs/heads/main","after":"abc"}`, "delivery-3", "mysecret"); code != http.StatusAccepted {
+		t.Errorf("Expected 202 for a new delivery, got %d", code)
+	}
+	if code := send(`{"ref":"refs/heads/main","after":"def"}`, strings.Repeat("x", maxDeliveryIDLength+1), "mysecret"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an overlong delivery ID, got %d", code)
+	}
+
+	var buf strings.Builder
+	metrics.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `sdeploy_webhooks_total{project="TestProject",outcome="replayed"} 2`) {
+		t.Errorf("Expected replayed webhook metric, got:\n%s", buf.String())
+	}
+}
+
+// TestWebhookSignedTrigger tests signed internal triggers: signature, skew window and nonce replay
+func TestWebhookSignedTrigger(t *testing.T) {
+	cfg := &Config{
+		TriggerMaxSkew: 60,
+		Projects: []ProjectConfig{
+			{
+				Name:                 "TestProject",
+				WebhookPath:          "/hooks/test",
+				WebhookSecret:        "mysecret",
+				GitBranch:            "main",
+				ExecuteCommand:       "echo test",
+				RequireSignedTrigger: true,
+			},
+		},
+	}
+	store, err := NewDeliveryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDeliveryStore failed: %v", err)
+	}
+	handler := NewWebhookHandler(cfg, nil)
+	handler.SetDeliveryStore(store)
+
+	payload := `{"ref":"refs/heads/main"}`
+	now := time.Now()
+	tests := []struct {
+		name   string
+		secret string
+		nonce  string
+		ts     time.Time
+		status int
+	}{
+		{"valid", "mysecret", "n1", now, http.StatusAccepted},
+		{"replayed nonce", "mysecret", "n1", now, http.StatusConflict},
+		{"wrong secret", "wrong", "n2", now, http.StatusUnauthorized},
+		{"expired timestamp", "mysecret", "n3", now.Add(-2 * time.Minute), http.StatusUnauthorized},
+		{"future timestamp", "mysecret", "n4", now.Add(2 * time.Minute), http.StatusUnauthorized},
+		{"within skew", "mysecret", "n5", now.Add(-30 * time.Second), http.StatusAccepted},
+		{"missing nonce", "mysecret", "", now, http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+			signTrigger(req, payload, tc.secret, tc.nonce, tc.ts)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, rr.Code)
+			}
+		})
+	}
+
+	// A tampered body invalidates the signature
+	req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(`{"ref":"refs/heads/evil"}`))
+	signTrigger(req, payload, "mysecret", "n6", now)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a tampered body, got %d", rr.Code)
+	}
+
+	// require_signed_trigger rejects the plain ?secret= trigger
+	req = httptest.NewRequest("POST", "/hooks/test?secret=mysecret", strings.NewReader(payload))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for ?secret= with require_signed_trigger, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunLogStore writes the full output of each deployment run to its own file
+// Layout: <state_dir>/logs/<project-key>/<run-id>.log
+type RunLogStore struct {
+	dir string
+}
+
+// NewRunLogStore creates a run log store rooted at the given state directory
+func NewRunLogStore(stateDir string) (*RunLogStore, error) {
+	if stateDir == "" {
+		return nil, fmt.Errorf("state_dir is not configured")
+	}
+	dir := filepath.Join(stateDir, "logs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run log directory: %w", err)
+	}
+	return &RunLogStore{dir: dir}, nil
+}
+
+// Dir returns the run log directory
+func (s *RunLogStore) Dir() string {
+	return s.dir
+}
+
+// Path returns the log file path of a run
+func (s *RunLogStore) Path(key, runID string) string {
+	return filepath.Join(s.dir, key, runID+".log")
+}
+
+// Create creates the log file of a run
+func (s *RunLogStore) Create(key, runID string) (*os.File, error) {
+	if !isValidRunID(runID) {
+		return nil, fmt.Errorf("invalid run ID: %q", runID)
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, key), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create project log directory: %w", err)
+	}
+	file, err := os.OpenFile(s.Path(key, runID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run log: %w", err)
+	}
+	return file, nil
+}
+
+// Prune removes a project's oldest run logs beyond keep and those older than
+// maxAgeDays (0 disables either limit)
+func (s *RunLogStore) Prune(key string, keep, maxAgeDays int, now time.Time) error {
+	projectDir := filepath.Join(s.dir, key)
+	entries, err := os.ReadDir(projectDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read run log directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			names = append(names, entry.Name())
+		}
+	}
+	// Run IDs start with a timestamp, so names sort oldest first
+	sort.Strings(names)
+
+	excess := 0
+	if keep > 0 && len(names) > keep {
+		excess = len(names) - keep
+	}
+	cutoff := now.AddDate(0, 0, -maxAgeDays)
+
+	for i, name := range names {
+		expired := false
+		if maxAgeDays > 0 {
+			if info, err := os.Stat(filepath.Join(projectDir, name)); err == nil {
+				expired = info.ModTime().Before(cutoff)
+			}
+		}
+		if i < excess || expired {
+			if err := os.Remove(filepath.Join(projectDir, name)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to prune run log %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// runOutputKey is the context key of the writer receiving a run's full output
+type runOutputKey struct{}
+
+// syncWriter serializes writes from concurrent stdout/stderr copiers
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Write implements io.Writer
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// withRunOutput returns a context whose git and command output is copied to w
+func withRunOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, runOutputKey{}, &syncWriter{w: w})
+}
+
+// runOutput returns the writer receiving the run's full output (io.Discard if none)
+func runOutput(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(runOutputKey{}).(io.Writer); ok {
+		return w
+	}
+	return io.Discard
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDeployRunLog tests that a run's full output is written to its own log file
+func TestDeployRunLog(t *testing.T) {
+	stateDir := t.TempDir()
+	store, err := NewRunLogStore(stateDir)
+	if err != nil {
+		t.Fatalf("NewRunLogStore failed: %v", err)
+	}
+	history, err := NewHistoryStore(stateDir)
+	if err != nil {
+		t.Fatalf("NewHistoryStore failed: %v", err)
+	}
+
+	deployer := NewDeployer(nil)
+	deployer.SetRunLogStore(store)
+	deployer.SetHistoryStore(history)
+
+	project := &ProjectConfig{
+		Name:           "My App",
+		WebhookPath:    "/hooks/app",
+		ExecuteCommand: "echo to-stdout; echo to-stderr >&2; exit 3",
+		RunLogKeep:     5,
+	}
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+
+	expectedPath := filepath.Join(stateDir, "logs", "my-app", result.RunID+".log")
+	if result.LogFile != expectedPath {
+		t.Fatalf("Expected log file %s, got %s", expectedPath, result.LogFile)
+	}
+	content, err := os.ReadFile(result.LogFile)
+	if err != nil {
+		t.Fatalf("Failed to read run log: %v", err)
+	}
+	for _, want := range []string{
+		"# Run " + result.RunID + " of My App (trigger: INTERNAL",
+		"$ echo to-stdout; echo to-stderr >&2; exit 3",
+		"to-stdout\n",
+		"to-stderr\n",
+		"failed in",
+		"(exit code 3)",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Expected run log to contain %q, got:\n%s", want, content)
+		}
+	}
+
+	// The log file path is kept in history (and thus the API) and in emails
+	stored, err := history.Get(result.RunID)
+	if err != nil || stored.LogFile != expectedPath {
+		t.Errorf("Expected history to record log file, got %+v (err: %v)", stored, err)
+	}
+	email := composeDeploymentEmail(project, &result, "INTERNAL")
+	if !strings.Contains(email.Body, "Log File: "+expectedPath) {
+		t.Error("Expected email body to contain the log file path")
+	}
+}
+
+// TestDeployRunLogGitOutput tests that git commands and their output are written to the run log
+func TestDeployRunLogGitOutput(t *testing.T) {
+	origin, work := newTestGitOrigin(t)
+	pushTestCommit(t, work, "v1")
+
+	store, err := NewRunLogStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewRunLogStore failed: %v", err)
+	}
+	deployer := NewDeployer(nil)
+	deployer.SetRunLogStore(store)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		GitRepo:        origin,
+		GitBranch:      "main",
+		GitUpdate:      true,
+		LocalPath:      filepath.Join(t.TempDir(), "app"),
+		ExecuteCommand: "cat VERSION",
+	}
+	deployer.Deploy(context.Background(), project, "INTERNAL")
+	result := deployer.Deploy(context.Background(), project, "INTERNAL")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+
+	content, err := os.ReadFile(result.LogFile)
+	if err != nil {
+		t.Fatalf("Failed to read run log: %v", err)
+	}
+	if !strings.Contains(string(content), "$ git pull\n") || !strings.Contains(string(content), "$ cat VERSION") {
+		t.Errorf("Expected git and deploy commands in run log, got:\n%s", content)
+	}
+}
+
+// TestRunLogStorePrune tests pruning run logs by count and by age
+func TestRunLogStorePrune(t *testing.T) {
+	store, err := NewRunLogStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewRunLogStore failed: %v", err)
+	}
+
+	now := time.Now()
+	ids := []string{"20240101-100000-aaaa", "20240102-100000-bbbb", "20240103-100000-cccc", "20240104-100000-dddd"}
+	for i, id := range ids {
+		file, err := store.Create("app", id)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		file.Close()
+		// Oldest run is 40 days old, the others are recent
+		age := time.Duration(len(ids)-i) * time.Hour
+		if i == 0 {
+			age = 40 * 24 * time.Hour
+		}
+		os.Chtimes(store.Path("app", id), now.Add(-age), now.Add(-age))
+	}
+
+	if err := store.Prune("app", 0, 30, now); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if _, err := os.Stat(store.Path("app", ids[0])); !os.IsNotExist(err) {
+		t.Error("Expected run log older than 30 days to be removed")
+	}
+
+	if err := store.Prune("app", 2, 0, now); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(store.Dir(), "app"))
+	if len(entries) != 2 || entries[0].Name() != ids[2]+".log" {
+		t.Errorf("Expected the 2 newest run logs to remain, got %v", entries)
+	}
+
+	// Unknown projects have nothing to prune
+	if err := store.Prune("missing", 1, 1, now); err != nil {
+		t.Errorf("Expected no error for missing project, got %v", err)
+	}
+	if _, err := store.Create("app", "../escape"); err == nil {
+		t.Error("Expected error for invalid run ID")
+	}
+}
+
+// TestRunOutputWithoutRunLog tests that output is discarded when no run log is configured
+func TestRunOutputWithoutRunLog(t *testing.T) {
+	if runOutput(context.Background()) != io.Discard {
+		t.Error("Expected io.Discard without a run output writer")
+	}
+}
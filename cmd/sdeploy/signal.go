@@ -9,3 +9,9 @@ import (
 func getShutdownSignals() []os.Signal {
 	return []os.Signal{syscall.SIGINT, syscall.SIGTERM}
 }
+
+// getReopenLogSignals returns the signals that make the daemon reopen its log
+// file (sent by logrotate after moving the file away)
+func getReopenLogSignals() []os.Signal {
+	return []os.Signal{syscall.SIGUSR1}
+}
@@ -41,3 +41,11 @@ func TestGetShutdownSignalsNonEmpty(t *testing.T) {
 		t.Errorf("Expected at least 2 shutdown signals (SIGINT, SIGTERM), got %d", len(signals))
 	}
 }
+
+// TestGetReopenLogSignals tests that SIGUSR1 reopens the log file
+func TestGetReopenLogSignals(t *testing.T) {
+	signals := getReopenLogSignals()
+	if len(signals) != 1 || signals[0] != syscall.SIGUSR1 {
+		t.Errorf("Expected [SIGUSR1], got %v", signals)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StepResult holds the result of a single pipeline step or hook
+type StepResult struct {
+	Name      string    `json:"name"`
+	Command   string    `json:"command"`
+	Success   bool      `json:"success"`
+	Skipped   bool      `json:"skipped,omitempty"` // Not run because an earlier step failed
+	ExitCode  int       `json:"exit_code"`
+	Output    string    `json:"output"`
+	Error     string    `json:"error,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// Duration returns the step duration
+func (r *StepResult) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// Status returns a short status label: success, failed or skipped
+func (r *StepResult) Status() string {
+	switch {
+	case r.Skipped:
+		return "skipped"
+	case r.Success:
+		return "success"
+	default:
+		return "failed"
+	}
+}
+
+// stepAttrs returns the structured log attributes describing a finished step or hook
+func stepAttrs(r *StepResult) []slog.Attr {
+	return []slog.Attr{
+		slog.String("step", r.Name),
+		slog.Int64("duration_ms", r.Duration().Milliseconds()),
+		slog.Int("exit_code", r.ExitCode),
+	}
+}
+
+// executeSteps runs the project's steps sequentially. A failing step stops the
+// pipeline unless it has continue_on_error; remaining steps are marked skipped.
+// Returns per-step results, the combined output and the first fatal error.
+func (d *Deployer) executeSteps(ctx context.Context, project *ProjectConfig, executePath string, env []string) ([]StepResult, string, error) {
+	results := make([]StepResult, 0, len(project.Steps))
+	var output strings.Builder
+	var pipelineErr error
+
+	for i, step := range project.Steps {
+		result := StepResult{Name: step.Name, Command: step.Command}
+
+		if pipelineErr != nil {
+			result.Skipped = true
+			results = append(results, result)
+			continue
+		}
+
+		if d.logger != nil {
+			d.logger.InfofContext(ctx, project.Name, "Running step %d/%d: %s", i+1, len(project.Steps), step.Name)
+		}
+
+		timeout := step.TimeoutSeconds
+		if timeout == 0 {
+			timeout = project.TimeoutSeconds
+		}
+
+		result.StartTime = time.Now()
+		stepOutput, err := d.runCommand(ctx, project, commandSpec{
+			command:        step.Command,
+			dir:            stepExecutePath(executePath, step.ExecutePath),
+			timeoutSeconds: timeout,
+			env:            append(append([]string{}, env...), envPairs(step.Env)...),
+		})
+		result.EndTime = time.Now()
+		result.Output = stepOutput
+		result.ExitCode = exitCodeFromError(err)
+		result.Success = err == nil
+
+		fmt.Fprintf(&output, "==> [%s]\n", step.Name)
+		if stepOutput != "" {
+			output.WriteString(strings.TrimRight(stepOutput, "\n"))
+			output.WriteString("\n")
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+			if step.ContinueOnError {
+				if d.logger != nil {
+					d.logger.LogAttrs(slog.LevelWarn, project.Name, fmt.Sprintf("Step %s failed (continue_on_error): %v", step.Name, err), append(runContextAttrs(ctx), stepAttrs(&result)...)...)
+				}
+			} else {
+				if d.logger != nil {
+					d.logger.LogAttrs(slog.LevelError, project.Name, fmt.Sprintf("Step %s failed: %v", step.Name, err), append(runContextAttrs(ctx), stepAttrs(&result)...)...)
+				}
+				pipelineErr = fmt.Errorf("step %q failed: %w", step.Name, err)
+			}
+		} else if d.logger != nil {
+			d.logger.LogAttrs(slog.LevelInfo, project.Name, fmt.Sprintf("Step %s completed in %v", step.Name, result.Duration()), append(runContextAttrs(ctx), stepAttrs(&result)...)...)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, output.String(), pipelineErr
+}
+
+// stepExecutePath resolves a step's execute_path against the project's execute path
+func stepExecutePath(executePath, stepPath string) string {
+	if stepPath == "" {
+		return executePath
+	}
+	if filepath.IsAbs(stepPath) || executePath == "" {
+		return stepPath
+	}
+	return filepath.Join(executePath, stepPath)
+}
+
+// envPairs converts an env map to KEY=value pairs in a stable order
+func envPairs(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, env[key]))
+	}
+	return pairs
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDeploySteps tests sequential step execution with per-step results
+func TestDeploySteps(t *testing.T) {
+	tmpDir := t.TempDir()
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:        "TestProject",
+		WebhookPath: "/hooks/test",
+		LocalPath:   tmpDir,
+		Steps: []DeployStep{
+			{Name: "install", Command: "echo installing && echo $SDEPLOY_PROJECT_NAME"},
+			{Name: "build", Command: "pwd && echo $BUILD_MODE", ExecutePath: "web", Env: map[string]string{"BUILD_MODE": "production"}},
+		},
+	}
+	// Relative step paths resolve inside execute_path
+	if err := ensureDirectoryExists(context.Background(), tmpDir+"/web", nil, project.Name); err != nil {
+		t.Fatalf("Failed to create web dir: %v", err)
+	}
+
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if !result.Success {
+		t.Fatalf("Expected success, got error: %s (output: %s)", result.Error, result.Output)
+	}
+	if len(result.Steps) != 2 {
+		t.Fatalf("Expected 2 step results, got %d", len(result.Steps))
+	}
+
+	install, build := result.Steps[0], result.Steps[1]
+	if install.Name != "install" || !install.Success || !strings.Contains(install.Output, "TestProject") {
+		t.Errorf("Unexpected install step result: %+v", install)
+	}
+	if !build.Success || !strings.Contains(build.Output, tmpDir+"/web") || !strings.Contains(build.Output, "production") {
+		t.Errorf("Expected build step to run in web/ with step env, got: %+v", build)
+	}
+	if build.StartTime.Before(install.EndTime) {
+		t.Error("Expected steps to run sequentially")
+	}
+	if !strings.Contains(result.Output, "==> [install]") || !strings.Contains(result.Output, "==> [build]") {
+		t.Errorf("Expected combined output with step headers, got: %s", result.Output)
+	}
+}
+
+// TestDeployStepsStopOnFailure tests that a failing step stops the pipeline
+func TestDeployStepsStopOnFailure(t *testing.T) {
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:        "TestProject",
+		WebhookPath: "/hooks/test",
+		LocalPath:   t.TempDir(),
+		Steps: []DeployStep{
+			{Name: "lint", Command: "exit 2", ContinueOnError: true},
+			{Name: "build", Command: "echo broken && exit 3"},
+			{Name: "reload", Command: "echo reloading"},
+		},
+	}
+
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if result.Success {
+		t.Fatal("Expected deployment to fail")
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3 from failing step, got %d", result.ExitCode)
+	}
+	if !strings.Contains(result.Error, `step "build" failed`) {
+		t.Errorf("Expected error to name the failing step, got: %s", result.Error)
+	}
+
+	statuses := make([]string, 0, len(result.Steps))
+	for _, step := range result.Steps {
+		statuses = append(statuses, step.Status())
+	}
+	if strings.Join(statuses, ",") != "failed,failed,skipped" {
+		t.Errorf("Expected step statuses failed,failed,skipped, got %v", statuses)
+	}
+	if result.Steps[0].ExitCode != 2 {
+		t.Errorf("Expected lint exit code 2, got %d", result.Steps[0].ExitCode)
+	}
+	if strings.Contains(result.Output, "reloading") {
+		t.Error("Expected skipped step not to run")
+	}
+}
+
+// TestDeployStepTimeout tests per-step timeouts
+func TestDeployStepTimeout(t *testing.T) {
+	deployer := NewDeployer(nil)
+
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		LocalPath:      t.TempDir(),
+		TimeoutSeconds: 30,
+		Steps: []DeployStep{
+			{Name: "slow", Command: "sleep 10", TimeoutSeconds: 1},
+		},
+	}
+
+	start := time.Now()
+	result := deployer.Deploy(context.Background(), project, "WEBHOOK")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected step timeout after 1s, took %v", elapsed)
+	}
+	if result.Success || !strings.Contains(result.Steps[0].Error, "timed out after 1 seconds") {
+		t.Errorf("Expected step timeout error, got: %+v", result.Steps[0])
+	}
+}
+
+// TestStepExecutePath tests step execute_path resolution
+func TestStepExecutePath(t *testing.T) {
+	tests := []struct {
+		executePath, stepPath, expected string
+	}{
+		{"/var/www/app", "", "/var/www/app"},
+		{"/var/www/app", "web", "/var/www/app/web"},
+		{"/var/www/app", "/opt/tools", "/opt/tools"},
+		{"", "web", "web"},
+	}
+
+	for _, tc := range tests {
+		if got := stepExecutePath(tc.executePath, tc.stepPath); got != tc.expected {
+			t.Errorf("stepExecutePath(%q, %q) = %q, expected %q", tc.executePath, tc.stepPath, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// lineWriter splits written bytes into lines and passes each line (without
+// its newline) to fn. Flush passes a final partial line.
+type lineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+// newLineWriter creates a line-splitting writer
+func newLineWriter(fn func(line string)) *lineWriter {
+	return &lineWriter{fn: fn}
+}
+
+// Write implements io.Writer
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(lw.buf[:i])
+		lw.buf = lw.buf[i+1:]
+		lw.fn(line)
+	}
+	return len(p), nil
+}
+
+// Flush passes any buffered partial line to fn
+func (lw *lineWriter) Flush() {
+	if len(lw.buf) == 0 {
+		return
+	}
+	line := string(lw.buf)
+	lw.buf = nil
+	lw.fn(line)
+}
+
+// displayLine returns what a terminal shows for line: progress output that
+// redraws itself with carriage returns keeps only its last state
+func displayLine(line string) string {
+	line = strings.TrimRight(line, "\r")
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		return line[i+1:]
+	}
+	return line
+}
+
+// RunStream holds the live output of a running deployment for SSE subscribers.
+// Lines are numbered from 0; only the newest Defaults.StreamBacklog lines are kept.
+type RunStream struct {
+	mu     sync.Mutex
+	lines  []string
+	first  int // sequence number of lines[0]
+	subs   map[chan struct{}]struct{}
+	result *DeployResult // set when the run has finished
+}
+
+// newRunStream creates an empty run stream
+func newRunStream() *RunStream {
+	return &RunStream{subs: make(map[chan struct{}]struct{})}
+}
+
+// Publish appends a line and wakes all subscribers
+func (s *RunStream) Publish(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, line)
+	if extra := len(s.lines) - Defaults.StreamBacklog; extra > 0 {
+		s.lines = append(s.lines[:0:0], s.lines[extra:]...)
+		s.first += extra
+	}
+	s.notify()
+}
+
+// finish marks the run as finished with result and wakes all subscribers
+func (s *RunStream) finish(result *DeployResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.result = result
+	s.notify()
+}
+
+// notify wakes subscribers without blocking; caller must hold s.mu
+func (s *RunStream) notify() {
+	for ch := range s.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel signalled whenever lines are published or the
+// run finishes, and a function to unsubscribe
+func (s *RunStream) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.subs[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+	}
+}
+
+// Lines returns the lines from sequence number from onward (or the oldest kept
+// line, if from was dropped), the sequence number following them, and the
+// run's result once all lines have been returned after it finished
+func (s *RunStream) Lines(from int) ([]string, int, *DeployResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if from < s.first {
+		from = s.first
+	}
+	next := s.first + len(s.lines)
+	var lines []string
+	if from < next {
+		lines = append(lines, s.lines[from-s.first:]...)
+	}
+	return lines, next, s.result
+}
+
+// StreamHub tracks the streams of running deployments by run ID
+type StreamHub struct {
+	mu      sync.Mutex
+	runs    map[string]*RunStream
+	current map[string][]string // webhook path -> IDs of running runs, oldest first
+}
+
+// NewStreamHub creates an empty stream hub
+func NewStreamHub() *StreamHub {
+	return &StreamHub{
+		runs:    make(map[string]*RunStream),
+		current: make(map[string][]string),
+	}
+}
+
+// open registers the stream of a run that is starting
+func (h *StreamHub) open(runID, projectPath string) *RunStream {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stream := newRunStream()
+	h.runs[runID] = stream
+	h.current[projectPath] = append(h.current[projectPath], runID)
+	return stream
+}
+
+// close finishes a run's stream and unregisters it
+func (h *StreamHub) close(runID, projectPath string, result *DeployResult) {
+	h.mu.Lock()
+	stream := h.runs[runID]
+	delete(h.runs, runID)
+	running := slices.DeleteFunc(h.current[projectPath], func(id string) bool { return id == runID })
+	if len(running) == 0 {
+		delete(h.current, projectPath)
+	} else {
+		h.current[projectPath] = running
+	}
+	h.mu.Unlock()
+
+	if stream != nil {
+		stream.finish(result)
+	}
+}
+
+// Get returns the stream of a running deployment, or nil if the run is not running
+func (h *StreamHub) Get(runID string) *RunStream {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.runs[runID]
+}
+
+// Current returns the ID of the run currently executing for a project (the
+// latest one when several branches deploy at once), or ""
+func (h *StreamHub) Current(projectPath string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	running := h.current[projectPath]
+	if len(running) == 0 {
+		return ""
+	}
+	return running[len(running)-1]
+}
+
+// runOutputSink receives a run's output, redacts it line by line and copies
+// each line to the run's live stream and, if enabled, its run log file
+type runOutputSink struct {
+	out    *redactingWriter
+	lines  *lineWriter
+	stream *RunStream
+	log    *os.File
+}
+
+// openRunOutput registers the run's live stream, creates its run log file (if
+// run logs are enabled) and routes the run's output to both
+func (d *Deployer) openRunOutput(req *deployRequest) *runOutputSink {
+	req.ctx = withRunAttrs(req.ctx, req.logAttrs()...)
+	sink := &runOutputSink{stream: d.streams.open(req.runID, req.project.WebhookPath)}
+	sink.log = d.openRunLog(req)
+	sink.lines = newLineWriter(func(line string) {
+		if sink.log != nil {
+			fmt.Fprintln(sink.log, line)
+		}
+		sink.stream.Publish(displayLine(line))
+	})
+	sink.out = newRedactingWriter(d.redactor, sink.lines)
+
+	req.ctx = withRunOutput(req.ctx, sink.out)
+	return sink
+}
+
+// closeRunOutput writes the run's last partial line and closes its run log.
+// The stream stays registered until the run is recorded (see Deployer.run).
+func (d *Deployer) closeRunOutput(project *ProjectConfig, sink *runOutputSink, result *DeployResult) {
+	sink.out.Flush()
+	sink.lines.Flush()
+	if sink.log != nil {
+		d.closeRunLog(project, sink.log, result)
+	}
+}
+
+// runAttrsKey is the context key of the log attributes identifying a run
+type runAttrsKey struct{}
+
+// withRunAttrs returns a context carrying the log attributes of a run.
+// The slice is clipped so that appending to it never writes to shared memory.
+func withRunAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, runAttrsKey{}, slices.Clip(attrs))
+}
+
+// runContextAttrs returns the log attributes of the run ctx belongs to
+func runContextAttrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(runAttrsKey{}).([]slog.Attr)
+	return attrs
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLineWriter tests splitting writes into lines and flushing a partial line
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	lw := newLineWriter(func(line string) { lines = append(lines, line) })
+
+	lw.Write([]byte("first li"))
+	lw.Write([]byte("ne\nsecond\nthi"))
+	if strings.Join(lines, "|") != "first line|second" {
+		t.Errorf("Expected only complete lines, got %q", lines)
+	}
+	lw.Flush()
+	lw.Flush()
+	if strings.Join(lines, "|") != "first line|second|thi" {
+		t.Errorf("Expected partial line once on Flush, got %q", lines)
+	}
+}
+
+// TestDisplayLine tests collapsing carriage-return progress output
+func TestDisplayLine(t *testing.T) {
+	tests := map[string]string{
+		"plain":                         "plain",
+		"windows\r":                     "windows",
+		"Receiving 10%\rReceiving 100%": "Receiving 100%",
+	}
+	for input, expected := range tests {
+		if got := displayLine(input); got != expected {
+			t.Errorf("displayLine(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+// TestRunStreamBacklog tests reading lines by sequence number with a bounded backlog
+func TestRunStreamBacklog(t *testing.T) {
+	stream := newRunStream()
+	for i := 0; i < Defaults.StreamBacklog+10; i++ {
+		stream.Publish(fmt.Sprintf("line %d", i))
+	}
+
+	lines, next, result := stream.Lines(0)
+	if len(lines) != Defaults.StreamBacklog || lines[0] != "line 10" || next != Defaults.StreamBacklog+10 || result != nil {
+		t.Errorf("Expected newest %d lines from line 10, got %d lines starting %q (next %d)", Defaults.StreamBacklog, len(lines), lines[0], next)
+	}
+
+	notify, unsubscribe := stream.Subscribe()
+	defer unsubscribe()
+	stream.Publish("last")
+	<-notify
+	lines, next, _ = stream.Lines(next)
+	if len(lines) != 1 || lines[0] != "last" {
+		t.Errorf("Expected only the new line, got %q", lines)
+	}
+
+	stream.finish(&DeployResult{RunID: "run", Success: true})
+	<-notify
+	if lines, _, result := stream.Lines(next); len(lines) != 0 || result == nil {
+		t.Errorf("Expected finished stream with no new lines, got %q and %v", lines, result)
+	}
+}
+
+// sseEvent is a parsed Server-Sent Event
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSEEvent reads the next event from an SSE stream, skipping comments
+func readSSEEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read SSE stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if ev != (sseEvent{}) {
+				return ev
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// TestAPIRunStream tests streaming a running deployment's output line by line over SSE
+func TestAPIRunStream(t *testing.T) {
+	handler, deployer, _ := newTestAPIHandler(t, testAPIConfig)
+	redactor := NewRedactor(handler.configManager.GetConfig())
+	deployer.SetRedactor(redactor)
+
+	project := *handler.configManager.GetProjectByName("Backend")
+	release := t.TempDir() + "/release"
+	// The second line is only printed once the test has seen the first one
+	project.ExecuteCommand = fmt.Sprintf("echo 'building secret2'; while [ ! -e %s ]; do sleep 0.05; done; echo done", release)
+	go deployer.Deploy(context.Background(), &project, "INTERNAL")
+
+	var runID string
+	for i := 0; i < 100 && runID == ""; i++ {
+		time.Sleep(20 * time.Millisecond)
+		runID = deployer.CurrentRun(project.WebhookPath)
+	}
+	if runID == "" {
+		t.Fatal("Expected a current run")
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	req, _ := http.NewRequest("GET", server.URL+"/api/runs/"+runID+"/stream", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Stream request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected 200 event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+
+	// Output arrives while the command is still running, with secrets redacted
+	var ev sseEvent
+	for ev.data != "building [REDACTED]" {
+		ev = readSSEEvent(t, reader)
+		if ev.event == "done" {
+			t.Fatalf("Run finished before its first output line was streamed")
+		}
+	}
+	if err := os.WriteFile(release, nil, 0644); err != nil {
+		t.Fatalf("Failed to release command: %v", err)
+	}
+
+	var lines []string
+	for {
+		ev = readSSEEvent(t, reader)
+		if ev.event == "done" {
+			break
+		}
+		lines = append(lines, ev.data)
+	}
+	if len(lines) == 0 || lines[len(lines)-1] != "done" {
+		t.Errorf("Expected remaining output ending with done, got %q", lines)
+	}
+	var run runView
+	if err := json.Unmarshal([]byte(ev.data), &run); err != nil || run.RunID != runID || run.Status != "success" {
+		t.Errorf("Expected done event with successful run %s, got %s (err: %v)", runID, ev.data, err)
+	}
+	// The run is recorded before its stream ends, so it is never missing from both
+	if rr := apiRequest(handler, "GET", "/api/runs/"+runID); rr.Code != http.StatusOK {
+		t.Errorf("Expected run %s in history once its stream is done, got %d", runID, rr.Code)
+	}
+
+	// A finished run streams its result only
+	waitForIdle(t, deployer)
+	rr := apiRequest(handler, "GET", "/api/runs/"+runID+"/stream")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "event: done\n") {
+		t.Errorf("Expected done event for finished run, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := apiRequest(handler, "GET", "/api/runs/unknown/stream"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown run, got %d", rr.Code)
+	}
+}
+
+// TestDeployLogsOutputLines tests that command output is logged line by line,
+// stderr lines at ERROR
+func TestDeployLogsOutputLines(t *testing.T) {
+	var buf bytes.Buffer
+	deployer := NewDeployer(NewLogger(&buf, "", false))
+	project := &ProjectConfig{
+		Name:           "TestProject",
+		WebhookPath:    "/hooks/test",
+		ExecutePath:    t.TempDir(),
+		ExecuteCommand: "echo built; echo warning >&2",
+	}
+
+	if result := deployer.Deploy(context.Background(), project, "INTERNAL"); !result.Success {
+		t.Fatalf("Expected success, got error: %s", result.Error)
+	}
+	for _, expected := range []string{"[INFO] [TestProject] Command output: built", "[ERROR] [TestProject] Command output: warning"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected %q in log, got:\n%s", expected, buf.String())
+		}
+	}
+}
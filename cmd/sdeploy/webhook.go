@@ -2,13 +2,11 @@ package main
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // TriggerSource represents the source of a deployment trigger
@@ -19,11 +17,30 @@ const (
 	TriggerInternal TriggerSource = "INTERNAL"
 )
 
+// WebhookEvent holds the details extracted from a webhook request
+type WebhookEvent struct {
+	Provider string // Forge that sent the webhook (github, gitlab, gitea, bitbucket, generic)
+	Event    string // Raw event type header (e.g., X-GitHub-Event, X-Gitlab-Event)
+	Kind     string // Normalized event kind (push, tag, release, workflow_run, merge_request, ping), "" if unsupported
+	Branch   string // Branch name for branch pushes
+	Tag      string // Tag name for tag pushes
+	Commit   string // Commit SHA the event points to
+	Before   string // Commit SHA the branch pointed to before a push
+	Repo     string // Repository identifier (e.g., owner/name)
+	Delivery string // Unique delivery ID (e.g., X-GitHub-Delivery) or signed trigger nonce
+
+	ChangedFiles  []string // Paths added, modified or removed by the pushed commits
+	FilesComplete bool     // ChangedFiles lists every changed path (the payload was not truncated)
+}
+
 // WebhookHandler handles incoming webhook requests
 type WebhookHandler struct {
 	configManager *ConfigManager
 	logger        *Logger
 	deployer      *Deployer
+	metrics       *Metrics
+	deliveries    *DeliveryStore
+	baseCtx       context.Context // Parent context of triggered deployments
 	// Legacy fields for backward compatibility when ConfigManager is not used
 	config   *Config
 	projects map[string]*ProjectConfig
@@ -58,6 +75,22 @@ func (h *WebhookHandler) SetDeployer(deployer *Deployer) {
 	h.deployer = deployer
 }
 
+// SetMetrics sets the metrics registry used to count webhook outcomes
+func (h *WebhookHandler) SetMetrics(metrics *Metrics) {
+	h.metrics = metrics
+}
+
+// SetDeliveryStore sets the store used to reject replayed deliveries
+func (h *WebhookHandler) SetDeliveryStore(store *DeliveryStore) {
+	h.deliveries = store
+}
+
+// SetBaseContext sets the parent context of triggered deployments; cancelling
+// it stops their commands (used on shutdown)
+func (h *WebhookHandler) SetBaseContext(ctx context.Context) {
+	h.baseCtx = ctx
+}
+
 // getProject looks up a project by webhook path, supporting both hot reload and legacy modes
 func (h *WebhookHandler) getProject(path string) *ProjectConfig {
 	if h.configManager != nil {
@@ -67,10 +100,36 @@ func (h *WebhookHandler) getProject(path string) *ProjectConfig {
 	return h.projects[path]
 }
 
+// globalConfig returns the current configuration, supporting both hot reload and legacy modes
+func (h *WebhookHandler) globalConfig() *Config {
+	if h.configManager != nil {
+		return h.configManager.GetConfig()
+	}
+	if h.config != nil {
+		return h.config
+	}
+	return &Config{}
+}
+
+// logPayloads reports whether full webhook payloads should be logged (log_payloads)
+func (h *WebhookHandler) logPayloads() bool {
+	return h.globalConfig().LogPayloads
+}
+
+// triggerMaxSkew returns how far a signed trigger's timestamp may be from the server time
+func (h *WebhookHandler) triggerMaxSkew() time.Duration {
+	seconds := h.globalConfig().TriggerMaxSkew
+	if seconds <= 0 {
+		seconds = Defaults.TriggerMaxSkew
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 // ServeHTTP implements http.Handler
 func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST
 	if r.Method != http.MethodPost {
+		h.metrics.IncWebhook("", WebhookMethodNotAllowed)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -78,6 +137,7 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Find project by path (supports hot reload)
 	project := h.getProject(r.URL.Path)
 	if project == nil {
+		h.metrics.IncWebhook("", WebhookNotFound)
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
 	}
@@ -85,6 +145,7 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Read body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
+		h.metrics.IncWebhook(project.Name, WebhookBadRequest)
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
@@ -93,6 +154,7 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Validate JSON (at least check it's valid)
 	var jsonCheck map[string]interface{}
 	if err := json.Unmarshal(body, &jsonCheck); err != nil {
+		h.metrics.IncWebhook(project.Name, WebhookBadRequest)
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
@@ -100,58 +162,168 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Authenticate and determine trigger source
 	triggerSource, authenticated := h.authenticate(r, body, project)
 	if !authenticated {
+		h.metrics.IncWebhook(project.Name, WebhookUnauthorized)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	// Extract branch from payload
-	branch := extractBranchFromPayload(body)
+	// Extract branch, commit and repo from payload
+	event := parseWebhookEvent(r, body)
+	branch := event.Branch
+
+	// Delivery IDs are stored in the state file, so bound their length like nonces
+	if len(event.Delivery) > maxDeliveryIDLength {
+		h.metrics.IncWebhook(project.Name, WebhookBadRequest)
+		http.Error(w, "Delivery ID too long", http.StatusBadRequest)
+		return
+	}
+
+	// Reject replays of an already accepted delivery. IDs are only remembered
+	// after authentication, so unsigned requests cannot fill the seen-set.
+	// Forge delivery headers are unsigned, so the signed body is remembered too.
+	deliveryIDs := []string{event.Delivery}
+	if triggerSource == TriggerWebhook {
+		deliveryIDs = append(deliveryIDs, payloadDigest(body))
+	}
+	replayed, err := h.deliveries.Check(projectKey(project), h.globalConfig().DeliveryIDKeep, deliveryIDs...)
+	if err != nil && h.logger != nil {
+		h.logger.Warnf(project.Name, "Failed to persist delivery ID: %v", err)
+	}
+	if replayed {
+		if h.logger != nil {
+			h.logger.Warnf(project.Name, "Rejected replayed delivery %s", event.Delivery)
+		}
+		h.metrics.IncWebhook(project.Name, WebhookReplayed)
+		http.Error(w, "Duplicate delivery", http.StatusConflict)
+		return
+	}
 
 	// Log the webhook receipt
 	if h.logger != nil {
 		h.logger.Infof(project.Name, "Received %s trigger for branch: %s", triggerSource, branch)
-		//print the full payload
-		h.logger.Infof(project.Name, "Payload: %s", string(body))
+		if event.Tag != "" || event.Commit != "" || event.Repo != "" {
+			h.logger.Infof(project.Name, "Event: provider=%s, event=%s, repo=%s, tag=%s, commit=%s", event.Provider, event.Event, event.Repo, event.Tag, event.Commit)
+		}
+		// Payloads can carry tokens or private data, so only their size is logged by default
+		if h.logPayloads() {
+			h.logger.Infof(project.Name, "Payload: %s", string(body))
+		} else {
+			h.logger.Infof(project.Name, "Payload: %d bytes (set log_payloads: true to log it)", len(body))
+		}
+	}
+
+	// Answer connectivity checks (e.g., GitHub's ping on webhook creation) without deploying
+	if event.Kind == EventPing {
+		if h.logger != nil {
+			h.logger.Infof(project.Name, "Received ping from %s", event.Provider)
+		}
+		h.metrics.IncWebhook(project.Name, WebhookPing)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Pong"))
+		return
+	}
+
+	// Forge webhooks deploy only on the event kinds in the project's events list
+	if triggerSource == TriggerWebhook && !projectAllowsEvent(project, event.Kind) {
+		if h.logger != nil {
+			h.logger.Infof(project.Name, "Ignoring %s event (not in events). Skipping.", eventDescription(event))
+		}
+		h.metrics.IncWebhook(project.Name, WebhookEventIgnored)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("Accepted (event ignored, skipped)"))
+		return
+	}
+
+	// Tag and release events deploy only tags matching git_tag_pattern
+	if triggerSource == TriggerWebhook && event.Tag != "" && !matchRefPattern(project.GitTagPattern, event.Tag) {
+		if h.logger != nil {
+			h.logger.Warnf(project.Name, "Tag mismatch: %s does not match git_tag_pattern %s. Skipping.", event.Tag, project.GitTagPattern)
+		}
+		h.metrics.IncWebhook(project.Name, WebhookTagMismatch)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("Accepted (tag mismatch, skipped)"))
+		return
 	}
 
 	// Check branch match (for WEBHOOK triggers, we validate branch)
-	if triggerSource == TriggerWebhook && project.GitBranch != "" && branch != "" && branch != project.GitBranch {
+	if triggerSource == TriggerWebhook && branch != "" && !project.acceptsBranch(branch) {
 		if h.logger != nil {
-			h.logger.Warnf(project.Name, "Branch mismatch: expected %s, got %s. Skipping.", project.GitBranch, branch)
+			h.logger.Warnf(project.Name, "Branch mismatch: expected %s, got %s. Skipping.", project.branchDescription(), branch)
 		}
+		h.metrics.IncWebhook(project.Name, WebhookBranchMismatch)
 		w.WriteHeader(http.StatusAccepted)
 		_, _ = w.Write([]byte("Accepted (branch mismatch, skipped)"))
 		return
 	}
 
+	// Skip pushes whose file lists show no change relevant to include_paths/exclude_paths.
+	// Incomplete lists are checked with git diff once the repository is fetched.
+	if triggerSource == TriggerWebhook && event.Kind == EventPush && project.hasPathFilters() && event.FilesComplete &&
+		len(project.relevantFiles(event.ChangedFiles)) == 0 {
+		if h.logger != nil {
+			h.logger.Infof(project.Name, "No relevant changes: none of %d changed files match %s. Skipping.", len(event.ChangedFiles), project.pathFilterDescription())
+		}
+		h.metrics.IncWebhook(project.Name, WebhookNoChanges)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("Accepted (no relevant changes, skipped)"))
+		return
+	}
+
+	// Deploy the pushed branch with the settings of its branches entry
+	project = project.forBranch(branch)
+
 	// Trigger deployment asynchronously
-	go func() {
-		if h.deployer != nil {
-			// Use a background context since HTTP request context is canceled after response
+	ctx := h.baseCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if h.deployer != nil {
+		// Count the deployment before answering, so a shutdown starting now waits for it
+		accepted := h.deployer.Accept()
+		go func() {
+			defer accepted()
+			// Use the base context since HTTP request context is canceled after response
 			// Deploy already logs start/completion/failure, so no extra logging needed here
-			h.deployer.Deploy(context.Background(), project, string(triggerSource))
-		}
-	}()
+			h.deployer.DeployEvent(ctx, project, string(triggerSource), event)
+		}()
+	}
 
+	h.metrics.IncWebhook(project.Name, WebhookAccepted)
 	w.WriteHeader(http.StatusAccepted)
 	_, _ = w.Write([]byte("Accepted"))
 }
 
 // authenticate checks request authentication
 func (h *WebhookHandler) authenticate(r *http.Request, body []byte, project *ProjectConfig) (TriggerSource, bool) {
-	// First check HMAC signature (X-Hub-Signature-256)
-	signature := r.Header.Get("X-Hub-Signature-256")
-	if signature != "" {
-		if validateHMAC(body, signature, project.WebhookSecret) {
+	// Forge webhooks are authenticated by the provider detected from request headers
+	if provider := detectProvider(r); provider != nil {
+		if provider.Authenticate(r, body, project.WebhookSecret) {
 			return TriggerWebhook, true
 		}
 		return "", false
 	}
 
+	// Signed internal triggers carry an HMAC over timestamp, nonce and body
+	if r.Header.Get(TriggerSignatureHeader) != "" {
+		if err := validateSignedTrigger(r, body, project.WebhookSecret, h.triggerMaxSkew(), time.Now()); err != nil {
+			if h.logger != nil {
+				h.logger.Warnf(project.Name, "Rejected signed trigger: %v", err)
+			}
+			return "", false
+		}
+		return TriggerInternal, true
+	}
+
 	// Fallback to secret query parameter
 	secret := r.URL.Query().Get("secret")
 	if secret != "" {
-		if secret == project.WebhookSecret {
+		if project.RequireSignedTrigger {
+			if h.logger != nil {
+				h.logger.Warn(project.Name, "Rejected ?secret= trigger: require_signed_trigger is enabled")
+			}
+			return "", false
+		}
+		if validateToken(secret, project.WebhookSecret) {
 			return TriggerInternal, true
 		}
 		return "", false
@@ -160,39 +332,32 @@ func (h *WebhookHandler) authenticate(r *http.Request, body []byte, project *Pro
 	return "", false
 }
 
-// validateHMAC validates HMAC-SHA256 signature
-func validateHMAC(payload []byte, signature, secret string) bool {
-	// Signature format: sha256=<hex>
-	if !strings.HasPrefix(signature, "sha256=") {
-		return false
-	}
-
-	providedMAC, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
-	if err != nil {
-		return false
+// parseWebhookEvent extracts event details using the provider detected from request headers
+func parseWebhookEvent(r *http.Request, body []byte) *WebhookEvent {
+	if provider := detectProvider(r); provider != nil {
+		return provider.ParseEvent(r, body)
 	}
 
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write(payload)
-	expectedMAC := mac.Sum(nil)
-
-	return hmac.Equal(providedMAC, expectedMAC)
+	// Internal triggers use the generic {"ref": "refs/heads/<branch>"} payload
+	event := extractGitHubEvent(body)
+	event.Provider = ProviderGeneric
+	event.Delivery = r.Header.Get(TriggerNonceHeader)
+	event.Kind = refEventKind(event)
+	return event
 }
 
-// extractBranchFromPayload extracts branch name from webhook payload
-func extractBranchFromPayload(payload []byte) string {
-	var data struct {
-		Ref string `json:"ref"`
+// parseRef splits a git ref into branch or tag name
+func parseRef(ref string) (branch, tag string) {
+	if strings.HasPrefix(ref, "refs/heads/") {
+		return strings.TrimPrefix(ref, "refs/heads/"), ""
 	}
-
-	if err := json.Unmarshal(payload, &data); err != nil {
-		return ""
-	}
-
-	// GitHub format: refs/heads/branch-name
-	if strings.HasPrefix(data.Ref, "refs/heads/") {
-		return strings.TrimPrefix(data.Ref, "refs/heads/")
+	if strings.HasPrefix(ref, "refs/tags/") {
+		return "", strings.TrimPrefix(ref, "refs/tags/")
 	}
+	return "", ""
+}
 
-	return ""
+// extractBranchFromPayload extracts branch name from webhook payload
+func extractBranchFromPayload(payload []byte) string {
+	return extractGitHubEvent(payload).Branch
 }
@@ -5,8 +5,10 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -349,3 +351,162 @@ func TestValidateHMAC(t *testing.T) {
 		t.Error("Expected malformed signature to return false")
 	}
 }
+
+// TestWebhookGitLabToken tests GitLab X-Gitlab-Token authentication
+func TestWebhookGitLabToken(t *testing.T) {
+	cfg := &Config{
+		Projects: []ProjectConfig{
+			{
+				Name:           "TestProject",
+				WebhookPath:    "/hooks/test",
+				WebhookSecret:  "mysecret",
+				GitBranch:      "main",
+				ExecuteCommand: "echo test",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, "", false)
+	handler := NewWebhookHandler(cfg, logger)
+
+	payload := `{"object_kind":"push","ref":"refs/heads/main","checkout_sha":"da1560886d4f094c3e6c9ef40349f7d38b5d27d7","project":{"path_with_namespace":"mike/diaspora"}}`
+
+	// Valid token
+	req := httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Token", "mysecret")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202 with valid GitLab token, got %d", rr.Code)
+	}
+	if !strings.Contains(buf.String(), "Received WEBHOOK trigger for branch: main") {
+		t.Errorf("Expected GitLab push to be classified as WEBHOOK trigger, got: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "repo=mike/diaspora") {
+		t.Errorf("Expected GitLab repo to be logged, got: %s", buf.String())
+	}
+
+	// Invalid token
+	req = httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Token", "wrong")
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 with invalid GitLab token, got %d", rr.Code)
+	}
+
+	// GitLab branch mismatch is skipped like GitHub
+	payload = `{"object_kind":"push","ref":"refs/heads/develop"}`
+	req = httptest.NewRequest("POST", "/hooks/test", strings.NewReader(payload))
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Token", "mysecret")
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), "branch mismatch") {
+		t.Errorf("Expected branch mismatch response, got: %s", rr.Body.String())
+	}
+}
+
+// TestExtractGitLabEvent tests extracting details from GitLab push and tag payloads
+func TestExtractGitLabEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected WebhookEvent
+	}{
+		{
+			name:    "push event",
+			payload: `{"object_kind":"push","ref":"refs/heads/main","before":"95790bf8","after":"da156088","checkout_sha":"da156088","project":{"path_with_namespace":"group/app"}}`,
+			expected: WebhookEvent{
+				Provider: ProviderGitLab,
+				Branch:   "main",
+				Commit:   "da156088",
+				Before:   "95790bf8",
+				Repo:     "group/app",
+			},
+		},
+		{
+			name:    "tag push event",
+			payload: `{"object_kind":"tag_push","ref":"refs/tags/v1.2.3","checkout_sha":"82b3d5ae","project":{"path_with_namespace":"group/app"}}`,
+			expected: WebhookEvent{
+				Provider: ProviderGitLab,
+				Tag:      "v1.2.3",
+				Commit:   "82b3d5ae",
+				Repo:     "group/app",
+			},
+		},
+		{
+			name:    "falls back to after",
+			payload: `{"ref":"refs/heads/develop","after":"abc123"}`,
+			expected: WebhookEvent{
+				Provider: ProviderGitLab,
+				Branch:   "develop",
+				Commit:   "abc123",
+			},
+		},
+		{
+			name:     "invalid payload",
+			payload:  `not json`,
+			expected: WebhookEvent{Provider: ProviderGitLab},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			event := extractGitLabEvent([]byte(tc.payload))
+			if !reflect.DeepEqual(*event, tc.expected) {
+				t.Errorf("Expected %+v, got %+v", tc.expected, *event)
+			}
+		})
+	}
+}
+
+// TestExtractGitHubEvent tests extracting details from a GitHub push payload
+func TestExtractGitHubEvent(t *testing.T) {
+	payload := `{"ref":"refs/heads/main","after":"6113728f27ae82c7b1a177c8d03f9e96e0adf246","repository":{"full_name":"octo/hello"}}`
+	event := extractGitHubEvent([]byte(payload))
+
+	if event.Provider != ProviderGitHub || event.Branch != "main" || event.Repo != "octo/hello" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	if event.Commit != "6113728f27ae82c7b1a177c8d03f9e96e0adf246" {
+		t.Errorf("Expected commit from 'after', got %s", event.Commit)
+	}
+
+	tagEvent := extractGitHubEvent([]byte(`{"ref":"refs/tags/v1.0.0"}`))
+	if tagEvent.Tag != "v1.0.0" || tagEvent.Branch != "" {
+		t.Errorf("Expected tag v1.0.0 and no branch, got %+v", tagEvent)
+	}
+}
+
+// TestWebhookPayloadLogging tests that payloads are only logged when log_payloads is enabled
+func TestWebhookPayloadLogging(t *testing.T) {
+	payload := `{"ref":"refs/heads/main","token":"payload-token"}`
+	for _, logPayloads := range []bool{false, true} {
+		cfg := &Config{
+			LogPayloads: logPayloads,
+			Projects: []ProjectConfig{
+				{Name: "TestProject", WebhookPath: "/hooks/test", WebhookSecret: "mysecret", GitBranch: "main", ExecuteCommand: "echo test"},
+			},
+		}
+		var buf bytes.Buffer
+		handler := NewWebhookHandler(cfg, NewLogger(&buf, "", false))
+
+		req := httptest.NewRequest("POST", "/hooks/test?secret=mysecret", strings.NewReader(payload))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		logged := strings.Contains(buf.String(), "payload-token")
+		if logged != logPayloads {
+			t.Errorf("log_payloads=%t: expected payload logged=%t, got log:\n%s", logPayloads, logPayloads, buf.String())
+		}
+		if !logPayloads && !strings.Contains(buf.String(), fmt.Sprintf("Payload: %d bytes", len(payload))) {
+			t.Errorf("Expected payload size to be logged, got:\n%s", buf.String())
+		}
+	}
+}